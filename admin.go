@@ -0,0 +1,231 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// An admin view of one filter, as listed by AdminHandler
+type adminFilter struct {
+	Name     string
+	Level    string
+	Writer   string
+	Disabled bool
+	Stats    FilterStats
+}
+
+// AdminHandler returns an http.Handler for looking at and changing the
+// logging of a running program.  Mount it under a prefix with
+// http.StripPrefix and keep it away from untrusted clients.
+//
+//	GET  /filters                          list the filters as JSON
+//	POST /level?filter=F&level=L[&source=S] set the level of filter F (or all
+//	                                       filters) for source S (or all)
+//	POST /flush                            flush all filters
+//	POST /verbosity?v=N[&vmodule=SPEC]     set the verbosity of V, and of
+//	                                       source files if SPEC is given
+//	POST /disable?filter=F                 stop filter F taking records
+//	POST /enable?filter=F                  let filter F take records again
+//	GET  /tail?n=N[&filter=F]              the last N records kept by the
+//	                                       RingLogWriter of filter F (or the
+//	                                       first one found)
+//	GET  /health                           the errors of the filters whose
+//	                                       writer does not work, as JSON;
+//	                                       503 if there are any
+func AdminHandler(log *Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/filters", func(w http.ResponseWriter, r *http.Request) {
+		adminFilters(log, w, r)
+	})
+	mux.HandleFunc("/level", func(w http.ResponseWriter, r *http.Request) {
+		adminLevel(log, w, r)
+	})
+	mux.HandleFunc("/flush", func(w http.ResponseWriter, r *http.Request) {
+		adminFlush(log, w, r)
+	})
+	mux.HandleFunc("/verbosity", func(w http.ResponseWriter, r *http.Request) {
+		adminVerbosity(log, w, r)
+	})
+	mux.HandleFunc("/disable", func(w http.ResponseWriter, r *http.Request) {
+		adminEnable(log, w, r, false)
+	})
+	mux.HandleFunc("/enable", func(w http.ResponseWriter, r *http.Request) {
+		adminEnable(log, w, r, true)
+	})
+	mux.HandleFunc("/tail", func(w http.ResponseWriter, r *http.Request) {
+		adminTail(log, w, r)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		adminHealth(log, w, r)
+	})
+	return mux
+}
+
+func adminFilters(log *Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var list []adminFilter
+	for _, info := range log.Filters() {
+		list = append(list, adminFilter{
+			Name:     info.Name,
+			Level:    info.Level.String(),
+			Writer:   info.Writer,
+			Disabled: info.Disabled,
+			Stats:    info.Stats,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Levels are changed through source level rules, which filters read
+// atomically, so they may change while other goroutines log.
+func adminLevel(log *Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lvl, ok := ParseLevel(r.FormValue("level"))
+	if !ok {
+		http.Error(w, "unknown level "+strconv.Quote(r.FormValue("level")), http.StatusBadRequest)
+		return
+	}
+	source := r.FormValue("source")
+	if len(source) == 0 {
+		source = "*"
+	}
+
+	filters := log.load().filters
+	if name := r.FormValue("filter"); len(name) > 0 {
+		filt, ok := filters[name]
+		if !ok {
+			http.Error(w, "no filter "+strconv.Quote(name), http.StatusNotFound)
+			return
+		}
+		filters = map[string]*Filter{name: filt}
+	}
+	for _, filt := range filters {
+		filt.SetSourceLevel(source, lvl)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminFlush(log *Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	for _, filt := range log.load().filters {
+		filt.Flush()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminVerbosity(log *Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v, err := strconv.Atoi(r.FormValue("v"))
+	if err != nil {
+		http.Error(w, "bad v: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := r.Form["vmodule"]; ok {
+		if err := log.SetVModule(r.FormValue("vmodule")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	log.SetVerbosity(v)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminEnable(log *Logger, w http.ResponseWriter, r *http.Request, enable bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.FormValue("filter")
+	change := log.DisableFilter
+	if enable {
+		change = log.EnableFilter
+	}
+	if !change(name) {
+		http.Error(w, "no filter "+strconv.Quote(name), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminTail(log *Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := 100
+	if s := r.FormValue("n"); len(s) > 0 {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "bad n: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ring *RingLogWriter
+	filters := log.load().filters
+	if name := r.FormValue("filter"); len(name) > 0 {
+		if filt, ok := filters[name]; ok {
+			ring, _ = filt.LogWriter.(*RingLogWriter)
+		}
+	} else {
+		names := make([]string, 0, len(filters))
+		for name := range filters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if rw, ok := filters[name].LogWriter.(*RingLogWriter); ok {
+				ring = rw
+				break
+			}
+		}
+	}
+	if ring == nil {
+		http.Error(w, "no ring buffer filter", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range ring.Tail(n) {
+		fmt.Fprint(w, line)
+	}
+}
+
+func adminHealth(log *Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	failing := make(map[string]string)
+	for name, err := range log.Health() {
+		if err != nil {
+			failing[name] = err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(failing) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(failing)
+}
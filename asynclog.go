@@ -0,0 +1,177 @@
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy says what to do with a record when a queue is full.
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait until there is room
+	OverflowDropNewest                       // discard the record being written
+	OverflowDropOldest                       // discard the oldest queued record
+)
+
+var overflowStrings = [...]string{"block", "drop-newest", "drop-oldest"}
+
+func (p OverflowPolicy) String() string {
+	if p < 0 || int(p) >= len(overflowStrings) {
+		return "unknown"
+	}
+	return overflowStrings[p]
+}
+
+// Parse an overflow policy name as used in configuration files
+func parseOverflowPolicy(str string) (OverflowPolicy, bool) {
+	for i, s := range overflowStrings {
+		if s == str {
+			return OverflowPolicy(i), true
+		}
+	}
+	return OverflowBlock, false
+}
+
+// Put rec on queue according to policy, counting drops in dropped.  Blocking
+// gives up when done is closed.  Returns whether rec was queued.
+func enqueueWithPolicy(queue chan *LogRecord, done chan struct{}, rec *LogRecord, policy OverflowPolicy, dropped *uint64) bool {
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case queue <- rec:
+		default:
+			atomic.AddUint64(dropped, 1)
+			return false
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- rec:
+				return true
+			default:
+			}
+			select {
+			case <-queue:
+				atomic.AddUint64(dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- rec:
+		case <-done:
+			return false
+		}
+	}
+	return true
+}
+
+// This log writer puts records on its own queue and writes them to the
+// wrapped writer from one or more worker goroutines, so a slow output (DB,
+// HTTP) does not hold up the Filter it shares with faster ones.  With more
+// than one worker the wrapped writer must be safe for concurrent use.
+type AsyncLogWriter struct {
+	writer  LogWriter
+	policy  OverflowPolicy
+	rec     chan *LogRecord
+	dropped uint64
+	workers int
+
+	mu      sync.RWMutex // guards closing against sends on rec; held to flush
+	closing bool
+	parked  sync.WaitGroup // workers that took a flush marker
+	release chan struct{}  // closed once the flush is done
+	running sync.WaitGroup
+}
+
+// Queued by Flush, once for each worker
+var asyncFlushMarker = new(LogRecord)
+
+// This creates a new AsyncLogWriter around writer with a queue of queueSize
+// records drained by the given number of workers.
+func NewAsyncLogWriter(writer LogWriter, queueSize, workers int, policy OverflowPolicy) *AsyncLogWriter {
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	a := &AsyncLogWriter{
+		writer:  writer,
+		policy:  policy,
+		rec:     make(chan *LogRecord, queueSize),
+		workers: workers,
+	}
+
+	a.running.Add(workers)
+	for i := 0; i < workers; i++ {
+		go a.run()
+	}
+	return a
+}
+
+func (a *AsyncLogWriter) run() {
+	defer a.running.Done()
+	for rec := range a.rec {
+		if rec == asyncFlushMarker {
+			// Wait for the other workers to finish what they took before
+			// their markers, and for the flush
+			release := a.release
+			a.parked.Done()
+			<-release
+			continue
+		}
+		a.writer.LogWrite(rec)
+	}
+}
+
+// Dropped returns how many records were discarded by the overflow policy.
+func (a *AsyncLogWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+func (a *AsyncLogWriter) LogWrite(rec *LogRecord) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closing {
+		return
+	}
+	enqueueWithPolicy(a.rec, nil, rec, a.policy, &a.dropped)
+}
+
+// Flush waits until the records queued before it are written and then
+// flushes the wrapped writer.  It queues a marker for each worker, which
+// stops there until all have come to theirs; no record is queued meanwhile,
+// so the overflow policy cannot drop a marker.
+func (a *AsyncLogWriter) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closing {
+		return
+	}
+
+	a.release = make(chan struct{})
+	a.parked.Add(a.workers)
+	for i := 0; i < a.workers; i++ {
+		a.rec <- asyncFlushMarker
+	}
+	a.parked.Wait()
+	a.writer.Flush()
+	close(a.release)
+}
+
+// Close writes out everything still queued and closes the wrapped writer.
+func (a *AsyncLogWriter) Close() {
+	a.mu.Lock()
+	if a.closing {
+		a.mu.Unlock()
+		return
+	}
+	a.closing = true
+	close(a.rec)
+	a.mu.Unlock()
+
+	a.running.Wait()
+	a.writer.Close()
+}
@@ -0,0 +1,146 @@
+package log4go
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Audit logs end every record with the hash of the chain so far, where each
+// hash covers the previous one and the record text.  Every file starts with
+// the hash it continues from and, if a key is set, signed checkpoints are
+// written every few records and at the end of each file.
+const (
+	auditStart = "#chain start="
+	auditLink  = " #chain="
+	auditSign  = "#chain sign="
+)
+
+type auditChain struct {
+	key      []byte
+	every    int
+	last     [sha256.Size]byte
+	unsigned int // records since the last signature
+}
+
+// The first line of a new file
+func (a *auditChain) start() string {
+	return auditStart + hex.EncodeToString(a.last[:]) + "\n"
+}
+
+// Chain a formatted record, returning it with its hash appended
+func (a *auditChain) link(line string) string {
+	text := strings.TrimSuffix(line, "\n")
+	a.last = auditHash(a.last, text)
+	a.unsigned++
+
+	out := text + auditLink + hex.EncodeToString(a.last[:]) + "\n"
+	if a.every > 0 && a.unsigned >= a.every {
+		out += a.sign()
+	}
+	return out
+}
+
+// A signature line for the chain so far, or "" if there is nothing to sign
+func (a *auditChain) sign() string {
+	if a.key == nil || a.unsigned == 0 {
+		return ""
+	}
+	a.unsigned = 0
+	return auditSign + hex.EncodeToString(auditMAC(a.key, a.last)) + "\n"
+}
+
+func auditHash(prev [sha256.Size]byte, text string) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(prev[:])
+	io.WriteString(h, text)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func auditMAC(key []byte, sum [sha256.Size]byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(sum[:])
+	return m.Sum(nil)
+}
+
+// Turn on audit mode (chainable): every record carries a hash chaining it to
+// the previous one.  With a key, an HMAC of the chain is written every
+// signEvery records (if positive) and at the end of every file, so truncation
+// can be detected too.  Must be called before the first log message is
+// written.
+func (c *FileLogWriter) SetAudit(key []byte, signEvery int) *FileLogWriter {
+	c.audit = &auditChain{key: key, every: signEvery}
+	return c
+}
+
+// VerifyAuditLog checks one file written in audit mode and returns the number
+// of records verified.  If key is given, signatures are checked and the file
+// must end with one.
+func VerifyAuditLog(r io.Reader, key []byte) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last [sha256.Size]byte
+	count, lineno := 0, 0
+	started, signed := false, false
+	var pending []string // lines of a multi-line record
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineno++
+
+		switch {
+		case strings.HasPrefix(line, auditStart) && !started && len(pending) == 0:
+			b, err := hex.DecodeString(line[len(auditStart):])
+			if err != nil || len(b) != len(last) {
+				return count, fmt.Errorf("line %d: bad chain start", lineno)
+			}
+			copy(last[:], b)
+			started = true
+			continue
+		case !started:
+			return count, fmt.Errorf("line %d: missing chain start", lineno)
+		case strings.HasPrefix(line, auditSign) && len(pending) == 0:
+			if key != nil {
+				b, err := hex.DecodeString(line[len(auditSign):])
+				if err != nil || !hmac.Equal(b, auditMAC(key, last)) {
+					return count, fmt.Errorf("line %d: bad signature", lineno)
+				}
+			}
+			signed = true
+			continue
+		}
+
+		i := strings.LastIndex(line, auditLink)
+		if i < 0 {
+			pending = append(pending, line)
+			continue
+		}
+		text := strings.Join(append(pending, line[:i]), "\n")
+		pending = pending[:0]
+
+		want := auditHash(last, text)
+		if hex.EncodeToString(want[:]) != line[i+len(auditLink):] {
+			return count, fmt.Errorf("line %d: chain broken", lineno)
+		}
+		last = want
+		count++
+		signed = false
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+	if len(pending) > 0 {
+		return count, fmt.Errorf("line %d: record without chain hash", lineno)
+	}
+	if key != nil && !signed && count > 0 {
+		return count, fmt.Errorf("line %d: file does not end with a signature", lineno)
+	}
+	return count, nil
+}
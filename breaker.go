@@ -0,0 +1,141 @@
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Default number of failures in a row opening a circuit
+	BREAKER_THRESHOLD = 5
+
+	// Default time an open circuit waits before probing the writer again
+	BREAKER_COOLDOWN = 30 * time.Second
+)
+
+// Returned by CircuitBreakerLogWriter.LogWriteErr for records it does not
+// try to write because its circuit is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// The state of a CircuitBreakerLogWriter
+type BreakerState int32
+
+const (
+	BreakerClosed   BreakerState = iota // records are written
+	BreakerOpen                         // records are dropped without trying
+	BreakerHalfOpen                     // one record probes whether the writer works again
+)
+
+var breakerStateStrings = [...]string{"closed", "open", "half-open"}
+
+func (s BreakerState) String() string {
+	if s < 0 || int(s) >= len(breakerStateStrings) {
+		return "unknown"
+	}
+	return breakerStateStrings[s]
+}
+
+// BreakerStats describe a CircuitBreakerLogWriter.
+type BreakerStats struct {
+	State    BreakerState
+	Failures int    // failed writes in a row
+	Opened   uint64 // times the circuit opened
+	Rejected uint64 // records dropped while it was open
+}
+
+// This log writer stops calling a writer that keeps failing, so a dead sink
+// cannot slow every record down: after threshold failed writes in a row its
+// circuit opens and records are dropped, or with LogWriteErr refused with
+// ErrCircuitOpen, e.g. for a FailoverLogWriter to send them elsewhere.  Once
+// the cooldown has passed a record probes the writer, closing the circuit if
+// it is written.  Opening and closing are reported to the ErrorHandler.
+// Failures are only noticed if the writer implements ErrorLogWriter.
+type CircuitBreakerLogWriter struct {
+	writer    LogWriter
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	opened   uint64
+	rejected uint64
+}
+
+// This creates a new CircuitBreakerLogWriter around writer, with
+// BREAKER_THRESHOLD and BREAKER_COOLDOWN if threshold or cooldown are 0.
+func NewCircuitBreakerLogWriter(writer LogWriter, threshold int, cooldown time.Duration) *CircuitBreakerLogWriter {
+	if threshold <= 0 {
+		threshold = BREAKER_THRESHOLD
+	}
+	if cooldown <= 0 {
+		cooldown = BREAKER_COOLDOWN
+	}
+	return &CircuitBreakerLogWriter{
+		writer:    writer,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Stats returns the state of the circuit and its counters.
+func (b *CircuitBreakerLogWriter) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{
+		State:    b.state,
+		Failures: b.failures,
+		Opened:   b.opened,
+		Rejected: b.rejected,
+	}
+}
+
+func (b *CircuitBreakerLogWriter) LogWrite(rec *LogRecord) {
+	b.LogWriteErr(rec)
+}
+
+func (b *CircuitBreakerLogWriter) LogWriteErr(rec *LogRecord) error {
+	b.mu.Lock()
+	switch {
+	case b.state == BreakerOpen && clockNow().Sub(b.openedAt) >= b.cooldown:
+		b.state = BreakerHalfOpen
+	case b.state != BreakerClosed:
+		// Open, or half-open with the probe under way
+		b.rejected++
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	b.mu.Unlock()
+
+	err := logWriteErr(b.writer, rec)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state == BreakerHalfOpen {
+			reportError("CircuitBreakerLogWriter", errors.New("writer recovered, circuit closed"))
+		}
+		b.state, b.failures = BreakerClosed, 0
+		return nil
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state == BreakerClosed {
+			b.opened++
+			reportError("CircuitBreakerLogWriter", fmt.Errorf("%d failures in a row, circuit opened: %v", b.failures, err))
+		}
+		b.state, b.openedAt = BreakerOpen, clockNow()
+	}
+	return err
+}
+
+func (b *CircuitBreakerLogWriter) Close() {
+	b.writer.Close()
+}
+
+func (b *CircuitBreakerLogWriter) Flush() {
+	b.writer.Flush()
+}
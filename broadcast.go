@@ -0,0 +1,82 @@
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// This log writer hands every record to any number of subscribers, e.g. the
+// clients of TailHandler.  A subscriber that falls behind misses records
+// rather than holding up the filter.
+type BroadcastLogWriter struct {
+	mu      sync.Mutex
+	subs    map[chan *LogRecord]Level // lowest level each one gets
+	closed  bool
+	dropped uint64
+}
+
+// This creates a new BroadcastLogWriter without subscribers.
+func NewBroadcastLogWriter() *BroadcastLogWriter {
+	return &BroadcastLogWriter{subs: make(map[chan *LogRecord]Level)}
+}
+
+// Subscribe returns a channel getting the records written from now on,
+// buffering up to buffer of them, and a function ending the subscription.
+// The channel is closed when the subscription ends or the writer is closed.
+func (b *BroadcastLogWriter) Subscribe(buffer int) (<-chan *LogRecord, func()) {
+	return b.subscribe(buffer, DEBUG)
+}
+
+// Like Subscribe, but only for the records at lvl or above
+func (b *BroadcastLogWriter) subscribe(buffer int, lvl Level) (<-chan *LogRecord, func()) {
+	ch := make(chan *LogRecord, buffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = lvl
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Dropped returns how many records subscribers missed by falling behind.
+func (b *BroadcastLogWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+func (b *BroadcastLogWriter) LogWrite(rec *LogRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch, lvl := range b.subs {
+		if rec.Level < lvl {
+			continue
+		}
+		select {
+		case ch <- rec:
+		default:
+			atomic.AddUint64(&b.dropped, 1)
+		}
+	}
+}
+
+func (b *BroadcastLogWriter) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *BroadcastLogWriter) Flush() {
+}
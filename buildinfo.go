@@ -0,0 +1,66 @@
+package log4go
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// The fields BuildMetadata sets
+const (
+	MODULE_FIELD     = "module"
+	VERSION_FIELD    = "version"
+	REVISION_FIELD   = "revision"
+	BUILD_TIME_FIELD = "build_time"
+	MODIFIED_FIELD   = "modified"
+)
+
+var (
+	buildMetadataOnce sync.Once
+	buildMetadataVal  Fields
+)
+
+// BuildMetadata returns what the program was built from, as far as the Go
+// toolchain recorded it: the main module's path and version and the VCS
+// revision and commit time, and whether the tree had local changes.  Stamp
+// it on every record with
+//
+//	log.Use(log4go.EnrichMiddleware(log4go.BuildMetadata()))
+//
+// or log it once with LogBuildInfo.  The returned Fields must not be changed.
+func BuildMetadata() Fields {
+	buildMetadataOnce.Do(func() {
+		info, _ := debug.ReadBuildInfo()
+		buildMetadataVal = buildMetadata(info)
+	})
+	return buildMetadataVal
+}
+
+func buildMetadata(info *debug.BuildInfo) Fields {
+	fields := make(Fields)
+	if info == nil {
+		return fields
+	}
+	if len(info.Main.Path) > 0 {
+		fields[MODULE_FIELD] = info.Main.Path
+	}
+	if len(info.Main.Version) > 0 {
+		fields[VERSION_FIELD] = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			fields[REVISION_FIELD] = s.Value
+		case "vcs.time":
+			fields[BUILD_TIME_FIELD] = s.Value
+		case "vcs.modified":
+			fields[MODIFIED_FIELD] = s.Value == "true"
+		}
+	}
+	return fields
+}
+
+// LogBuildInfo writes a "logger started" record at INFO carrying
+// BuildMetadata, e.g. right after loading the configuration.
+func (log *Logger) LogBuildInfo() {
+	log.intLog(2, INFO, BuildMetadata(), "logger started")
+}
@@ -0,0 +1,41 @@
+package log4go
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Look up a character set by its name or an alias, e.g. GBK, Shift_JIS or
+// EUC-KR
+func parseCharset(name string) (encoding.Encoding, error) {
+	return htmlindex.Get(name)
+}
+
+// Convert the UTF-8 text s to cs, replacing characters cs lacks, or return
+// it as it is if cs is nil
+func transcode(cs encoding.Encoding, s string) string {
+	if cs == nil {
+		return s
+	}
+	out, err := encoding.ReplaceUnsupported(cs.NewEncoder()).String(s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// Write files in the character set cs instead of UTF-8, e.g. for legacy
+// systems reading GBK or Shift_JIS (chainable); see
+// golang.org/x/text/encoding for the sets.  Must be called before the first
+// log message is written.
+func (c *FileLogWriter) SetCharset(cs encoding.Encoding) *FileLogWriter {
+	c.charset = cs
+	return c
+}
+
+// Write to the console in the character set cs instead of UTF-8
+// (chainable).  Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetCharset(cs encoding.Encoding) *ConsoleLogWriter {
+	c.charset = cs
+	return c
+}
@@ -0,0 +1,91 @@
+package log4go
+
+// With returns a child logger that writes to the same filters as log but
+// adds fields to every record.  Fields given with the record itself win over
+// the child's.  Filters, hooks and middleware changed through a child are
+// changed for the parent too, and closing a child closes the parent.
+func (log *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(log.fields)+len(fields))
+	for k, v := range log.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{root: log.rootLogger(), name: log.name, fields: merged, tag: log.tag}
+}
+
+// Named returns a child logger like With, but stamping its records with a
+// name, e.g. the subsystem logging them, shown by the %N format.  Naming a
+// named child appends to its name after a dot.
+func (log *Logger) Named(name string) *Logger {
+	if len(log.name) > 0 {
+		name = log.name + "." + name
+	}
+	return &Logger{root: log.rootLogger(), name: name, fields: log.fields, tag: log.tag}
+}
+
+// Tag returns a child logger like With, but tagging its records, e.g. "db".
+// A tagged record goes only to the filters whose tag patterns match it (see
+// Filter.AddTag) or, if none do, to the filter named like the tag.  Without
+// either it is written like an untagged record.
+//
+//	log.Tag("db").Info("slow query: %s", q)
+func (log *Logger) Tag(tag string) *Logger {
+	return &Logger{root: log.rootLogger(), name: log.name, fields: log.fields, tag: tag}
+}
+
+// Name returns the name given to the logger with Named.
+func (log *Logger) Name() string {
+	return log.name
+}
+
+func (log *Logger) rootLogger() *Logger {
+	if log.root != nil {
+		return log.root
+	}
+	return log
+}
+
+// SetGlobalFields makes every record the logger and its children dispatch
+// carry fields, e.g. the service name, version and environment, replacing
+// those set before (chainable).  Fields given with a record or a child
+// logger win over them.
+func (log *Logger) SetGlobalFields(fields map[string]interface{}) *Logger {
+	copied := make(Fields, len(fields))
+	for k, v := range fields {
+		copied[k] = v
+	}
+	log.update(false, func(st *loggerState) {
+		st.fields = copied
+	})
+	return log
+}
+
+// Return fields with the defaults added that it does not have
+func mergeFields(defaults, fields Fields) Fields {
+	if len(fields) == 0 {
+		return defaults
+	}
+	merged := make(Fields, len(defaults)+len(fields))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Add the child's name and fields to a record
+func (log *Logger) stamp(rec *LogRecord) {
+	if len(rec.Name) == 0 {
+		rec.Name = log.name
+	}
+	if len(rec.Tag) == 0 {
+		rec.Tag = log.tag
+	}
+	if len(log.fields) > 0 {
+		rec.Fields = mergeFields(log.fields, rec.Fields)
+	}
+}
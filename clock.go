@@ -0,0 +1,74 @@
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Clock tells log4go the time: when records are created, what files are
+// named and when rate limits, sampling and failover probes expire.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var currentClock atomic.Value // clockHolder
+
+// atomic.Value needs one concrete type
+type clockHolder struct {
+	Clock
+}
+
+// Use c instead of the system clock, e.g. a FakeClock in tests; nil
+// restores the system clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	currentClock.Store(clockHolder{c})
+}
+
+// The current time by the installed Clock
+func clockNow() time.Time {
+	if h, ok := currentClock.Load().(clockHolder); ok {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// A FakeClock only moves when told to.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// This creates a new FakeClock showing t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Set the time shown.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+// Move the time shown on by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
@@ -0,0 +1,61 @@
+// Command log4go-check validates log4go configuration files the way
+// LoadConfig loads them, without creating any file or connection, and
+// prints every problem found, e.g. in CI or before a deploy.
+//
+// It exits with 0 if all files are usable, 1 if any is not (or, with
+// -strict, has warnings such as unknown properties) and 2 on bad usage.
+//
+// Usage:
+//
+//	log4go-check logging.xml
+//	log4go-check -strict config/*.toml
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/goldenspider/log4go"
+)
+
+func main() {
+	strict := flag.Bool("strict", false, "fail on warnings too")
+	quiet := flag.Bool("q", false, "print nothing for usable files")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: log4go-check [-strict] [-q] config ...")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, name := range flag.Args() {
+		err := log4go.CheckConfig(name)
+		var cerr *log4go.ConfigError
+		switch {
+		case err == nil:
+			if !*quiet {
+				fmt.Printf("%s: ok\n", name)
+			}
+			continue
+		case !errors.As(err, &cerr):
+			fmt.Printf("%s: Error: %s\n", name, err)
+			status = 1
+			continue
+		}
+
+		for _, msg := range cerr.Errors {
+			fmt.Printf("%s: %s\n", name, msg)
+		}
+		for _, msg := range cerr.Warnings {
+			fmt.Printf("%s: %s\n", name, msg)
+		}
+		if len(cerr.Errors) > 0 || *strict {
+			status = 1
+		} else if !*quiet {
+			fmt.Printf("%s: ok, with warnings\n", name)
+		}
+	}
+	os.Exit(status)
+}
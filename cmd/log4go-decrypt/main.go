@@ -0,0 +1,60 @@
+// Command log4go-decrypt prints the plain text of log files written by an
+// encrypting FileLogWriter.
+//
+// Usage:
+//
+//	log4go-decrypt -keyfile log.key app-20160314160255-814856400.log ...
+//	LOG_KEY=... log4go-decrypt -keyenv LOG_KEY < app.log
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/goldenspider/log4go"
+)
+
+func main() {
+	keyfile := flag.String("keyfile", "", "file holding the raw or hex encoded AES key")
+	keyenv := flag.String("keyenv", "", "environment variable holding the hex encoded AES key")
+	flag.Parse()
+
+	var keyfn log4go.KeyFunc
+	switch {
+	case len(*keyfile) > 0:
+		keyfn = log4go.KeyFromFile(*keyfile)
+	case len(*keyenv) > 0:
+		keyfn = log4go.KeyFromEnv(*keyenv)
+	default:
+		fmt.Fprintln(os.Stderr, "log4go-decrypt: one of -keyfile or -keyenv is required")
+		os.Exit(2)
+	}
+	key, err := keyfn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "log4go-decrypt: %s\n", err)
+		os.Exit(1)
+	}
+
+	if flag.NArg() == 0 {
+		decrypt("<stdin>", os.Stdin, key)
+		return
+	}
+	for _, name := range flag.Args() {
+		fd, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log4go-decrypt: %s\n", err)
+			os.Exit(1)
+		}
+		decrypt(name, fd, key)
+		fd.Close()
+	}
+}
+
+func decrypt(name string, r io.Reader, key []byte) {
+	if err := log4go.DecryptLog(os.Stdout, r, key); err != nil {
+		fmt.Fprintf(os.Stderr, "log4go-decrypt: %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,203 @@
+// Command log4go-grep prints the records of log files that match all the
+// conditions given.  It reads the files a FileLogWriter writes with a format
+// string, or with -json those written with the json encoding, and rotated
+// files compressed with gzip.  Lines the format did not write, such as those
+// of multi-line messages, belong to the record before them.
+//
+// Usage:
+//
+//	log4go-grep -level WARNING -since '2024/03/14 16:00:00' logs/app-*.log*
+//	log4go-grep -json -field user=bob -e 'timeout|refused' app.json.gz
+//	log4go-grep -format '[%D %T] [%L] (%S) %M' -source db.go < app.log
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/goldenspider/log4go"
+)
+
+// A flag that may be given more than once
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ",") }
+func (m *multiFlag) Set(s string) error { *m = append(*m, s); return nil }
+
+var (
+	format  = flag.String("format", log4go.FORMAT_DEFAULT, "format string the files were written with")
+	jsonFmt = flag.Bool("json", false, "the files hold JSON records, one per line")
+	level   = flag.String("level", "", "only records at this level or above")
+	since   = flag.String("since", "", "only records created at or after this time")
+	until   = flag.String("until", "", "only records created before this time")
+	source  = flag.String("source", "", "only records whose source contains this")
+	expr    = flag.String("e", "", "only records whose message matches this regular expression")
+	fields  multiFlag
+)
+
+// Layouts accepted by -since and -until, in the local time zone unless they
+// name one
+var timeLayouts = []string{time.RFC3339Nano, "2006/01/02 15:04:05", "2006/01/02 15:04", "2006/01/02", "2006-01-02 15:04:05", "2006-01-02"}
+
+// The conditions a record must meet
+type query struct {
+	level        log4go.Level
+	since, until time.Time
+	source       string
+	message      *regexp.Regexp
+	fields       map[string]string
+}
+
+func main() {
+	flag.Var(&fields, "field", "only records with this key=value field (repeatable)")
+	flag.Parse()
+
+	q := query{level: log4go.DEBUG, source: *source, fields: make(map[string]string)}
+	var err error
+	if len(*level) > 0 {
+		var ok bool
+		if q.level, ok = log4go.ParseLevel(*level); !ok {
+			fatalf("unknown level %q", *level)
+		}
+	}
+	if q.since, err = parseTime(*since); err != nil {
+		fatalf("bad -since: %s", err)
+	}
+	if q.until, err = parseTime(*until); err != nil {
+		fatalf("bad -until: %s", err)
+	}
+	if len(*expr) > 0 {
+		if q.message, err = regexp.Compile(*expr); err != nil {
+			fatalf("bad -e: %s", err)
+		}
+	}
+	for _, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			fatalf("bad -field %q: expected key=value", f)
+		}
+		q.fields[kv[0]] = kv[1]
+	}
+
+	parse := parseJSON
+	if !*jsonFmt {
+		p, err := log4go.NewLineParser(*format)
+		if err != nil {
+			fatalf("bad -format: %s", err)
+		}
+		parse = p.Parse
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	matched := false
+	if flag.NArg() == 0 {
+		matched = grep(out, os.Stdin, parse, q)
+	}
+	for _, name := range flag.Args() {
+		fd, err := os.Open(name)
+		if err != nil {
+			out.Flush()
+			fatalf("%s", err)
+		}
+		if grep(out, fd, parse, q) {
+			matched = true
+		}
+		fd.Close()
+	}
+	if !matched {
+		out.Flush()
+		os.Exit(1)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "log4go-grep: "+format+"\n", args...)
+	os.Exit(2)
+}
+
+func parseJSON(line string) (*log4go.LogRecord, error) {
+	rec := new(log4go.LogRecord)
+	if err := json.Unmarshal([]byte(line), rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Print the records of r matching q, with the lines continuing them; reports
+// whether there were any
+func grep(out io.Writer, r io.Reader, parse func(string) (*log4go.LogRecord, error), q query) bool {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	sc := bufio.NewScanner(br)
+	sc.Buffer(nil, 16*1024*1024)
+	matched, printing := false, false
+	for sc.Scan() {
+		line := sc.Text()
+		if rec, err := parse(line); err == nil {
+			printing = q.match(rec)
+			matched = matched || printing
+		}
+		if printing {
+			fmt.Fprintln(out, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		fatalf("%s", err)
+	}
+	return matched
+}
+
+func (q query) match(rec *log4go.LogRecord) bool {
+	if rec.Level < q.level {
+		return false
+	}
+	if !q.since.IsZero() && rec.Created.Before(q.since) {
+		return false
+	}
+	if !q.until.IsZero() && !rec.Created.Before(q.until) {
+		return false
+	}
+	if len(q.source) > 0 && !strings.Contains(rec.Source, q.source) {
+		return false
+	}
+	if q.message != nil && !q.message.MatchString(rec.Message) {
+		return false
+	}
+	for k, want := range q.fields {
+		v, ok := rec.Fields[k]
+		if !ok || fmt.Sprint(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time %q", s)
+}
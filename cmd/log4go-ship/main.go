@@ -0,0 +1,388 @@
+// Command log4go-ship follows the files a FileLogWriter writes, moving on to
+// the next file when it rotates, and forwards each line to a socket or an
+// HTTP endpoint as a log record, for programs that cannot link the network
+// writers in.
+//
+// Lines holding a JSON record, as written with the json encoding, are sent
+// as they are.  Lines written with the -format of the files are read back
+// into records, and the lines after one that the format did not write, such
+// as a stack trace, continue its message.  Other lines become records with
+// the line as the message and the level found in it in brackets, or the
+// -level given.  A record that cannot be sent is retried until it is.
+//
+// JSON records on stream sockets end with a newline unless -framing says
+// otherwise; protobuf and msgpack records are not framed by default, since
+// a newline cannot mark the end of binary records.  Giving -ca, -cert or
+// -key connects to -addr with TLS as -tls does.
+//
+// Usage:
+//
+//	log4go-ship -addr logs.example.com:5140 -encoding protobuf 'logs/app-*.log'
+//	log4go-ship -proto udp -addr 127.0.0.1:12124 -from-start logs/app.log
+//	log4go-ship -url https://logs.example.com/ingest -cert client.pem -key client.key logs/app.log
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/goldenspider/log4go"
+)
+
+var (
+	proto     = flag.String("proto", "tcp", "network of the socket: tcp, udp, unix or unixgram")
+	addr      = flag.String("addr", "", "address of the socket to send the records to")
+	url       = flag.String("url", "", "URL to POST the records to instead of a socket")
+	encoding  = flag.String("encoding", "json", "record encoding: json, protobuf or msgpack")
+	framing   = flag.String("framing", "", "framing on stream sockets: none, newline, length or octet (default newline for json, none otherwise)")
+	useTLS    = flag.Bool("tls", false, "connect to -addr with TLS, implied by -ca, -cert and -key")
+	ca        = flag.String("ca", "", "PEM file of the CA certificates to trust")
+	cert      = flag.String("cert", "", "PEM file of the client certificate for mutual TLS")
+	key       = flag.String("key", "", "PEM file of the key of -cert")
+	format    = flag.String("format", log4go.FORMAT_DEFAULT, "format string the files were written with")
+	level     = flag.String("level", "INFO", "level of lines naming none")
+	poll      = flag.Duration("poll", time.Second, "how often to look for new lines and files")
+	fromStart = flag.Bool("from-start", false, "send the lines already in the files, not just new ones")
+)
+
+func main() {
+	flag.Parse()
+	if len(*addr) == 0 && len(*url) == 0 || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: log4go-ship -addr host:port | -url URL [flags] pattern ...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	lvl, ok := log4go.ParseLevel(*level)
+	if !ok {
+		fatalf("unknown level %q", *level)
+	}
+	parser, err := log4go.NewLineParser(*format)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	w, err := newWriter()
+	if err != nil {
+		fatalf("%s", err)
+	}
+	defer w.Close()
+
+	var followers []*follower
+	for _, pattern := range flag.Args() {
+		followers = append(followers, &follower{pattern: pattern, level: lvl, parser: parser, send: w.LogWriteErr})
+	}
+	for _, f := range followers {
+		f.start(*fromStart)
+	}
+	for {
+		for _, f := range followers {
+			f.poll()
+		}
+		time.Sleep(*poll)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "log4go-ship: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// Where the records go
+type writer interface {
+	LogWriteErr(rec *log4go.LogRecord) error
+	Close()
+}
+
+// The writer the flags ask for
+func newWriter() (writer, error) {
+	if len(*addr) > 0 && len(*url) > 0 {
+		return nil, errors.New("-addr and -url cannot both be given")
+	}
+
+	var enc log4go.Encoder
+	switch *encoding {
+	case "json":
+	case "protobuf":
+		enc = log4go.ProtobufEncoder{}
+	case "msgpack":
+		enc = log4go.MsgpackEncoder{}
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", *encoding)
+	}
+
+	// Asking for a CA or client certificate asks for TLS
+	var cfg *tls.Config
+	if *useTLS || len(*ca) > 0 || len(*cert) > 0 || len(*key) > 0 {
+		var err error
+		if cfg, err = log4go.LoadTLSConfig(*ca, *cert, *key); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(*url) > 0 {
+		if len(*framing) > 0 {
+			return nil, errors.New("-framing applies to sockets only")
+		}
+		w := log4go.NewHTTPLogWriter(*url)
+		if enc != nil {
+			w.SetEncoder(enc)
+		}
+		if cfg != nil {
+			w.SetTLS(cfg)
+		}
+		return w, nil
+	}
+
+	w := log4go.NewSocketLogWriter(*proto, *addr)
+	if enc != nil {
+		w.SetEncoder(enc)
+	}
+	switch *framing {
+	case "":
+		if enc == nil {
+			w.SetFraming(log4go.FramingNewline)
+		}
+	case "none":
+	case "newline":
+		if enc != nil {
+			return nil, fmt.Errorf("-framing newline cannot delimit %s records", *encoding)
+		}
+		w.SetFraming(log4go.FramingNewline)
+	case "length":
+		w.SetFraming(log4go.FramingLength)
+	case "octet":
+		w.SetFraming(log4go.FramingOctet)
+	default:
+		return nil, fmt.Errorf("unknown framing %q", *framing)
+	}
+	if cfg != nil {
+		w.SetTLS(cfg)
+	}
+	return w, nil
+}
+
+// Follows the files matching a pattern, from the oldest to the newest
+type follower struct {
+	pattern string
+	level   log4go.Level
+	parser  *log4go.LineParser // of the lines starting a record, if set
+	send    func(*log4go.LogRecord) error
+
+	name    string
+	info    os.FileInfo // of the current file when last looked at
+	fd      *os.File
+	off     int64
+	partial []byte
+	pending *log4go.LogRecord // which the next lines may continue
+	more    bool              // whether a line continued pending since the last poll
+}
+
+// A file matching the pattern
+type file struct {
+	name string
+	info os.FileInfo
+}
+
+// The files matching the pattern, by modification time then name
+func (f *follower) files() []file {
+	names, _ := filepath.Glob(f.pattern)
+	var files []file
+	for _, name := range names {
+		if fi, err := os.Stat(name); err == nil && fi.Mode().IsRegular() {
+			files = append(files, file{name, fi})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		mi, mj := files[i].info.ModTime(), files[j].info.ModTime()
+		if !mi.Equal(mj) {
+			return mi.Before(mj)
+		}
+		return files[i].name < files[j].name
+	})
+	return files
+}
+
+// Whether next comes after the current file, i.e. was created since
+func (f *follower) after(next file) bool {
+	if os.SameFile(f.info, next.info) {
+		return false
+	}
+	cur, mod := f.info.ModTime(), next.info.ModTime()
+	return mod.After(cur) || mod.Equal(cur) && next.name >= f.name
+}
+
+// Open the oldest file if fromStart, or else the newest at its end
+func (f *follower) start(fromStart bool) {
+	files := f.files()
+	if len(files) == 0 {
+		return
+	}
+	if fromStart {
+		f.open(files[0])
+		return
+	}
+	f.open(files[len(files)-1])
+	if f.fd != nil {
+		f.off, _ = f.fd.Seek(0, io.SeekEnd)
+	}
+}
+
+func (f *follower) open(next file) {
+	f.name, f.info, f.fd, f.off, f.partial = next.name, next.info, nil, 0, nil
+	fd, err := os.Open(next.name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "log4go-ship: %s\n", err)
+		return
+	}
+	f.fd = fd
+}
+
+// Send what was added since the last poll, starting over if the file was
+// truncated, then go through every file created since in order, as the
+// writer may have rotated more than once between polls
+func (f *follower) poll() {
+	if f.info == nil {
+		f.start(true)
+		if f.info == nil {
+			return
+		}
+	}
+	if f.fd != nil {
+		f.read()
+		if fi, err := f.fd.Stat(); err == nil {
+			if fi.Size() < f.off {
+				f.fd.Seek(0, io.SeekStart)
+				f.off, f.partial = 0, nil
+				f.read()
+			}
+			f.info = fi
+		}
+	}
+
+	for _, next := range f.files() {
+		if !f.after(next) {
+			continue
+		}
+		// Rotated: what is left of the current file was just read
+		if len(f.partial) > 0 {
+			f.line(f.partial)
+		}
+		if f.fd != nil {
+			f.fd.Close()
+		}
+		f.flush()
+		f.open(next)
+		if f.fd != nil {
+			f.read()
+		}
+	}
+
+	// A record whose lines stopped coming is complete
+	if !f.more {
+		f.flush()
+	}
+	f.more = false
+}
+
+// Send the complete lines up to the end of the file
+func (f *follower) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.fd.Read(buf)
+		f.off += int64(n)
+		data := append(f.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			f.line(data[:i])
+			data = data[i+1:]
+		}
+		f.partial = append([]byte(nil), data...)
+		if err != nil || n == 0 {
+			return
+		}
+	}
+}
+
+// Send the records of a line, keeping one the format wrote pending until
+// the lines continuing it have been read
+func (f *follower) line(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	if line[0] == '{' {
+		var rec log4go.LogRecord
+		if json.Unmarshal(line, &rec) == nil && !rec.Created.IsZero() {
+			f.flush()
+			f.ship(&rec)
+			return
+		}
+	}
+	if f.parser != nil {
+		if rec, err := f.parser.Parse(string(line)); err == nil {
+			f.flush()
+			if rec.Created.IsZero() {
+				rec.Created = time.Now()
+			}
+			if len(rec.Source) == 0 {
+				rec.Source = f.name
+			}
+			f.pending, f.more = rec, true
+			return
+		}
+	}
+	if f.pending != nil {
+		f.pending.Message += "\n" + string(line)
+		f.more = true
+		return
+	}
+	f.ship(f.record(line))
+}
+
+// Send the pending record, if any
+func (f *follower) flush() {
+	if f.pending != nil {
+		f.ship(f.pending)
+		f.pending = nil
+	}
+}
+
+// Send a record, retrying until it goes through
+func (f *follower) ship(rec *log4go.LogRecord) {
+	for {
+		err := f.send(rec)
+		if err == nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "log4go-ship: %s\n", err)
+		time.Sleep(*poll)
+	}
+}
+
+// The record of a line no format wrote
+func (f *follower) record(line []byte) *log4go.LogRecord {
+	rec := &log4go.LogRecord{
+		Level:   f.level,
+		Created: time.Now(),
+		Source:  f.name,
+		Message: string(line),
+	}
+	for lvl := log4go.DEBUG; lvl <= log4go.CRITICAL; lvl++ {
+		if bytes.Contains(line, []byte("["+lvl.String()+"]")) {
+			rec.Level = lvl
+			break
+		}
+	}
+	return rec
+}
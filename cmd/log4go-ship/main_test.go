@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goldenspider/log4go"
+	"github.com/goldenspider/log4go/collector"
+)
+
+// Passes the records it is given on to a channel
+type chanLogWriter chan *log4go.LogRecord
+
+func (c chanLogWriter) LogWrite(rec *log4go.LogRecord) { c <- rec }
+func (c chanLogWriter) Close()                         {}
+func (c chanLogWriter) Flush()                         {}
+
+func receive(t *testing.T, what string, recs chanLogWriter) *log4go.LogRecord {
+	t.Helper()
+	select {
+	case rec := <-recs:
+		return rec
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: no record received", what)
+	}
+	return nil
+}
+
+// Set the flags newWriter reads until the test ends
+func setFlags(t *testing.T, values map[string]string) {
+	for name, value := range values {
+		old := flag.Lookup(name).Value.String()
+		if err := flag.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+		name := name
+		t.Cleanup(func() { flag.Set(name, old) })
+	}
+}
+
+func writeFile(t *testing.T, name, data string, mod time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, name, data string) {
+	t.Helper()
+	fd, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString(data)
+	fd.Close()
+}
+
+// Records the messages the follower sends
+func newTestFollower(pattern string) (*follower, *[]string) {
+	var msgs []string
+	f := &follower{pattern: pattern, level: log4go.INFO, send: func(rec *log4go.LogRecord) error {
+		msgs = append(msgs, filepath.Base(rec.Source)+":"+rec.Message)
+		return nil
+	}}
+	return f, &msgs
+}
+
+func checkMessages(t *testing.T, what string, msgs *[]string, want ...string) {
+	t.Helper()
+	if strings.Join(*msgs, ",") != strings.Join(want, ",") {
+		t.Errorf("%s: sent %q, expected %q", what, *msgs, want)
+	}
+	*msgs = nil
+}
+
+func TestFollowRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pattern := filepath.Join(dir, "app-*.log")
+	base := time.Now().Add(-time.Hour)
+
+	writeFile(t, filepath.Join(dir, "app-1.log"), "a1\n", base)
+	f, msgs := newTestFollower(pattern)
+	f.start(true)
+	f.poll()
+	checkMessages(t, "first poll", msgs, "app-1.log:a1")
+
+	// Rotated twice between polls, the old file ending without a newline
+	appendFile(t, filepath.Join(dir, "app-1.log"), "a2\na3")
+	os.Chtimes(filepath.Join(dir, "app-1.log"), base.Add(time.Second), base.Add(time.Second))
+	writeFile(t, filepath.Join(dir, "app-3.log"), "c1\nc2", base.Add(3*time.Second))
+	writeFile(t, filepath.Join(dir, "app-2.log"), "b1\n", base.Add(2*time.Second))
+	f.poll()
+	checkMessages(t, "rotated", msgs, "app-1.log:a2", "app-1.log:a3", "app-2.log:b1", "app-3.log:c1")
+
+	appendFile(t, filepath.Join(dir, "app-3.log"), "\nc3\n")
+	f.poll()
+	checkMessages(t, "appended", msgs, "app-3.log:c2", "app-3.log:c3")
+
+	// Truncated: start over
+	writeFile(t, filepath.Join(dir, "app-3.log"), "d1\n", time.Now())
+	f.poll()
+	checkMessages(t, "truncated", msgs, "app-3.log:d1")
+	f.poll()
+	checkMessages(t, "idle", msgs)
+
+	// Without -from-start only what the newest file gets from now on is sent
+	g, msgs := newTestFollower(pattern)
+	g.start(false)
+	g.poll()
+	checkMessages(t, "at the end", msgs)
+	appendFile(t, filepath.Join(dir, "app-3.log"), "d2\n")
+	g.poll()
+	checkMessages(t, "at the end", msgs, "app-3.log:d2")
+
+	// A file replacing the current one under the same name is new
+	h, msgs := newTestFollower(filepath.Join(dir, "app.log"))
+	writeFile(t, filepath.Join(dir, "app.log"), "e1\n", base)
+	h.start(true)
+	h.poll()
+	os.Rename(filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.1"))
+	writeFile(t, filepath.Join(dir, "app.log"), "f1\n", base.Add(time.Second))
+	h.poll()
+	checkMessages(t, "replaced", msgs, "app.log:e1", "app.log:f1")
+}
+
+// The default framing of each encoding is one the collector decodes
+func TestCollectorRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+	writeFile(t, name, "[2024/03/14 16:02:55 UTC] [EROR] (db.go:40) query failed\n\tat db.go:41\n\tat main.go:7\n"+
+		"[2024/03/14 16:02:56 UTC] [INFO] (main.go:9) done\n", time.Now())
+	parser, _ := log4go.NewLineParser(log4go.FORMAT_DEFAULT)
+
+	for encoding, framing := range map[string]log4go.Framing{"json": log4go.FramingNewline, "protobuf": log4go.FramingNone} {
+		recs := make(chanLogWriter, 4)
+		log := log4go.NewLogger().SetFilter("recv", log4go.NewFilter(log4go.DEBUG, recs))
+		srv := collector.New(log, map[string]collector.Encoding{"json": collector.JSON, "protobuf": collector.Protobuf}[encoding]).SetFraming(framing)
+		if err := srv.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		setFlags(t, map[string]string{"addr": srv.Addrs()[0].String(), "encoding": encoding})
+		w, err := newWriter()
+		if err != nil {
+			t.Fatalf("%s: newWriter: %s", encoding, err)
+		}
+
+		f := &follower{pattern: name, level: log4go.INFO, parser: parser, send: w.LogWriteErr}
+		f.start(true)
+		f.poll()
+		if rec := receive(t, encoding, recs); rec.Level != log4go.ERROR || rec.Source != "db.go:40" || rec.Message != "query failed\n\tat db.go:41\n\tat main.go:7" {
+			t.Errorf("%s: got %+v", encoding, rec)
+		}
+		// The last record is sent once no more lines continue it
+		f.poll()
+		if rec := receive(t, encoding, recs); rec.Level != log4go.INFO || rec.Message != "done" {
+			t.Errorf("%s: got %+v", encoding, rec)
+		}
+		f.fd.Close()
+		w.Close()
+		srv.Close()
+		log.Close()
+	}
+}
+
+func TestWriterFlags(t *testing.T) {
+	for _, flags := range []map[string]string{
+		{"addr": "127.0.0.1:1", "encoding": "protobuf", "framing": "newline"},
+		{"addr": "127.0.0.1:1", "encoding": "msgpack", "framing": "newline"},
+		{"addr": "127.0.0.1:1", "url": "http://127.0.0.1:1/"},
+		{"url": "http://127.0.0.1:1/", "framing": "length"},
+		{"addr": "127.0.0.1:1", "encoding": "xml"},
+		{"addr": "127.0.0.1:1", "framing": "lines"},
+		{"addr": "127.0.0.1:1", "tls": "true", "cert": "missing.pem", "key": "missing.key"},
+	} {
+		t.Run("", func(t *testing.T) {
+			setFlags(t, flags)
+			if _, err := newWriter(); err == nil {
+				t.Errorf("newWriter: no error for %v", flags)
+			}
+		})
+	}
+}
+
+// Continuation lines join the record before them, even across polls
+func TestMultiLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+	writeFile(t, name, "stray line\n[2024/03/14 16:02:55 UTC] [CRIT] (main.go:3) panic: boom\ngoroutine 1 [running]:\n", time.Now())
+
+	f, msgs := newTestFollower(name)
+	f.parser, _ = log4go.NewLineParser(log4go.FORMAT_DEFAULT)
+	f.start(true)
+	f.poll()
+	checkMessages(t, "first poll", msgs, "app.log:stray line")
+	appendFile(t, name, "main.main()\n")
+	f.poll()
+	checkMessages(t, "continued", msgs)
+	f.poll()
+	checkMessages(t, "ended", msgs, "main.go:3:panic: boom\ngoroutine 1 [running]:\nmain.main()")
+
+	// Rotating ends the record
+	appendFile(t, name, "[2024/03/14 16:02:56 UTC] [INFO] (main.go:4) restarted\n")
+	f.poll()
+	os.Rename(name, name+".1")
+	writeFile(t, name, "", time.Now().Add(time.Second))
+	f.poll()
+	checkMessages(t, "rotated", msgs, "main.go:4:restarted")
+}
+
+// Giving a CA connects with TLS even without -tls
+func TestImpliedTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "log4go-ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	setFlags(t, map[string]string{"addr": ln.Addr().String(), "ca": ca})
+	w, err := newWriter()
+	if err != nil {
+		t.Fatalf("newWriter: %s", err)
+	}
+	defer w.Close()
+	if err := w.LogWriteErr(&log4go.LogRecord{Level: log4go.INFO, Created: time.Now(), Message: "secret"}); err != nil {
+		t.Fatalf("LogWriteErr: %s", err)
+	}
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, `"secret"`) {
+			t.Errorf("TLS: got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TLS: no record received")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	recs := make(chanLogWriter, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var rec log4go.LogRecord
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recs <- &rec
+	}))
+	defer srv.Close()
+
+	setFlags(t, map[string]string{"url": srv.URL})
+	w, err := newWriter()
+	if err != nil {
+		t.Fatalf("newWriter: %s", err)
+	}
+	defer w.Close()
+	f, _ := newTestFollower("")
+	if err := w.LogWriteErr(f.record([]byte("[2024/03/14 16:02:55] [WARN] (main.go:1) slow"))); err != nil {
+		t.Fatalf("LogWriteErr: %s", err)
+	}
+	if rec := receive(t, "http", recs); rec.Level != log4go.WARNING || !strings.HasSuffix(rec.Message, "slow") {
+		t.Errorf("http: got %+v", rec)
+	}
+}
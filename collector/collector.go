@@ -0,0 +1,345 @@
+// Package collector receives the records SocketLogWriters send and writes
+// them to a local Logger, so a central process can aggregate the logs of many.
+//
+//	log := log4go.NewLogger().AddFilter("file", log4go.INFO, log4go.NewFileLogWriter("all"))
+//	srv := collector.New(log, collector.JSON)
+//	srv.Listen("udp", ":12124")
+//	srv.Listen("tcp", ":12125")
+//
+// The senders on stream sockets must use the framing of the server, set
+// with SetFraming; datagrams carry one record each and are never framed.
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goldenspider/log4go"
+)
+
+// The encoding the senders use.  Without framing, records on streams
+// follow each other directly: JSON records may be separated by white
+// space, protobuf records carry their length.
+type Encoding int
+
+const (
+	JSON     Encoding = iota // the SocketLogWriter default, or a JSONEncoder
+	Protobuf                 // a ProtobufEncoder
+)
+
+// Largest datagram read
+const MAX_DATAGRAM = 64 * 1024
+
+// Largest record read from a stream
+const MAX_FRAME = 16 * 1024 * 1024
+
+var errTooLarge = fmt.Errorf("record larger than %d bytes", MAX_FRAME)
+
+// A Server listens on any number of sockets and dispatches the records
+// received to its Logger.
+type Server struct {
+	log      *log4go.Logger
+	encoding Encoding
+	framing  log4go.Framing
+
+	mu        sync.Mutex
+	closed    bool
+	listeners []net.Listener
+	packets   []net.PacketConn
+	conns     map[net.Conn]bool
+	wg        sync.WaitGroup
+}
+
+// This creates a new Server dispatching to log records in encoding.
+func New(log *log4go.Logger, encoding Encoding) *Server {
+	return &Server{
+		log:      log,
+		encoding: encoding,
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// Expect the records on stream sockets framed with framing (chainable), as
+// the senders' SocketLogWriter.SetFraming frames them.  Must be called
+// before Listen.
+func (s *Server) SetFraming(framing log4go.Framing) *Server {
+	s.framing = framing
+	return s
+}
+
+// Listen starts receiving on address in the background.  network is tcp,
+// tcp4, tcp6 or unix for streams and udp, udp4, udp6 or unixgram for
+// datagrams.
+func (s *Server) Listen(network, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("collector: server closed")
+	}
+
+	if strings.HasPrefix(network, "udp") || network == "unixgram" {
+		pc, err := net.ListenPacket(network, address)
+		if err != nil {
+			return err
+		}
+		s.packets = append(s.packets, pc)
+		s.wg.Add(1)
+		go s.servePackets(pc)
+		return nil
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	s.listeners = append(s.listeners, ln)
+	s.wg.Add(1)
+	go s.serveStreams(ln)
+	return nil
+}
+
+// Addrs returns the addresses listened on, e.g. to find the port picked for
+// ":0".
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var addrs []net.Addr
+	for _, ln := range s.listeners {
+		addrs = append(addrs, ln.Addr())
+	}
+	for _, pc := range s.packets {
+		addrs = append(addrs, pc.LocalAddr())
+	}
+	return addrs
+}
+
+// Close stops listening, drops open connections and waits for the
+// receiving goroutines to finish.  It does not close the Logger.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	for _, pc := range s.packets {
+		pc.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) serveStreams(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	next := s.streamDecoder(bufio.NewReader(conn))
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if !closed {
+				s.report(conn.RemoteAddr(), err)
+			}
+			return
+		}
+		s.log.Dispatch(rec)
+	}
+}
+
+func (s *Server) servePackets(pc net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, MAX_DATAGRAM)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		rec, err := s.decode(buf[:n])
+		if err != nil {
+			s.report(addr, err)
+			continue
+		}
+		s.log.Dispatch(rec)
+	}
+}
+
+// A function reading the next record of a stream, returning io.EOF at its
+// end
+func (s *Server) streamDecoder(r *bufio.Reader) func() (*log4go.LogRecord, error) {
+	switch {
+	case s.framing == log4go.FramingLength || s.framing == log4go.FramingOctet:
+		return func() (*log4go.LogRecord, error) {
+			data, err := readFrame(r, s.framing)
+			if err != nil {
+				return nil, err
+			}
+			return s.decode(data)
+		}
+	case s.encoding == JSON:
+		// Newlines are white space between JSON records.  The decoder
+		// may read MAX_FRAME bytes for each record, so a peer that never
+		// ends one cannot make it buffer without bound.
+		lr := &limitReader{r: r}
+		dec := json.NewDecoder(lr)
+		return func() (*log4go.LogRecord, error) {
+			lr.n = MAX_FRAME
+			rec := new(log4go.LogRecord)
+			if err := dec.Decode(rec); err != nil {
+				return nil, err
+			}
+			return rec, nil
+		}
+	}
+	return func() (*log4go.LogRecord, error) {
+		rec, err := log4go.ReadProtobufRecord(r)
+		if err != nil || s.framing != log4go.FramingNewline {
+			return rec, err
+		}
+		if b, err := r.ReadByte(); err != nil || b != '\n' {
+			return nil, errors.New("protobuf record not followed by a newline")
+		}
+		return rec, nil
+	}
+}
+
+// Read the record of a FramingLength or FramingOctet frame
+func readFrame(r *bufio.Reader, framing log4go.Framing) ([]byte, error) {
+	var size uint64
+	if framing == log4go.FramingLength {
+		var prefix [4]byte
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(binary.BigEndian.Uint32(prefix[:]))
+	} else {
+		// At most 10 digits, then a space
+		var count []byte
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				if err == io.EOF && len(count) > 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			if b == ' ' {
+				break
+			}
+			count = append(count, b)
+			if b < '0' || b > '9' || len(count) > 10 {
+				return nil, fmt.Errorf("bad octet count %q", count)
+			}
+		}
+		var err error
+		if size, err = strconv.ParseUint(string(count), 10, 64); err != nil {
+			return nil, fmt.Errorf("bad octet count %q", count)
+		}
+	}
+	if size > MAX_FRAME {
+		return nil, fmt.Errorf("record of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Reads at most n bytes from r, then fails with errTooLarge
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// Decode the record in a datagram or frame
+func (s *Server) decode(data []byte) (*log4go.LogRecord, error) {
+	if s.encoding == JSON {
+		rec := new(log4go.LogRecord)
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	}
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size != uint64(len(data)-n) {
+		return nil, errors.New("bad protobuf length prefix")
+	}
+	return log4go.UnmarshalProtobufRecord(data[n:])
+}
+
+// Log a record that could not be decoded, to the logger itself
+func (s *Server) report(addr net.Addr, err error) {
+	from := "unknown"
+	if addr != nil {
+		from = addr.String()
+	}
+	s.log.Dispatch(&log4go.LogRecord{
+		Level:   log4go.WARNING,
+		Created: time.Now(),
+		Source:  "collector",
+		Message: fmt.Sprintf("bad record from %s: %s", from, err),
+	})
+}
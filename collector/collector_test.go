@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goldenspider/log4go"
+)
+
+// Passes the records it is given on to a channel
+type chanLogWriter chan *log4go.LogRecord
+
+func (c chanLogWriter) LogWrite(rec *log4go.LogRecord) { c <- rec }
+func (c chanLogWriter) Close()                         {}
+func (c chanLogWriter) Flush()                         {}
+
+func newTestServer(encoding Encoding, framing log4go.Framing) (*Server, chanLogWriter, *log4go.Logger) {
+	recs := make(chanLogWriter, 16)
+	log := log4go.NewLogger().SetFilter("recv", log4go.NewFilter(log4go.DEBUG, recs))
+	return New(log, encoding).SetFraming(framing), recs, log
+}
+
+func receive(t *testing.T, what string, recs chanLogWriter) *log4go.LogRecord {
+	t.Helper()
+	select {
+	case rec := <-recs:
+		return rec
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: no record received", what)
+	}
+	return nil
+}
+
+var testRecords = []*log4go.LogRecord{
+	{Level: log4go.INFO, Created: time.Unix(1710432175, 0), Source: "main.go:12", Message: "started"},
+	{Level: log4go.ERROR, Created: time.Unix(1710432176, 500), Source: "db.go:40", Message: "query failed\ntimeout", Fields: log4go.Fields{"user": "bob"}},
+	{Level: log4go.WARNING, Created: time.Unix(1710432177, 0), Source: "db.go:52", Message: "18 slow queries"},
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	framings := []log4go.Framing{log4go.FramingNone, log4go.FramingNewline, log4go.FramingLength, log4go.FramingOctet}
+	encoders := map[Encoding]log4go.Encoder{JSON: nil, Protobuf: log4go.ProtobufEncoder{}}
+	sock := 0
+	for _, network := range []string{"udp", "tcp", "unix", "unixgram"} {
+		for encoding, enc := range encoders {
+			for _, framing := range framings {
+				what := network + "/" + map[Encoding]string{JSON: "json", Protobuf: "protobuf"}[encoding] + "/" + framing.String()
+				srv, recs, log := newTestServer(encoding, framing)
+				address := "127.0.0.1:0"
+				if strings.HasPrefix(network, "unix") {
+					sock++
+					address = filepath.Join(dir, fmt.Sprintf("%d.sock", sock))
+				}
+				if err := srv.Listen(network, address); err != nil {
+					t.Fatalf("%s: Listen: %s", what, err)
+				}
+
+				w := log4go.NewSocketLogWriter(network, srv.Addrs()[0].String()).SetFraming(framing)
+				if enc != nil {
+					w.SetEncoder(enc)
+				}
+				for _, rec := range testRecords {
+					if err := w.LogWriteErr(rec); err != nil {
+						t.Fatalf("%s: LogWriteErr: %s", what, err)
+					}
+				}
+				for _, want := range testRecords {
+					got := receive(t, what, recs)
+					if got.Level != want.Level || got.Source != want.Source || got.Message != want.Message ||
+						!got.Created.Equal(want.Created) || len(got.Fields) != len(want.Fields) {
+						t.Errorf("%s: got %+v, expected %+v", what, got, want)
+					}
+				}
+				w.Close()
+				srv.Close()
+				log.Close()
+			}
+		}
+	}
+}
+
+func TestBadRecords(t *testing.T) {
+	for _, bad := range []struct {
+		framing log4go.Framing
+		data    string
+		err     string
+	}{
+		{log4go.FramingNone, "not json", "invalid character"},
+		{log4go.FramingNone, `{"Message": "` + strings.Repeat("x", MAX_FRAME), "record larger than"},
+		{log4go.FramingLength, "\x00\x00\x00\x03abc", "invalid character"},
+		{log4go.FramingLength, "\xff\xff\xff\xff", "too large"},
+		{log4go.FramingOctet, "abc 3xyz", "bad octet count"},
+		{log4go.FramingOctet, strings.Repeat("1", 1000), "bad octet count"},
+		{log4go.FramingOctet, "9999999999 ", "too large"},
+	} {
+		srv, recs, log := newTestServer(JSON, bad.framing)
+		if err := srv.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The server may stop reading before all is written
+		go func() {
+			conn.Write([]byte(bad.data))
+			conn.Close()
+		}()
+		if rec := receive(t, bad.framing.String(), recs); rec.Level != log4go.WARNING || !strings.Contains(rec.Message, "bad record from") || !strings.Contains(rec.Message, bad.err) {
+			t.Errorf("%s: got %+v for a bad record", bad.framing, rec)
+		}
+		srv.Close()
+		log.Close()
+	}
+
+	srv, recs, log := newTestServer(Protobuf, log4go.FramingNone)
+	defer log.Close()
+	defer srv.Close()
+	if err := srv.Listen("udp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{5, 1})
+	if rec := receive(t, "udp", recs); !strings.Contains(rec.Message, "bad protobuf length prefix") {
+		t.Errorf("udp: got %+v for a bad datagram", rec)
+	}
+}
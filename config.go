@@ -4,33 +4,66 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"golang.org/x/text/encoding"
 )
 
-type kvProperty struct {
+// A property of a filter or writer in a configuration file
+type Property struct {
 	Name  string `xml:"name,attr"`
 	Value string `xml:",chardata"`
 }
 
 type kvFilter struct {
-	Enabled    string       `xml:"enabled,attr"`
-	Tag        string       `xml:"tag"`
-	Level      string       `xml:"level"`
-	Type       string       `xml:"type"`
-	Properties []kvProperty `xml:"property"`
+	Enabled    string     `xml:"enabled,attr"`
+	Tag        string     `xml:"tag"`
+	Level      string     `xml:"level"`
+	Type       string     `xml:"type"`
+	Properties []Property `xml:"property"`
+	Writers    []kvWriter `xml:"writer"`
+
+	version int // of the file the filter is in
+}
+
+// A further output of a filter, sharing its tag, level and filter properties
+type kvWriter struct {
+	Type       string     `xml:"type,attr"`
+	Properties []Property `xml:"property"`
 }
 
 type Config struct {
+	// The schema version, 1 if not set; see CONFIG_VERSION
+	Version int `xml:"version,attr"`
+
+	// Other configuration files whose filters come before these, relative
+	// to the including file.  A filter replaces an included one with the
+	// same tag, and removes it if disabled.
+	Include []string   `xml:"include"`
 	Filters []kvFilter `xml:"filter"`
+
+	// The filters of loggers returned by GetLogger, which replace theirs
+	// when the configuration is loaded, whichever logger loads it
+	Loggers []kvLogger `xml:"logger"`
 }
 
-func (log Logger) LoadConfig(filename string) {
+// The filters of a named logger
+type kvLogger struct {
+	Name    string     `xml:"name,attr"`
+	Filters []kvFilter `xml:"filter"`
+}
+
+func (log *Logger) LoadConfig(filename string) {
 	if len(filename) <= 0 {
 		return
 	}
@@ -52,7 +85,7 @@ func (log Logger) LoadConfig(filename string) {
 	return
 }
 
-func (log Logger) LoadConfigBuf(filename string, buf []byte) {
+func (log *Logger) LoadConfigBuf(filename string, buf []byte) {
 	ext := path.Ext(filename)
 	ext = ext[1:]
 
@@ -71,11 +104,11 @@ func (log Logger) LoadConfigBuf(filename string, buf []byte) {
 }
 
 // Parse Toml configuration; see examples/example.toml for documentation
-func (log Logger) LoadTomlConfig(filename string, contents []byte) {
+func (log *Logger) LoadTomlConfig(filename string, contents []byte) {
 	log.Close()
 
 	jc := new(Config)
-	err := toml.Unmarshal(contents, jc)
+	err := unmarshalConfig(toml.Unmarshal, contents, jc)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "LoadConfig: Error: Could not parse Toml configuration in %q: %s\n", filename, err)
 		os.Exit(1)
@@ -85,11 +118,11 @@ func (log Logger) LoadTomlConfig(filename string, contents []byte) {
 }
 
 // Parse Json configuration; see examples/example.json for documentation
-func (log Logger) LoadJSONConfig(filename string, contents []byte) {
+func (log *Logger) LoadJSONConfig(filename string, contents []byte) {
 	log.Close()
 
 	jc := new(Config)
-	if err := json.Unmarshal(contents, jc); err != nil {
+	if err := unmarshalConfig(json.Unmarshal, contents, jc); err != nil {
 		fmt.Fprintf(os.Stderr, "LoadConfig: Error: Could not parse Json configuration in %q: %s\n", filename, err)
 		os.Exit(1)
 	}
@@ -98,7 +131,7 @@ func (log Logger) LoadJSONConfig(filename string, contents []byte) {
 }
 
 // Parse XML configuration; see examples/example.xml for documentation
-func (log Logger) LoadXMLConfig(filename string, contents []byte) {
+func (log *Logger) LoadXMLConfig(filename string, contents []byte) {
 	log.Close()
 
 	xc := new(Config)
@@ -110,101 +143,991 @@ func (log Logger) LoadXMLConfig(filename string, contents []byte) {
 	log.ConfigToLogWriter(filename, xc)
 }
 
-func (log Logger) ConfigToLogWriter(filename string, cfg *Config) {
-	for _, kvfilt := range cfg.Filters {
-		var lw LogWriter
-		var lvl Level
+// ReloadConfig reads a configuration file like LoadConfig, but returns an
+// error instead of exiting if it is unusable and keeps the current filters
+// until the new ones are all built.
+func (log *Logger) ReloadConfig(filename string) error {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return log.ReloadConfigBuf(filename, buf)
+}
+
+// ReloadConfigBuf is ReloadConfig for a configuration already read; the
+// type is taken from the extension of filename.  Problems are also printed
+// to stderr.
+func (log *Logger) ReloadConfigBuf(filename string, buf []byte) error {
+	return log.reloadConfig(&configLoad{name: filename}, path.Ext(filename), buf)
+}
+
+// Replace the filters with those of a configuration of the given type,
+// keeping them if it is unusable
+func (log *Logger) reloadConfig(cl *configLoad, format string, buf []byte) error {
+	cfg, err := parseConfigAs(cl.name, format, buf)
+	if err != nil {
+		return err
+	}
+	return log.replaceConfig(cl, cfg)
+}
+
+// Replace the filters with those of cfg, keeping them if it is unusable
+func (log *Logger) replaceConfig(cl *configLoad, cfg *Config) error {
+	filters, ok := configFilters(cl, cfg)
+	if !ok {
+		if err := cl.problems(); err != nil {
+			return err
+		}
+		return fmt.Errorf("could not load configuration in %q", cl.name)
+	}
+	log.replaceFilters(filters)
+	for name, filters := range cl.loggers {
+		GetLogger(name).replaceFilters(filters)
+	}
+	return nil
+}
+
+// Parse a configuration of the type given by the extension of filename
+func parseConfig(filename string, buf []byte) (*Config, error) {
+	return parseConfigAs(filename, path.Ext(filename), buf)
+}
+
+// Parse a configuration of the given type, "xml", "json" or "toml", with or
+// without a leading dot; name is only used in errors
+func parseConfigAs(name, format string, buf []byte) (*Config, error) {
+	cfg := new(Config)
+	var err error
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "xml":
+		err = xml.Unmarshal(buf, cfg)
+	case "json":
+		err = unmarshalConfig(json.Unmarshal, buf, cfg)
+	case "toml":
+		err = unmarshalConfig(toml.Unmarshal, buf, cfg)
+	default:
+		return nil, fmt.Errorf("unknown config file type %q of %q", format, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse configuration in %q: %s", name, err)
+	}
+	return cfg, nil
+}
+
+// Unmarshal a Toml or Json configuration, either in the form of the XML one,
+// with a list of filters holding name/value property lists, or with a
+// table of filters by tag holding their settings directly:
+//
+//	[filters.file]
+//	type = "file"
+//	level = "INFO"
+//	path = "/var/log"
+//
+// enabled defaults to true there, and filters are taken in order of tag.  In
+// version 2 files settings may also be nested tables; see CONFIG_VERSION.
+// The filters of named loggers are tables of the same kind:
+//
+//	[loggers.payments.filters.file]
+//	type = "file"
+//	level = "WARNING"
+func unmarshalConfig(unmarshal func([]byte, interface{}) error, buf []byte, cfg *Config) error {
+	var tree map[string]interface{}
+	if err := unmarshal(buf, &tree); err != nil {
+		return err
+	}
+
+	var table, loggers map[string]interface{}
+	for key, val := range tree {
+		switch strings.ToLower(key) {
+		case "filters":
+			table, _ = val.(map[string]interface{})
+		case "loggers":
+			loggers, _ = val.(map[string]interface{})
+		case "include":
+			cfg.Include = append(cfg.Include, configStrings(val)...)
+		case "version":
+			vals := configStrings(val)
+			if len(vals) != 1 {
+				return fmt.Errorf("version must be a number")
+			}
+			v, err := strconv.Atoi(vals[0])
+			if err != nil {
+				return fmt.Errorf("version must be a number: %s", err)
+			}
+			cfg.Version = v
+		}
+	}
+	if table == nil && loggers == nil {
+		cfg.Include = nil
+		return unmarshal(buf, cfg)
+	}
+
+	var err error
+	if cfg.Filters, err = tableFilters(table, cfg.Version); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		section, ok := loggers[name].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("logger %q is not a table", name)
+		}
+		kvlog := kvLogger{Name: name}
+		for key, val := range section {
+			if strings.ToLower(key) != "filters" {
+				return fmt.Errorf("logger %q: unknown setting %s", name, key)
+			}
+			if table, ok = val.(map[string]interface{}); !ok {
+				return fmt.Errorf("logger %q: filters must be a table", name)
+			}
+			if kvlog.Filters, err = tableFilters(table, cfg.Version); err != nil {
+				return fmt.Errorf("logger %q: %s", name, err)
+			}
+		}
+		cfg.Loggers = append(cfg.Loggers, kvlog)
+	}
+	return nil
+}
+
+// The filters of a table of them by tag, in order of tag
+func tableFilters(table map[string]interface{}, version int) ([]kvFilter, error) {
+	var filters []kvFilter
+	tags := make([]string, 0, len(table))
+	for tag := range table {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		settings, ok := table[tag].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("filter %q is not a table", tag)
+		}
+		if version >= 2 {
+			settings = flattenSettings(settings)
+		}
+		kvfilt := kvFilter{Enabled: "true", Tag: tag}
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if strings.ToLower(name) == "writers" {
+				writers, err := configWriters(tag, settings[name], version >= 2)
+				if err != nil {
+					return nil, err
+				}
+				kvfilt.Writers = writers
+				continue
+			}
+			vals := configStrings(settings[name])
+			if vals == nil {
+				return nil, fmt.Errorf("filter %q: %s must be a string, number, boolean or list of them", tag, name)
+			}
+			val := strings.Join(vals, ",")
+			switch strings.ToLower(name) {
+			case "enabled":
+				kvfilt.Enabled = val
+			case "type":
+				kvfilt.Type = val
+			case "level":
+				kvfilt.Level = val
+			default:
+				kvfilt.Properties = append(kvfilt.Properties, Property{Name: name, Value: val})
+			}
+		}
+		filters = append(filters, kvfilt)
+	}
+	return filters, nil
+}
+
+// The writers of a filter given as a list of tables with a type each
+func configWriters(tag string, val interface{}, nested bool) ([]kvWriter, error) {
+	list, ok := val.([]interface{})
+	if !ok {
+		// Toml arrays of tables
+		if maps, ok := val.([]map[string]interface{}); ok {
+			for _, m := range maps {
+				list = append(list, m)
+			}
+		}
+	}
+	if list == nil {
+		return nil, fmt.Errorf("filter %q: writers must be a list of tables", tag)
+	}
+
+	writers := make([]kvWriter, 0, len(list))
+	for _, item := range list {
+		settings, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("filter %q: writers must be a list of tables", tag)
+		}
+		if nested {
+			settings = flattenSettings(settings)
+		}
+		var kvw kvWriter
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vals := configStrings(settings[name])
+			if vals == nil {
+				return nil, fmt.Errorf("filter %q: writer %s must be a string, number, boolean or list of them", tag, name)
+			}
+			val := strings.Join(vals, ",")
+			if strings.ToLower(name) == "type" {
+				kvw.Type = val
+			} else {
+				kvw.Properties = append(kvw.Properties, Property{Name: name, Value: val})
+			}
+		}
+		writers = append(writers, kvw)
+	}
+	return writers, nil
+}
+
+// The settings of nested tables under dotted names, e.g. tls.ca for ca in
+// [filters.out.tls]; only version 2 files may nest them
+func flattenSettings(settings map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(settings))
+	for name, val := range settings {
+		sub, ok := val.(map[string]interface{})
+		if !ok {
+			flat[name] = val
+			continue
+		}
+		for k, v := range flattenSettings(sub) {
+			flat[name+"."+k] = v
+		}
+	}
+	return flat
+}
+
+// The text of a plain setting, or of each item of a list, as a property
+// value; nil for anything else
+func configStrings(val interface{}) []string {
+	switch val := val.(type) {
+	case string:
+		return []string{val}
+	case bool:
+		return []string{strconv.FormatBool(val)}
+	case int64:
+		return []string{strconv.FormatInt(val, 10)}
+	case float64:
+		return []string{strconv.FormatFloat(val, 'f', -1, 64)}
+	case []interface{}:
+		strs := make([]string, 0, len(val))
+		for _, item := range val {
+			str := configStrings(item)
+			if len(str) != 1 {
+				return nil
+			}
+			strs = append(strs, str[0])
+		}
+		return strs
+	}
+	return nil
+}
+
+// Return cfg with the filters of the files it includes, and of the files
+// those include, in front of its own.  stack holds the absolute names of
+// the files including filename, to find cycles.  The files are read from
+// the file system of cl.
+func includeConfigs(cl *configLoad, filename string, cfg *Config, stack []string) (*Config, error) {
+	if err := stampVersion(filename, cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Include) == 0 {
+		return cfg, nil
+	}
+	abs, err := cl.absName(filename)
+	if err != nil {
+		return nil, err
+	}
+	stack = append(stack, abs)
+
+	merged := new(Config)
+	for _, inc := range cfg.Include {
+		inc = cl.includeName(filename, inc)
+		incAbs, err := cl.absName(inc)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range stack {
+			if name == incAbs {
+				return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, incAbs), " -> "))
+			}
+		}
+
+		buf, err := cl.readFile(inc)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %q included from %q: %s", inc, filename, err)
+		}
+		sub, err := parseConfig(inc, buf)
+		if err != nil {
+			return nil, err
+		}
+		if sub, err = includeConfigs(cl, inc, sub, stack); err != nil {
+			return nil, err
+		}
+		merged.Filters = append(merged.Filters, sub.Filters...)
+		merged.Loggers = append(merged.Loggers, sub.Loggers...)
+	}
+	merged.Filters = append(merged.Filters, cfg.Filters...)
+	merged.Loggers = append(merged.Loggers, cfg.Loggers...)
+	return merged, nil
+}
+
+func (log *Logger) ConfigToLogWriter(filename string, cfg *Config) {
+	log.applyConfig(&configLoad{name: filename}, cfg)
+}
+
+// Add the filters of a configuration, exiting if it is unusable
+func (log *Logger) applyConfig(cl *configLoad, cfg *Config) {
+	filters, ok := configFilters(cl, cfg)
+	if !ok {
+		os.Exit(1)
+	}
+	for name, filt := range filters {
+		log.SetFilter(name, filt)
+	}
+	for name, filters := range cl.loggers {
+		GetLogger(name).replaceFilters(filters)
+	}
+}
+
+// A ConfigError lists the problems found in a configuration, as LoadConfig
+// prints them, e.g. "Error: Required child <level> for filter missing in
+// app.xml".
+type ConfigError struct {
+	Filename string
+	Errors   []string // what made the configuration unusable
+	Warnings []string // what was ignored, such as unknown properties
+}
+
+// The first problem, and how many more there are
+func (e *ConfigError) Error() string {
+	problems := append(e.Errors[:len(e.Errors):len(e.Errors)], e.Warnings...)
+	if len(problems) == 0 {
+		return fmt.Sprintf("no problems in configuration %q", e.Filename)
+	}
+	msg := fmt.Sprintf("could not load configuration in %q: %s", e.Filename, strings.TrimPrefix(problems[0], "Error: "))
+	if len(e.Errors) == 0 {
+		msg = fmt.Sprintf("configuration %q has warnings: %s", e.Filename, strings.TrimPrefix(problems[0], "Warning: "))
+	}
+	if len(problems) > 1 {
+		msg += fmt.Sprintf(" (and %d more problems)", len(problems)-1)
+	}
+	return msg
+}
+
+// The loading of a configuration file, collecting the problems found
+type configLoad struct {
+	name   string
+	check  bool   // only check the configuration, building nothing
+	logger string // whose filters are being built, if not those of the file
+	fsys   fs.FS  // where included files are read, if not the file system
+	err    ConfigError
+
+	// The filters built for the named loggers of the configuration
+	loggers map[string]map[string]*Filter
+}
+
+// The file name, and logger if any, as the problems name them
+func (cl *configLoad) String() string {
+	if len(cl.logger) > 0 {
+		return fmt.Sprintf("%s (logger %q)", cl.name, cl.logger)
+	}
+	return cl.name
+}
+
+// Report a problem with the configuration, also printing it unless checking
+func (cl *configLoad) printf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !cl.check {
+		fmt.Fprint(os.Stderr, msg)
+	}
+	msg = strings.TrimSuffix(strings.TrimPrefix(msg, "LoadConfig: "), "\n")
+	if strings.HasPrefix(msg, "Warning: ") {
+		cl.err.Warnings = append(cl.err.Warnings, msg)
+	} else {
+		cl.err.Errors = append(cl.err.Errors, msg)
+	}
+}
+
+// The problems found as a *ConfigError, or nil
+func (cl *configLoad) problems() error {
+	if len(cl.err.Errors) == 0 && len(cl.err.Warnings) == 0 {
+		return nil
+	}
+	cl.err.Filename = cl.name
+	return &cl.err
+}
+
+// CheckConfig validates a configuration file the way LoadConfig loads it,
+// including the files it includes, but without creating any file, socket or
+// filter, e.g. before deploying it.  Keys and certificates are not read.  It
+// returns a *ConfigError listing every problem found, warnings included, or
+// nil if there were none.
+func CheckConfig(filename string) error {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return CheckConfigBuf(filename, buf)
+}
+
+// CheckConfigBuf is CheckConfig for a configuration already read; the type
+// is taken from the extension of filename.
+func CheckConfigBuf(filename string, buf []byte) error {
+	cfg, err := parseConfig(filename, buf)
+	if err != nil {
+		return err
+	}
+	cl := &configLoad{name: filename, check: true}
+	configFilters(cl, cfg)
+	return cl.problems()
+}
+
+// Build the enabled filters of a configuration by tag, and those of its
+// named loggers into cl.loggers.  Problems are printed to stderr and
+// collected in cl; if there were any, the filters already built are closed
+// and false is returned.
+func configFilters(cl *configLoad, cfg *Config) (map[string]*Filter, bool) {
+	cfg, err := includeConfigs(cl, cl.name, cfg, nil)
+	if err != nil {
+		cl.printf("LoadConfig: Error: %s\n", err)
+		return nil, false
+	}
+	filters, ok := buildFilters(cl, cfg.Filters)
+
+	// The sections of a logger add up, those included first
+	var names []string
+	sections := make(map[string][]kvFilter)
+	for _, kvlog := range cfg.Loggers {
+		if len(kvlog.Name) == 0 {
+			cl.printf("LoadConfig: Error: Required attribute %s for logger missing in %s\n", "name", cl)
+			ok = false
+			continue
+		}
+		if _, seen := sections[kvlog.Name]; !seen {
+			names = append(names, kvlog.Name)
+		}
+		sections[kvlog.Name] = append(sections[kvlog.Name], kvlog.Filters...)
+	}
+	cl.loggers = make(map[string]map[string]*Filter)
+	for _, name := range names {
+		cl.logger = name
+		if built, good := buildFilters(cl, sections[name]); good {
+			cl.loggers[name] = built
+		} else {
+			ok = false
+		}
+	}
+	cl.logger = ""
+
+	if !ok {
+		for _, filt := range filters {
+			filt.Close()
+		}
+		for _, built := range cl.loggers {
+			for _, filt := range built {
+				filt.Close()
+			}
+		}
+		cl.loggers = nil
+		return nil, false
+	}
+	return filters, true
+}
+
+// Build the enabled filters of a list by tag, closing them all and
+// returning false if any had problems
+func buildFilters(cl *configLoad, kvfilts []kvFilter) (map[string]*Filter, bool) {
+	filters := make(map[string]*Filter)
+	fail := func() (map[string]*Filter, bool) {
+		for _, filt := range filters {
+			filt.Close()
+		}
+		return nil, false
+	}
+
+	// Check every filter, so all problems are reported at once
+	failed := false
+	for _, kvfilt := range kvfilts {
 		bad, good, enabled := false, true, false
 
 		// Check required children
 		if len(kvfilt.Enabled) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfig: Error: Required attribute %s for filter missing in %s\n", "enabled", filename)
+			cl.printf("LoadConfig: Error: Required attribute %s for filter missing in %s\n", "enabled", cl)
 			bad = true
 		} else {
 			enabled = kvfilt.Enabled != "false"
 		}
 		if len(kvfilt.Tag) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfig: Error: Required child <%s> for filter missing in %s\n", "tag", filename)
+			cl.printf("LoadConfig: Error: Required child <%s> for filter missing in %s\n", "tag", cl)
 			bad = true
 		}
-		if len(kvfilt.Type) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfig: Error: Required child <%s> for filter missing in %s\n", "type", filename)
+		if len(kvfilt.Type) == 0 && len(kvfilt.Writers) == 0 {
+			cl.printf("LoadConfig: Error: Required child <%s> for filter missing in %s\n", "type", cl)
 			bad = true
 		}
 		if len(kvfilt.Level) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfig: Error: Required child <%s> for filter missing in %s\n", "level", filename)
+			cl.printf("LoadConfig: Error: Required child <%s> for filter missing in %s\n", "level", cl)
 			bad = true
 		}
 
-		switch kvfilt.Level {
-		case "DEBUG":
-			lvl = DEBUG
-		case "TRACE":
-			lvl = TRACE
-		case "INFO":
-			lvl = INFO
-		case "WARNING":
-			lvl = WARNING
-		case "ERROR":
-			lvl = ERROR
-		case "CRITICAL":
-			lvl = CRITICAL
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfig: Error: Required child <%s> for filter has unknown value in %s: %s\n", "level", filename, kvfilt.Level)
+		lvl, ok := parseLevel(kvfilt.Level)
+		if !ok {
+			cl.printf("LoadConfig: Error: Required child <%s> for filter has unknown value in %s: %s\n", "level", cl, kvfilt.Level)
 			bad = true
 		}
 
 		// Just so all of the required attributes are errored at the same time if missing
 		if bad {
-			os.Exit(1)
+			failed = true
+			continue
+		}
+		if cl.check {
+			enabled = false
 		}
 
-		switch kvfilt.Type {
-		case "console":
-			lw, good = propToConsoleLogWriter(filename, kvfilt.Properties, enabled)
-		case "socket":
-			lw, good = propToSocketLogWriter(filename, kvfilt.Properties, enabled)
-		case "file":
-			lw, good = propToFileLogWriter(filename, kvfilt.Properties, enabled)
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfig: Error: Could not load configuration in %s: unknown filter type \"%s\"\n", filename, kvfilt.Type)
-			os.Exit(1)
+		fprops, wprops := splitFilterProps(migrateProps(cl, &kvfilt, kvfilt.Properties))
+
+		var writers []LogWriter
+		addWriter := func(typ string, props []Property) {
+			lw, ok := propToLogWriter(cl, typ, props, enabled)
+			if !ok {
+				good = false
+			} else if enabled {
+				writers = append(writers, lw)
+			}
+		}
+		if len(kvfilt.Type) > 0 {
+			addWriter(kvfilt.Type, wprops)
+		} else {
+			for _, prop := range wprops {
+				cl.printf("LoadConfig: Warning: Unknown property \"%s\" for filter without type in %s\n", prop.Name, cl)
+			}
+		}
+		for _, kvw := range kvfilt.Writers {
+			addWriter(kvw.Type, migrateProps(cl, &kvfilt, kvw.Properties))
+		}
+
+		var filt *Filter
+		if enabled && good {
+			var lw LogWriter = NewTeeLogWriter(writers...)
+			if len(writers) == 1 {
+				lw = writers[0]
+			}
+			filt = NewFilterWithQueue(lvl, lw, propToQueueSize(fprops))
+			writers = nil
+		}
+		if !propToFilter(cl, fprops, filt) {
+			good = false
 		}
 
 		// Just so all of the required params are errored at the same time if wrong
 		if !good {
-			os.Exit(1)
+			if filt != nil {
+				filt.Close()
+			}
+			for _, lw := range writers {
+				lw.Close()
+			}
+			failed = true
+			continue
+		}
+
+		if old, ok := filters[kvfilt.Tag]; ok {
+			old.Close()
+			delete(filters, kvfilt.Tag)
 		}
 
 		// If we're disabled (syntax and correctness checks only), don't add to logger
 		if !enabled {
 			continue
 		}
+		filters[kvfilt.Tag] = filt
+	}
+	if failed {
+		return fail()
+	}
+	return filters, true
+}
+
+// A WriterFactory builds a writer from the properties given to it in a
+// configuration file, those of the filter excepted.
+type WriterFactory func(props []Property) (LogWriter, error)
+
+var (
+	writerTypesMu sync.RWMutex
+	writerTypes   = make(map[string]WriterFactory)
+)
+
+// RegisterWriterType makes filters and writers of type name in configuration
+// files use factory, so custom writers can be configured like the built in
+// ones.  The factory is only called for enabled filters, so CheckConfig does
+// not check its properties.  It panics if name is taken or factory is nil.
+func RegisterWriterType(name string, factory WriterFactory) {
+	if len(name) == 0 || factory == nil {
+		panic("log4go: RegisterWriterType needs a name and a factory")
+	}
+	writerTypesMu.Lock()
+	defer writerTypesMu.Unlock()
+	if _, dup := writerTypes[name]; dup || name == "console" || name == "socket" || name == "file" {
+		panic("log4go: writer type " + strconv.Quote(name) + " is already registered")
+	}
+	writerTypes[name] = factory
+}
+
+// Build the writer of type typ from its properties
+func propToLogWriter(cl *configLoad, typ string, props []Property, enabled bool) (LogWriter, bool) {
+	switch typ {
+	case "console":
+		return propToConsoleLogWriter(cl, props, enabled)
+	case "socket":
+		return propToSocketLogWriter(cl, props, enabled)
+	case "file":
+		return propToFileLogWriter(cl, props, enabled)
+	}
+	writerTypesMu.RLock()
+	factory, ok := writerTypes[typ]
+	writerTypesMu.RUnlock()
+	if ok {
+		if !enabled {
+			return nil, true
+		}
+		lw, err := factory(props)
+		if err != nil {
+			cl.printf("LoadConfig: Error: Could not load configuration in %s: %s writer: %s\n", cl, typ, err)
+			return nil, false
+		}
+		return lw, true
+	}
+	cl.printf("LoadConfig: Error: Could not load configuration in %s: unknown filter type \"%s\"\n", cl, typ)
+	return nil, false
+}
 
-		log[kvfilt.Tag] = NewFilter(lvl, lw)
+// Parse a level name as used in configuration files
+func parseLevel(str string) (Level, bool) {
+	switch str {
+	case "DEBUG":
+		return DEBUG, true
+	case "TRACE":
+		return TRACE, true
+	case "INFO":
+		return INFO, true
+	case "WARNING":
+		return WARNING, true
+	case "ERROR":
+		return ERROR, true
+	case "CRITICAL":
+		return CRITICAL, true
+	}
+	return 0, false
+}
+
+// ParseLevel returns the level named str, ignoring case, as in
+// configuration files (e.g. WARNING) or as Level.String writes it (WARN).
+func ParseLevel(str string) (Level, bool) {
+	str = strings.ToUpper(str)
+	if lvl, ok := parseLevel(str); ok {
+		return lvl, true
+	}
+	for i, s := range levelStrings {
+		if s == str {
+			return Level(i), true
+		}
+	}
+	if str == "ERR" {
+		return ERROR, true
+	}
+	return 0, false
+}
+
+// Reports whether a property applies to the filter rather than its writer
+func isFilterProp(name string) bool {
+	switch name {
+	case "ratelimit", "sampling", "include", "exclude", "matchsource", "levels",
+		"route", "fallback", "tags", "hostmetadata", "buildinfo", "queuesize", "overflow",
+		"sync", "sanitize", "maxlength", "maxfieldlength":
+		return true
+	}
+	return strings.HasPrefix(name, "ratelimit.")
+}
+
+// Separate the filter properties from those meant for the writer
+func splitFilterProps(props []Property) (filt, writer []Property) {
+	for _, prop := range props {
+		if isFilterProp(prop.Name) {
+			filt = append(filt, prop)
+		} else {
+			writer = append(writer, prop)
+		}
+	}
+	return filt, writer
+}
+
+// Apply filter properties to filt.  If filt is nil (the filter is disabled)
+// the properties are only checked.
+func propToFilter(cl *configLoad, props []Property, filt *Filter) bool {
+	good := true
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch {
+		case prop.Name == "ratelimit":
+			rate, burst, err := parseRateLimit(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			} else if filt != nil {
+				filt.SetRateLimit(rate, burst)
+			}
+		case prop.Name == "include" || prop.Name == "exclude":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			} else if filt != nil && prop.Name == "include" {
+				filt.SetInclude(re)
+			} else if filt != nil {
+				filt.SetExclude(re)
+			}
+		case prop.Name == "matchsource":
+			if filt != nil {
+				filt.SetMatchSource(value != "false")
+			}
+		case prop.Name == "levels":
+			rules, err := parseSourceLevels(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			} else if filt != nil {
+				for _, r := range rules {
+					filt.SetSourceLevel(r.pattern, r.lvl)
+				}
+			}
+		case prop.Name == "route":
+			routes, err := parseRoutes(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			} else if filt != nil {
+				for _, r := range routes {
+					filt.AddRoute(r.key, r.pattern)
+				}
+			}
+		case prop.Name == "tags":
+			for _, pattern := range strings.Split(value, ",") {
+				pattern = strings.TrimSpace(pattern)
+				// A pattern in slashes is a regular expression
+				if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+					re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+					if err != nil {
+						cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+						good = false
+						break
+					}
+					if filt != nil {
+						filt.AddTagRegexp(re)
+					}
+					continue
+				}
+				if _, err := path.Match(pattern, ""); err != nil || len(pattern) == 0 {
+					cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s\n", value, prop.Name, cl)
+					good = false
+					break
+				}
+				if filt != nil {
+					filt.AddTag(pattern)
+				}
+			}
+		case prop.Name == "hostmetadata":
+			if filt != nil && value != "false" {
+				filt.Use(EnrichMiddleware(HostMetadata()))
+			}
+		case prop.Name == "buildinfo":
+			if filt != nil && value != "false" {
+				filt.Use(EnrichMiddleware(BuildMetadata()))
+			}
+		case prop.Name == "fallback":
+			if filt != nil {
+				filt.SetFallback(value != "false")
+			}
+		case prop.Name == "sanitize":
+			mode, ok := parseSanitizeMode(value)
+			if !ok {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: expected escape or strip\n", value, prop.Name, cl)
+				good = false
+			} else if filt != nil {
+				filt.Use(SanitizeMiddleware(mode))
+			}
+		case prop.Name == "maxlength" || prop.Name == "maxfieldlength":
+			size, err := ParseSize(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			} else if filt != nil && prop.Name == "maxlength" {
+				filt.Use(TruncateMiddleware(int(size), 0))
+			} else if filt != nil {
+				filt.Use(TruncateMiddleware(0, int(size)))
+			}
+		case prop.Name == "sync":
+			if filt != nil {
+				filt.SetSync(value != "false")
+			}
+		case prop.Name == "queuesize":
+			// Used by propToQueueSize when the filter is created
+			if _, err := strToNumSuffix(value, 1000); err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			}
+		case prop.Name == "overflow":
+			policy, ok := parseOverflowPolicy(value)
+			if !ok {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: expected block, drop-newest or drop-oldest\n", value, prop.Name, cl)
+				good = false
+			} else if filt != nil {
+				filt.SetOverflow(policy)
+			}
+		case prop.Name == "sampling":
+			first, thereafter, err := parseSampling(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+			} else if filt != nil {
+				filt.SetSampling(first, thereafter)
+			}
+		case strings.HasPrefix(prop.Name, "ratelimit."):
+			lvl, ok := ParseLevel(prop.Name[len("ratelimit."):])
+			rate, burst, err := parseRateLimit(value)
+			if !ok || err != nil {
+				cl.printf("LoadConfig: Error: Bad property \"%s\" = %q in %s\n", prop.Name, value, cl)
+				good = false
+			} else if filt != nil {
+				filt.SetLevelRateLimit(lvl, rate, burst)
+			}
+		}
 	}
+	return good
 }
 
-func propToFileLogWriter(filename string, props []kvProperty, enabled bool) (*FileLogWriter, bool) {
+func propToFileLogWriter(cl *configLoad, props []Property, enabled bool) (*FileLogWriter, bool) {
+	filename := cl.name
 	format := "[%D %T] [%L] (%S) %M"
 	bufsize := 0
 	compress := false
 	path := ""
+	header, trailer := "", ""
+	nametemplate, archivedir := "", ""
+	var charset encoding.Encoding
+	indent := ""
+	good := true
+	shared := false
+	var key KeyFunc
+	audit, auditevery := false, 0
+	var auditkey KeyFunc
+	var rotateinterval, flushinterval time.Duration
+	var enc encoderProps
+	var lfmt levelFormatProps
 	// Parse properties
 	for _, prop := range props {
+		if enc.take(prop) || lfmt.take(prop) {
+			continue
+		}
 		switch prop.Name {
 		case "filename":
 			filename = strings.Trim(prop.Value, " \r\n")
 		case "path":
 			path = strings.Trim(prop.Value, " \r\n")
 		case "bufsize":
-			bufsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+			value := strings.Trim(prop.Value, " \r\n")
+			size, err := ParseSize(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" for file filter in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+				continue
+			}
+			bufsize = int(size)
+		case "rotateinterval", "flushinterval":
+			value := strings.Trim(prop.Value, " \r\n")
+			d, err := ParseDuration(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" for file filter in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+				continue
+			}
+			if prop.Name == "rotateinterval" {
+				rotateinterval = d
+			} else {
+				flushinterval = d
+			}
 		case "format":
 			format = strings.Trim(prop.Value, " \r\n")
 		case "compress":
 			compress = strings.Trim(prop.Value, " \r\n") != "false"
+		case "header":
+			header = strings.Trim(prop.Value, " \r\n")
+		case "trailer":
+			trailer = strings.Trim(prop.Value, " \r\n")
+		case "nametemplate":
+			nametemplate = strings.Trim(prop.Value, " \r\n")
+		case "archivedir":
+			archivedir = strings.Trim(prop.Value, " \r\n")
+		case "shared":
+			shared = strings.Trim(prop.Value, " \r\n") != "false"
+		case "indent":
+			indent = parseIndent(strings.Trim(prop.Value, " \r\n"))
+		case "charset":
+			value := strings.Trim(prop.Value, " \r\n")
+			cs, err := parseCharset(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" for file filter in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+				continue
+			}
+			charset = cs
+		case "keyfile":
+			key = KeyFromFile(strings.Trim(prop.Value, " \r\n"))
+		case "keyenv":
+			key = KeyFromEnv(strings.Trim(prop.Value, " \r\n"))
+		case "audit":
+			audit = strings.Trim(prop.Value, " \r\n") != "false"
+		case "auditkeyfile":
+			auditkey = KeyFromFile(strings.Trim(prop.Value, " \r\n"))
+		case "auditevery":
+			value := strings.Trim(prop.Value, " \r\n")
+			n, err := strToNumSuffix(value, 1000)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" for file filter in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+				continue
+			}
+			auditevery = n
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfig: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, filename)
+			cl.printf("LoadConfig: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, cl)
+		}
+	}
+
+	encoder, ok := enc.encoder(cl)
+	if !lfmt.check(cl) || !ok || !good {
+		return nil, false
+	}
+	if shared && (key != nil || audit) {
+		cl.printf("LoadConfig: Error: A shared file filter cannot be encrypted or audited in %s\n", cl)
+		return nil, false
+	}
+
+	if len(nametemplate) > 0 {
+		if err := NewFileLogWriter(filename).SetFileNameTemplate(nametemplate); err != nil {
+			cl.printf("LoadConfig: Error: Invalid nametemplate for file filter in %s: %s\n", cl, err)
+			return nil, false
 		}
 	}
 
@@ -215,27 +1138,114 @@ func propToFileLogWriter(filename string, props []kvProperty, enabled bool) (*Fi
 
 	file := NewFileLogWriter(filename)
 	file.SetBufSize(bufsize)
+	file.SetRotateInterval(rotateinterval)
+	file.SetFlushInterval(flushinterval)
 	file.SetFormat(format)
+	for lvl, f := range lfmt.formats {
+		file.SetLevelFormat(lvl, f)
+	}
+	file.SetEncoder(encoder)
 	file.SetCompress(compress)
+	file.SetHeadFoot(header, trailer)
+	file.SetShared(shared)
+	file.SetCharset(charset)
+	file.SetIndent(indent)
 	file.SetPath(path)
+	if len(archivedir) > 0 {
+		file.SetArchiveDir(archivedir)
+	}
+	if len(nametemplate) > 0 {
+		file.SetFileNameTemplate(nametemplate)
+	}
+	if key != nil {
+		if err := file.SetEncryption(key); err != nil {
+			cl.printf("LoadConfig: Error: Could not set up encryption for file filter in %s: %s\n", cl, err)
+			return nil, false
+		}
+	}
+	if audit {
+		var k []byte
+		if auditkey != nil {
+			var err error
+			if k, err = auditkey(); err != nil {
+				cl.printf("LoadConfig: Error: Could not read audit key for file filter in %s: %s\n", cl, err)
+				return nil, false
+			}
+		}
+		file.SetAudit(k, auditevery)
+	}
 	return file, true
 }
 
-func propToConsoleLogWriter(filename string, props []kvProperty, enabled bool) (*ConsoleLogWriter, bool) {
+func propToConsoleLogWriter(cl *configLoad, props []Property, enabled bool) (*ConsoleLogWriter, bool) {
 	color := true
 	format := "[%D %T] [%L] (%S) %M"
+	var enc encoderProps
+	var lfmt levelFormatProps
+	var theme Theme
+	var errLevel *Level
+	var charset encoding.Encoding
+	indent := ""
+	good := true
 	// Parse properties
 	for _, prop := range props {
+		if enc.take(prop) || lfmt.take(prop) {
+			continue
+		}
+		if strings.HasPrefix(prop.Name, "theme.") {
+			value := strings.Trim(prop.Value, " \r\n")
+			lvl, ok := ParseLevel(strings.TrimPrefix(prop.Name, "theme."))
+			style, err := parseStyle(value)
+			if !ok || err != nil {
+				cl.printf("LoadConfig: Error: Bad property \"%s\" = %q for console filter in %s\n", prop.Name, value, cl)
+				good = false
+				continue
+			}
+			if theme == nil {
+				theme = DefaultTheme()
+			}
+			theme[lvl] = style
+			continue
+		}
 		switch prop.Name {
 		case "color":
 			color = strings.Trim(prop.Value, " \r\n") != "false"
 		case "format":
 			format = strings.Trim(prop.Value, " \r\n")
+			// JSON lines, e.g. for a container runtime
+			if format == "json" && len(enc.encoding) == 0 {
+				enc.encoding = "json"
+			}
+		case "stderr":
+			value := strings.Trim(prop.Value, " \r\n")
+			lvl, ok := ParseLevel(value)
+			if !ok {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" for console filter in %s\n", value, prop.Name, cl)
+				good = false
+				continue
+			}
+			errLevel = &lvl
+		case "indent":
+			indent = parseIndent(strings.Trim(prop.Value, " \r\n"))
+		case "charset":
+			value := strings.Trim(prop.Value, " \r\n")
+			cs, err := parseCharset(value)
+			if err != nil {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" for console filter in %s: %s\n", value, prop.Name, cl, err)
+				good = false
+				continue
+			}
+			charset = cs
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfig: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, filename)
+			cl.printf("LoadConfig: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, cl)
 		}
 	}
 
+	encoder, ok := enc.encoder(cl)
+	if !lfmt.check(cl) || !ok || !good {
+		return nil, false
+	}
+
 	// If it's disabled, we're just checking syntax
 	if !enabled {
 		return nil, true
@@ -243,13 +1253,132 @@ func propToConsoleLogWriter(filename string, props []kvProperty, enabled bool) (
 
 	clw := NewConsoleLogWriter()
 	clw.SetColor(color)
+	if theme != nil {
+		clw.SetTheme(theme)
+	}
+	if errLevel != nil {
+		clw.SetStderrLevel(*errLevel)
+	}
 	clw.SetFormat(format)
+	for lvl, f := range lfmt.formats {
+		clw.SetLevelFormat(lvl, f)
+	}
+	clw.SetEncoder(encoder)
+	clw.SetCharset(charset)
+	clw.SetIndent(indent)
 	return clw, true
 }
 
+// The format.<level> properties of a writer, e.g. format.error
+type levelFormatProps struct {
+	formats levelFormats
+	bad     []string
+}
+
+func (lp *levelFormatProps) take(prop Property) bool {
+	if !strings.HasPrefix(prop.Name, "format.") {
+		return false
+	}
+	lvl, ok := ParseLevel(strings.TrimPrefix(prop.Name, "format."))
+	if !ok {
+		lp.bad = append(lp.bad, prop.Name)
+		return true
+	}
+	if lp.formats == nil {
+		lp.formats = make(levelFormats)
+	}
+	lp.formats[lvl] = strings.Trim(prop.Value, " \r\n")
+	return true
+}
+
+// Report properties naming unknown levels.  Returns whether there were none.
+func (lp *levelFormatProps) check(cl *configLoad) bool {
+	for _, name := range lp.bad {
+		cl.printf("LoadConfig: Error: Unknown level in property \"%s\" in %s\n", name, cl)
+	}
+	return len(lp.bad) == 0
+}
+
+// Encoder properties shared by the writers
+type encoderProps struct {
+	encoding, vendor, product, version string
+	columns                            string
+}
+
+// Take prop if it is an encoder property
+func (ep *encoderProps) take(prop Property) bool {
+	value := strings.Trim(prop.Value, " \r\n")
+	switch prop.Name {
+	case "encoding":
+		ep.encoding = value
+	case "vendor":
+		ep.vendor = value
+	case "product":
+		ep.product = value
+	case "productversion":
+		ep.version = value
+	case "columns":
+		ep.columns = value
+	default:
+		return false
+	}
+	return true
+}
+
+// The encoder asked for, or nil to use the format
+func (ep *encoderProps) encoder(cl *configLoad) (Encoder, bool) {
+	switch ep.encoding {
+	case "", "format":
+		return nil, true
+	case "cef":
+		enc := NewCEFEncoder()
+		ep.device(&enc.Vendor, &enc.Product, &enc.Version)
+		return enc, true
+	case "leef":
+		enc := NewLEEFEncoder()
+		ep.device(&enc.Vendor, &enc.Product, &enc.Version)
+		return enc, true
+	case "csv":
+		return NewCSVEncoder(parseCSVColumns(ep.columns)...), true
+	case "json":
+		return JSONEncoder{}, true
+	case "protobuf":
+		return ProtobufEncoder{}, true
+	case "msgpack":
+		return MsgpackEncoder{}, true
+	}
+	cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: expected format, json, protobuf, msgpack, cef, leef or csv\n", ep.encoding, "encoding", cl)
+	return nil, false
+}
+
+// Override the device description of a SIEM encoder
+func (ep *encoderProps) device(vendor, product, version *string) {
+	if len(ep.vendor) > 0 {
+		*vendor = ep.vendor
+	}
+	if len(ep.product) > 0 {
+		*product = ep.product
+	}
+	if len(ep.version) > 0 {
+		*version = ep.version
+	}
+}
+
+// The queue size from the filter properties, or LogBufferLength
+func propToQueueSize(props []Property) int {
+	for _, prop := range props {
+		if prop.Name == "queuesize" {
+			n, _ := strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+			return n
+		}
+	}
+	return LogBufferLength
+}
+
 // Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024)
-func strToNumSuffix(str string, mult int) int {
+func strToNumSuffix(str string, mult int) (int, error) {
 	num := 1
+	digits := str
 	if len(str) > 1 {
 		switch str[len(str)-1] {
 		case 'G', 'g':
@@ -260,32 +1389,62 @@ func strToNumSuffix(str string, mult int) int {
 			fallthrough
 		case 'K', 'k':
 			num *= mult
-			str = str[0 : len(str)-1]
+			digits = str[0 : len(str)-1]
 		}
 	}
-	parsed, _ := strconv.Atoi(str)
-	return parsed * num
+	parsed, err := strconv.Atoi(digits)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("expected a number, optionally followed by K, M or G, not %q", str)
+	}
+	return parsed * num, nil
 }
 
-func propToSocketLogWriter(filename string, props []kvProperty, enabled bool) (*SocketLogWriter, bool) {
+func propToSocketLogWriter(cl *configLoad, props []Property, enabled bool) (*SocketLogWriter, bool) {
 	endpoint := ""
 	protocol := "udp"
+	useTLS := false
+	ca, cert, key := "", "", ""
+	framing := FramingNone
+	var enc encoderProps
 
 	// Parse properties
 	for _, prop := range props {
+		if enc.take(prop) {
+			continue
+		}
 		switch prop.Name {
 		case "endpoint":
 			endpoint = strings.Trim(prop.Value, " \r\n")
 		case "protocol":
 			protocol = strings.Trim(prop.Value, " \r\n")
+		case "tls":
+			useTLS = strings.Trim(prop.Value, " \r\n") != "false"
+		case "ca":
+			ca = strings.Trim(prop.Value, " \r\n")
+		case "cert":
+			cert = strings.Trim(prop.Value, " \r\n")
+		case "key":
+			key = strings.Trim(prop.Value, " \r\n")
+		case "framing":
+			value := strings.Trim(prop.Value, " \r\n")
+			var ok bool
+			if framing, ok = parseFraming(value); !ok {
+				cl.printf("LoadConfig: Error: Bad value %q for property \"%s\" in %s: expected none, newline, length or octet\n", value, prop.Name, cl)
+				return nil, false
+			}
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfig: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
+			cl.printf("LoadConfig: Warning: Unknown property \"%s\" for socket filter in %s\n", prop.Name, cl)
 		}
 	}
 
 	// Check properties
 	if len(endpoint) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfig: Error: Required property \"%s\" for file filter missing in %s\n", "endpoint", filename)
+		cl.printf("LoadConfig: Error: Required property \"%s\" for socket filter missing in %s\n", "endpoint", cl)
+		return nil, false
+	}
+
+	encoder, ok := enc.encoder(cl)
+	if !ok {
 		return nil, false
 	}
 
@@ -294,5 +1453,14 @@ func propToSocketLogWriter(filename string, props []kvProperty, enabled bool) (*
 		return nil, true
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	sock := NewSocketLogWriter(protocol, endpoint).SetEncoder(encoder).SetFraming(framing)
+	if useTLS {
+		cfg, err := LoadTLSConfig(ca, cert, key)
+		if err != nil {
+			cl.printf("LoadConfig: Error: Could not set up TLS for socket filter in %s: %s\n", cl, err)
+			return nil, false
+		}
+		sock.SetTLS(cfg)
+	}
+	return sock, true
 }
@@ -0,0 +1,118 @@
+package log4go
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The name problems give a configuration read with LoadConfigReader or
+// LoadConfigBytes
+const READER_CONFIG_NAME = "(reader)"
+
+// LoadConfigReader is LoadConfig for a configuration read from r, such as
+// an HTTP response body.  format is its type, "xml", "json" or "toml".
+// Files it includes are relative to the working directory.
+func (log *Logger) LoadConfigReader(r io.Reader, format string) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig: Error: Could not read configuration: %s\n", err)
+		os.Exit(1)
+	}
+	log.LoadConfigBytes(buf, format)
+}
+
+// ReloadConfigReader is ReloadConfig for a configuration read from r, of
+// the type given by format as for LoadConfigReader.
+func (log *Logger) ReloadConfigReader(r io.Reader, format string) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return log.ReloadConfigBytes(buf, format)
+}
+
+// LoadConfigBytes is LoadConfig for a configuration already in memory, of
+// the type given by format as for LoadConfigReader.  Unlike LoadConfigBuf
+// it needs no file name to tell the type.
+func (log *Logger) LoadConfigBytes(buf []byte, format string) {
+	log.loadConfigAs(&configLoad{name: READER_CONFIG_NAME}, format, buf)
+}
+
+// ReloadConfigBytes is ReloadConfig for a configuration already in memory,
+// of the type given by format as for LoadConfigReader.
+func (log *Logger) ReloadConfigBytes(buf []byte, format string) error {
+	return log.reloadConfig(&configLoad{name: READER_CONFIG_NAME}, format, buf)
+}
+
+// LoadConfigFS is LoadConfig for the configuration named name in fsys, such
+// as an embed.FS, without touching the file system:
+//
+//	//go:embed logging.toml
+//	var configs embed.FS
+//
+//	log.LoadConfigFS(configs, "logging.toml")
+//
+// The type is taken from the extension of name, and the files it includes
+// are read from fsys too, relative to name.
+func (log *Logger) LoadConfigFS(fsys fs.FS, name string) {
+	buf, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig: Error: Could not read %q: %s\n", name, err)
+		os.Exit(1)
+	}
+	log.loadConfigAs(&configLoad{name: name, fsys: fsys}, path.Ext(name), buf)
+}
+
+// ReloadConfigFS is ReloadConfig for the configuration named name in fsys,
+// read as for LoadConfigFS.
+func (log *Logger) ReloadConfigFS(fsys fs.FS, name string) error {
+	buf, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	return log.reloadConfig(&configLoad{name: name, fsys: fsys}, path.Ext(name), buf)
+}
+
+// Replace the filters with those of a configuration of the given type,
+// exiting if it is unusable
+func (log *Logger) loadConfigAs(cl *configLoad, format string, buf []byte) {
+	cfg, err := parseConfigAs(cl.name, format, buf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig: Error: %s\n", err)
+		os.Exit(1)
+	}
+	log.Close()
+	log.applyConfig(cl, cfg)
+}
+
+// The name of the file inc included from filename
+func (cl *configLoad) includeName(filename, inc string) string {
+	if cl.fsys != nil {
+		// Names in an fs.FS are slash separated and relative to its root
+		return path.Join(path.Dir(filename), inc)
+	}
+	if filepath.IsAbs(inc) {
+		return inc
+	}
+	return filepath.Join(filepath.Dir(filename), inc)
+}
+
+// The name by which the same file is always known, to find include cycles
+func (cl *configLoad) absName(name string) (string, error) {
+	if cl.fsys != nil {
+		return path.Clean(name), nil
+	}
+	return filepath.Abs(name)
+}
+
+func (cl *configLoad) readFile(name string) ([]byte, error) {
+	if cl.fsys != nil {
+		return fs.ReadFile(cl.fsys, name)
+	}
+	return ioutil.ReadFile(name)
+}
@@ -0,0 +1,88 @@
+package log4go
+
+import (
+	"fmt"
+)
+
+// The newest configuration schema.  Version 2 groups related properties
+// under dotted names, which Toml and Json files may write as nested tables:
+//
+//	version = 2
+//	[filters.out]
+//	type = "socket"
+//	endpoint = "logs.example.com:5140"
+//	[filters.out.tls]
+//	enabled = true
+//	ca = "/etc/ssl/logs-ca.pem"
+//
+// Files without a version are version 1 and load as they always have.
+const CONFIG_VERSION = 2
+
+// The properties version 2 renamed, by their new name
+var configRenames = map[string]string{
+	"tls.enabled":        "tls",
+	"tls.ca":             "ca",
+	"tls.cert":           "cert",
+	"tls.key":            "key",
+	"encryption.keyfile": "keyfile",
+	"encryption.keyenv":  "keyenv",
+	"audit.enabled":      "audit",
+	"audit.keyfile":      "auditkeyfile",
+	"audit.every":        "auditevery",
+	"siem.vendor":        "vendor",
+	"siem.product":       "product",
+	"siem.version":       "productversion",
+	"queue.size":         "queuesize",
+	"queue.overflow":     "overflow",
+	"rotate.size":        "bufsize",
+	"rotate.interval":    "rotateinterval",
+	"flush.interval":     "flushinterval",
+}
+
+// The version 2 names of the renamed properties, by their old name
+var configRenamedTo = func() map[string]string {
+	m := make(map[string]string, len(configRenames))
+	for v2, v1 := range configRenames {
+		m[v1] = v2
+	}
+	return m
+}()
+
+// Check the version of a file and mark its filters with it
+func stampVersion(filename string, cfg *Config) error {
+	version := cfg.Version
+	if version == 0 {
+		version = 1
+	}
+	if version < 1 || version > CONFIG_VERSION {
+		return fmt.Errorf("unsupported configuration version %d in %q; this version of log4go reads versions 1 to %d", cfg.Version, filename, CONFIG_VERSION)
+	}
+	for i := range cfg.Filters {
+		cfg.Filters[i].version = version
+	}
+	for _, kvlog := range cfg.Loggers {
+		for i := range kvlog.Filters {
+			kvlog.Filters[i].version = version
+		}
+	}
+	return nil
+}
+
+// Bring the properties of a filter or writer to the names the writers take,
+// warning of names that do not belong to the version of the file.  Both are
+// still understood, so files can be moved to a new version at leisure.
+func migrateProps(cl *configLoad, kvfilt *kvFilter, props []Property) []Property {
+	migrated := make([]Property, 0, len(props))
+	for _, prop := range props {
+		if old, ok := configRenames[prop.Name]; ok {
+			if kvfilt.version < 2 {
+				cl.printf("LoadConfig: Warning: Property \"%s\" for filter %q needs configuration version 2 in %s; set version to 2 and use the new names\n", prop.Name, kvfilt.Tag, cl)
+			}
+			prop.Name = old
+		} else if renamed, ok := configRenamedTo[prop.Name]; ok && kvfilt.version >= 2 {
+			cl.printf("LoadConfig: Warning: Property \"%s\" for filter %q is named \"%s\" since configuration version 2 in %s\n", prop.Name, kvfilt.Tag, renamed, cl)
+		}
+		migrated = append(migrated, prop)
+	}
+	return migrated
+}
@@ -0,0 +1,73 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default columns of a CSVEncoder
+var CSV_COLUMNS = []string{"time", "level", "source", "message"}
+
+// CSVEncoder writes each record as a line of comma separated values.  The
+// columns time (RFC 3339), level, source, message, name, tag, seq and data are
+// taken from the record, any other column from the field of that name, empty if the
+// record does not have it.
+type CSVEncoder struct {
+	Columns []string
+}
+
+// This creates a new CSVEncoder with the given columns, or CSV_COLUMNS.
+func NewCSVEncoder(columns ...string) *CSVEncoder {
+	if len(columns) == 0 {
+		columns = CSV_COLUMNS
+	}
+	return &CSVEncoder{Columns: columns}
+}
+
+func (e *CSVEncoder) Encode(dst []byte, rec *LogRecord) []byte {
+	row := make([]string, len(e.Columns))
+	for i, col := range e.Columns {
+		switch col {
+		case "time":
+			row[i] = rec.Created.Format(time.RFC3339Nano)
+		case "level":
+			row[i] = rec.Level.String()
+		case "source":
+			row[i] = rec.Source
+		case "message":
+			row[i] = rec.Message
+		case "name":
+			row[i] = rec.Name
+		case "tag":
+			row[i] = rec.Tag
+		case "seq":
+			row[i] = strconv.FormatUint(rec.Seq, 10)
+		case "data":
+			row[i] = string(rec.Data)
+		default:
+			if v, ok := rec.Fields[col]; ok {
+				row[i] = string(appendValue(nil, v))
+			}
+		}
+	}
+
+	buf := bytes.NewBuffer(dst)
+	w := csv.NewWriter(buf)
+	w.Write(row)
+	w.Flush()
+	return buf.Bytes()
+}
+
+// Parse a column list like "time, level, user"
+func parseCSVColumns(spec string) []string {
+	var columns []string
+	for _, col := range strings.Split(spec, ",") {
+		if col = strings.TrimSpace(col); len(col) > 0 {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,107 @@
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Default time repeats are collected before they are summarized
+	DEDUP_WINDOW = 30 * time.Second
+)
+
+// This log writer suppresses consecutive records with the same level and
+// message, like syslog does, and writes a "last message repeated N times"
+// record instead once a different message arrives or the window expires.
+// The window is measured on the installed Clock.
+type DedupLogWriter struct {
+	writer LogWriter
+	window time.Duration
+
+	mu      sync.Mutex
+	last    *LogRecord
+	repeats int
+	since   time.Time // when the first pending repeat arrived
+	timer   *time.Timer
+}
+
+// This creates a new DedupLogWriter around writer
+func NewDedupLogWriter(writer LogWriter, window time.Duration) *DedupLogWriter {
+	if window <= 0 {
+		window = DEDUP_WINDOW
+	}
+	return &DedupLogWriter{
+		writer: writer,
+		window: window,
+	}
+}
+
+func (d *DedupLogWriter) LogWrite(rec *LogRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.last != nil && rec.Level == d.last.Level && rec.Message == d.last.Message {
+		if d.repeats > 0 && clockNow().Sub(d.since) >= d.window {
+			d.writeRepeats()
+		}
+		d.repeats++
+		if d.timer == nil {
+			d.since = clockNow()
+			d.timer = time.AfterFunc(d.window, d.expire)
+		}
+		return
+	}
+
+	d.writeRepeats()
+	d.last = rec
+	d.writer.LogWrite(rec)
+}
+
+// The timer only wakes us up; the window is over once the clock says so.
+func (d *DedupLogWriter) expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.repeats == 0 {
+		return
+	}
+	if left := d.window - clockNow().Sub(d.since); left > 0 {
+		d.timer = time.AfterFunc(left, d.expire)
+		return
+	}
+	d.writeRepeats()
+}
+
+// Write the summary for any pending repeats.  Must hold d.mu.
+func (d *DedupLogWriter) writeRepeats() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.repeats == 0 {
+		return
+	}
+
+	d.writer.LogWrite(&LogRecord{
+		Level:   d.last.Level,
+		Created: clockNow(),
+		Source:  d.last.Source,
+		Message: fmt.Sprintf("last message repeated %d times", d.repeats),
+	})
+	d.repeats = 0
+}
+
+func (d *DedupLogWriter) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.writeRepeats()
+	d.writer.Flush()
+}
+
+func (d *DedupLogWriter) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.writeRepeats()
+	d.last = nil
+	d.writer.Close()
+}
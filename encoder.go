@@ -0,0 +1,54 @@
+package log4go
+
+import (
+	"encoding/json"
+)
+
+// An Encoder renders a record for a writer in some format other than a
+// format string, e.g. for a SIEM or an analytics import.
+type Encoder interface {
+	// Append the encoded record, including any terminating newline, to dst
+	// and return the extended buffer.
+	Encode(dst []byte, rec *LogRecord) []byte
+}
+
+// EncoderFunc turns a function into an Encoder.
+type EncoderFunc func(dst []byte, rec *LogRecord) []byte
+
+func (f EncoderFunc) Encode(dst []byte, rec *LogRecord) []byte {
+	return f(dst, rec)
+}
+
+// JSONEncoder writes each record as a JSON object on a line of its own.
+// Field values JSON cannot hold, such as functions, and Data that is not
+// valid JSON are written as text.
+type JSONEncoder struct{}
+
+func (JSONEncoder) Encode(dst []byte, rec *LogRecord) []byte {
+	js, err := json.Marshal(rec)
+	if err != nil {
+		text := *rec
+		text.Fields = make(Fields, len(rec.Fields))
+		for k, v := range rec.Fields {
+			text.Fields[k] = string(appendValue(nil, v))
+		}
+		if len(rec.Data) > 0 && !json.Valid(rec.Data) {
+			text.Data, _ = json.Marshal(string(rec.Data))
+		}
+		js, _ = json.Marshal(&text)
+	}
+	dst = append(dst, js...)
+	return append(dst, '\n')
+}
+
+// Render rec with enc if set, and with format otherwise
+func encodeRecord(enc Encoder, format string, rec *LogRecord) string {
+	if enc == nil {
+		return FormatLogRecord(format, rec)
+	}
+	buf := formatBufPool.Get().(*[]byte)
+	*buf = enc.Encode((*buf)[:0], rec)
+	s := string(*buf)
+	formatBufPool.Put(buf)
+	return s
+}
@@ -0,0 +1,164 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Encrypted log files start with this header, followed by frames of a 4 byte
+// big endian ciphertext length, the 12 byte GCM nonce and the ciphertext.
+const ENCRYPTED_MAGIC = "L4GOENC1"
+
+// A KeyFunc supplies an AES key (16, 24 or 32 bytes), e.g. from a file, the
+// environment or a KMS.
+type KeyFunc func() ([]byte, error)
+
+// Read the key from a file holding either the raw key or its hex encoding
+func KeyFromFile(path string) KeyFunc {
+	return func() ([]byte, error) {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return decodeKey(buf)
+	}
+}
+
+// Read the hex encoded key from an environment variable
+func KeyFromEnv(name string) KeyFunc {
+	return func() ([]byte, error) {
+		value := os.Getenv(name)
+		if len(value) == 0 {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return hex.DecodeString(strings.TrimSpace(value))
+	}
+}
+
+func decodeKey(buf []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(buf))
+	if key, err := hex.DecodeString(text); err == nil && validKeySize(len(key)) {
+		return key, nil
+	}
+	if validKeySize(len(buf)) {
+		return buf, nil
+	}
+	return nil, fmt.Errorf("key must be 16, 24 or 32 bytes, raw or hex encoded")
+}
+
+func validKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+type logCipher struct {
+	aead cipher.AEAD
+}
+
+func newLogCipher(key []byte) (*logCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &logCipher{aead: aead}, nil
+}
+
+// Write the header and plain as a single encrypted frame
+func (lc *logCipher) writeEncrypted(w io.Writer, plain []byte) error {
+	nonce := make([]byte, lc.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := lc.aead.Seal(nil, nonce, plain, []byte(ENCRYPTED_MAGIC))
+
+	out := bytes.NewBuffer(make([]byte, 0, len(ENCRYPTED_MAGIC)+4+len(nonce)+len(sealed)))
+	out.WriteString(ENCRYPTED_MAGIC)
+	binary.Write(out, binary.BigEndian, uint32(len(sealed)))
+	out.Write(nonce)
+	out.Write(sealed)
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// Encrypts every write as a frame of its own
+type encryptedWriter struct {
+	lc *logCipher
+	w  io.Writer
+}
+
+func (e encryptedWriter) Write(p []byte) (int, error) {
+	if err := e.lc.writeEncrypted(e.w, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Encrypt the files written with AES-GCM.  The key is fetched once, now.
+func (c *FileLogWriter) SetEncryption(key KeyFunc) error {
+	k, err := key()
+	if err != nil {
+		return err
+	}
+	lc, err := newLogCipher(k)
+	if err != nil {
+		return err
+	}
+	c.cipher = lc
+	return nil
+}
+
+// DecryptLog writes the plain text of an encrypted log file from src to dst.
+// Concatenated encrypted files are accepted.
+func DecryptLog(dst io.Writer, src io.Reader, key []byte) error {
+	lc, err := newLogCipher(key)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(src)
+	magic := make([]byte, len(ENCRYPTED_MAGIC))
+	nonce := make([]byte, lc.aead.NonceSize())
+	for {
+		if _, err := io.ReadFull(r, magic); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if string(magic) != ENCRYPTED_MAGIC {
+			return errors.New("not an encrypted log4go file")
+		}
+
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, nonce); err != nil {
+			return err
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(r, sealed); err != nil {
+			return err
+		}
+		plain, err := lc.aead.Open(nil, nonce, sealed, magic)
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package log4go
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Prefix of the environment variables ConfigFromEnv reads
+const ENV_PREFIX = "LOG4GO_"
+
+// The name problems give the configuration built by ConfigFromEnv
+const ENV_CONFIG_NAME = "(environment)"
+
+// ConfigFromEnv builds a configuration from environment variables alone,
+// so a program can be configured without any file.  LOG4GO_<TYPE>_<NAME>
+// sets property name of the filter of writer type TYPE, with underscores
+// in the name read as dots, as in the settings of a version 2 file:
+//
+//	LOG4GO_CONSOLE_LEVEL=DEBUG
+//	LOG4GO_FILE_PATH=/var/log/app
+//	LOG4GO_FILE_ROTATE_SIZE=64MB
+//	LOG4GO_SOCKET_ENDPOINT=logs.example.com:5140
+//	LOG4GO_SOCKET_TLS_ENABLED=true
+//
+// The filters are tagged "stdout", "file" and "socket", and a type
+// registered with RegisterWriterType is tagged with its name.  A filter is
+// enabled once one of its variables is set, unless LOG4GO_<TYPE>_ENABLED is
+// false; without any the console filter is.  Filters without a level of
+// their own take LOG4GO_LEVEL, or INFO.
+func ConfigFromEnv() *Config {
+	return configFromEnv(os.Environ())
+}
+
+// LoadConfigEnv replaces the logger's filters with those ConfigFromEnv
+// builds, exiting if they are unusable, like LoadConfig.
+func (log *Logger) LoadConfigEnv() {
+	log.Close()
+	log.applyConfig(&configLoad{name: ENV_CONFIG_NAME}, ConfigFromEnv())
+}
+
+// ReloadConfigEnv is ReloadConfig for the configuration ConfigFromEnv builds.
+func (log *Logger) ReloadConfigEnv() error {
+	return log.replaceConfig(&configLoad{name: ENV_CONFIG_NAME}, ConfigFromEnv())
+}
+
+// Build the configuration of environ, a list of NAME=value
+func configFromEnv(environ []string) *Config {
+	types := []string{"console", "file", "socket"}
+	tags := map[string]string{"console": "stdout"}
+	writerTypesMu.RLock()
+	for typ := range writerTypes {
+		types = append(types, typ)
+	}
+	writerTypesMu.RUnlock()
+	sort.Strings(types[3:])
+
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.HasPrefix(kv, ENV_PREFIX) {
+			env[kv[len(ENV_PREFIX):i]] = kv[i+1:]
+		}
+	}
+	level, ok := env["LEVEL"]
+	if !ok {
+		level = "INFO"
+	}
+
+	cfg := &Config{Version: CONFIG_VERSION}
+	for _, typ := range types {
+		prefix := envName(typ) + "_"
+		kvfilt := kvFilter{Enabled: "true", Type: typ, Level: level, Tag: typ}
+		if tag, ok := tags[typ]; ok {
+			kvfilt.Tag = tag
+		}
+		var names []string
+		for name := range env {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop := strings.ToLower(strings.Replace(name[len(prefix):], "_", ".", -1))
+			switch prop {
+			case "enabled":
+				kvfilt.Enabled = env[name]
+			case "level":
+				kvfilt.Level = env[name]
+			default:
+				kvfilt.Properties = append(kvfilt.Properties, Property{Name: prop, Value: env[name]})
+			}
+		}
+		cfg.Filters = append(cfg.Filters, kvfilt)
+	}
+	if len(cfg.Filters) == 0 {
+		cfg.Filters = []kvFilter{{Enabled: "true", Type: "console", Level: level, Tag: "stdout"}}
+	}
+	return cfg
+}
+
+// The name of a writer type in environment variables, e.g. FILE for file
+func envName(typ string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, typ)
+}
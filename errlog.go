@@ -0,0 +1,114 @@
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The fields describing an error logged with ErrorErr, or given as the last
+// argument of a log call
+const (
+	ERROR_FIELD       = "error"       // its message
+	ERROR_TYPE_FIELD  = "error_type"  // its Go type, e.g. *fs.PathError
+	ERROR_STACK_FIELD = "error_stack" // where it was made, if it knows
+)
+
+// ErrorErr logs msg and err at ERROR with the error's message, type and, if
+// it or an error it wraps has a StackTrace method (as those of
+// github.com/pkg/errors do), its stack as fields, besides any fields given.
+// It returns msg and err as an error wrapping err.
+func (log *Logger) ErrorErr(err error, msg string, fields ...Fields) error {
+	return log.logErr(3, err, msg, fields)
+}
+
+// Log an error at ERROR; depth is passed to runtime.Caller by intLog
+func (log *Logger) logErr(depth int, err error, msg string, fields []Fields) error {
+	wrapped := fmt.Errorf("%s: %w", msg, err)
+	if err == nil {
+		wrapped = errors.New(msg)
+	}
+	if log.skip(ERROR) {
+		return wrapped
+	}
+
+	var merged Fields
+	for _, f := range fields {
+		if merged == nil {
+			merged = make(Fields, len(f)+3)
+		}
+		for k, v := range f {
+			merged[k] = v
+		}
+	}
+	if err != nil {
+		merged = errorFields(merged, err)
+	}
+	log.intLog(depth, ERROR, merged, wrapped.Error())
+	return wrapped
+}
+
+// Format a log message like fmt.Sprintf, also accepting %w like fmt.Errorf.
+// If the last argument is an error and the format has no verb left for it,
+// it is appended to the message after a colon:
+//
+//	log.Warn("retrying %s", url, err) // "retrying http://x: connection refused"
+//
+// With %w or a last error argument, the message is also returned as an
+// error wrapping it.
+func formatMessage(format string, args []interface{}) (string, error) {
+	cause := lastError(args)
+	if cause == nil && !strings.Contains(format, "%w") {
+		return fmt.Sprintf(format, args...), nil
+	}
+
+	wrapped := fmt.Errorf(format, args...)
+	msg := wrapped.Error()
+	if cause != nil && strings.HasSuffix(msg, ")") && strings.Contains(msg, "%!(EXTRA ") {
+		wrapped = fmt.Errorf(format+": %w", args...)
+		msg = wrapped.Error()
+	}
+	return msg, wrapped
+}
+
+// The last argument of a log call if it is an error
+func lastError(args []interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	err, _ := args[len(args)-1].(error)
+	return err
+}
+
+// Add the fields describing err to a copy of fields, keeping those set
+func errorFields(fields Fields, err error) Fields {
+	merged := make(Fields, len(fields)+3)
+	for k, v := range fields {
+		merged[k] = v
+	}
+	set := func(k string, v interface{}) {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+	set(ERROR_FIELD, err.Error())
+	set(ERROR_TYPE_FIELD, fmt.Sprintf("%T", err))
+	if stack := errorStack(err); len(stack) > 0 {
+		set(ERROR_STACK_FIELD, stack)
+	}
+	return merged
+}
+
+// The stack of the innermost error in err's chain with a StackTrace method
+func errorStack(err error) string {
+	stack := ""
+	for ; err != nil; err = errors.Unwrap(err) {
+		m := reflect.ValueOf(err).MethodByName("StackTrace")
+		if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+			continue
+		}
+		stack = fmt.Sprintf("%+v", m.Call(nil)[0].Interface())
+	}
+	return strings.TrimPrefix(stack, "\n")
+}
@@ -0,0 +1,37 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// An ErrorHandler is told about failures inside log4go that cannot be
+// returned to a caller, such as a writer losing its file or socket.
+// component names the failing part, e.g. "SocketLogWriter(host:port)".
+type ErrorHandler func(component string, err error)
+
+var errorHandler atomic.Value // ErrorHandler
+
+// Send internal errors to h instead of standard error; nil restores the
+// default.  h may be called from any goroutine and must not log through a
+// Logger whose writer is failing.
+func SetErrorHandler(h ErrorHandler) {
+	if h == nil {
+		h = stderrErrorHandler
+	}
+	errorHandler.Store(h)
+}
+
+func stderrErrorHandler(component string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", component, err)
+}
+
+// Report an internal error to the installed ErrorHandler
+func reportError(component string, err error) {
+	h, ok := errorHandler.Load().(ErrorHandler)
+	if !ok {
+		h = stderrErrorHandler
+	}
+	h(component, err)
+}
@@ -0,0 +1,136 @@
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Default time to wait before a failed primary is tried again
+	FAILOVER_PROBE_INTERVAL = 30 * time.Second
+)
+
+var errFailoverTimeout = errors.New("write timed out")
+
+// This log writer sends output to a primary writer and switches to a
+// secondary one (usually a local file) while the primary is failing.  The
+// primary is probed again every probe interval and used as soon as it works.
+type FailoverLogWriter struct {
+	primary   LogWriter
+	secondary LogWriter
+	timeout   time.Duration
+	probe     time.Duration
+
+	mu       sync.Mutex
+	failed   bool
+	failedAt time.Time
+	pending  bool // a timed out write to primary has not returned yet
+}
+
+// This creates a new FailoverLogWriter.  Primary errors are only noticed if
+// primary implements ErrorLogWriter or a timeout is set.
+func NewFailoverLogWriter(primary, secondary LogWriter) *FailoverLogWriter {
+	return &FailoverLogWriter{
+		primary:   primary,
+		secondary: secondary,
+		probe:     FAILOVER_PROBE_INTERVAL,
+	}
+}
+
+// Treat primary writes taking longer than timeout as failed (chainable).  Zero
+// disables the timeout.
+func (f *FailoverLogWriter) SetTimeout(timeout time.Duration) *FailoverLogWriter {
+	f.timeout = timeout
+	return f
+}
+
+// Set how long to stay on the secondary before probing the primary again
+// (chainable).
+func (f *FailoverLogWriter) SetProbeInterval(probe time.Duration) *FailoverLogWriter {
+	if probe <= 0 {
+		probe = FAILOVER_PROBE_INTERVAL
+	}
+	f.probe = probe
+	return f
+}
+
+// Active returns the writer records are currently sent to.
+func (f *FailoverLogWriter) Active() LogWriter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed {
+		return f.secondary
+	}
+	return f.primary
+}
+
+func (f *FailoverLogWriter) LogWrite(rec *LogRecord) {
+	f.mu.Lock()
+	usePrimary := !f.failed || (!f.pending && clockNow().Sub(f.failedAt) >= f.probe)
+	f.mu.Unlock()
+
+	if usePrimary {
+		err := f.writePrimary(rec)
+
+		f.mu.Lock()
+		wasFailed := f.failed
+		if err == nil {
+			f.failed = false
+		} else {
+			f.failed = true
+			f.failedAt = clockNow()
+		}
+		f.mu.Unlock()
+
+		if err == nil {
+			return
+		}
+		if !wasFailed {
+			reportError("FailoverLogWriter", fmt.Errorf("primary failed, switching to secondary: %v", err))
+		}
+	}
+
+	f.secondary.LogWrite(rec)
+}
+
+// Write to the primary, giving up after the timeout if one is set.  A write
+// that times out keeps the primary marked pending until it returns, so a
+// hung writer is never entered twice.
+func (f *FailoverLogWriter) writePrimary(rec *LogRecord) error {
+	if f.timeout <= 0 {
+		return logWriteErr(f.primary, rec)
+	}
+
+	done := make(chan error, 1)
+	f.mu.Lock()
+	f.pending = true
+	f.mu.Unlock()
+	go func() {
+		err := logWriteErr(f.primary, rec)
+		f.mu.Lock()
+		f.pending = false
+		f.mu.Unlock()
+		done <- err
+	}()
+
+	timer := time.NewTimer(f.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errFailoverTimeout
+	}
+}
+
+func (f *FailoverLogWriter) Close() {
+	f.primary.Close()
+	f.secondary.Close()
+}
+
+func (f *FailoverLogWriter) Flush() {
+	f.primary.Flush()
+	f.secondary.Flush()
+}
@@ -1,26 +1,57 @@
 package log4go
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
+
+	"golang.org/x/text/encoding"
 )
 
 const (
-	BUFFERSIZE = 4 * 1024 * 1024
+	BUFFERSIZE       = 4 * 1024 * 1024 // size at which a new file is started
+	WRITE_BUFFERSIZE = 64 * 1024       // records held in memory before a write
+	FLUSH_INTERVAL   = time.Second     // longest records are held in memory
 )
 
 type FileLogWriter struct {
+	seq      uint64 // files named so far; first for 64 bit alignment
 	filename string
 	path     string
 	bufsize  int
-	iow      *bytes.Buffer
 	format   string
+	formats  levelFormats // overrides format by level
+	encoder  Encoder      // used instead of format if set
 	compress bool
-	wg       sync.WaitGroup
+	cipher   *logCipher         // encrypts output if set
+	audit    *auditChain        // hash chains records if set
+	onRotate func(string)       // called with each completed file
+	header   string             // format of the first line of each file
+	trailer  string             // format of the last line of each file
+	nameTmpl *template.Template // names files instead of MakeFileName's default
+	archive  string             // directory completed files are moved to
+	shared   bool               // appends to one file under a lock
+	charset  encoding.Encoding  // converts records from UTF-8 if set
+	indent   string             // starts the continuation lines of records
+	rotate   time.Duration      // age at which a new file is started, if set
+	flushInt time.Duration      // FLUSH_INTERVAL if 0
+
+	mu   sync.Mutex    // guards the file and its buffer
+	file *os.File      // the file being written, or nil
+	bw   *bufio.Writer // buffers writes to file
+	name string        // path of file
+	size int           // bytes written to file
+	born time.Time     // when file was opened
+	stop chan struct{} // stops the flusher, nil while it is not running
+	wg   sync.WaitGroup
 }
 
 // This creates a new FileLogWriter
@@ -29,7 +60,6 @@ func NewFileLogWriter(fname string) *FileLogWriter {
 		filename: fname,
 		path:     "",
 		bufsize:  BUFFERSIZE,
-		iow:      nil,
 		format:   "[%T %D %Z] [%L] (%S) %M",
 		compress: false,
 	}
@@ -41,6 +71,53 @@ func (c *FileLogWriter) SetFormat(format string) *FileLogWriter {
 	return c
 }
 
+// Use format instead of the writer's format for records at lvl (chainable).
+// Must be called before the first log message is written.
+func (c *FileLogWriter) SetLevelFormat(lvl Level, format string) *FileLogWriter {
+	if c.formats == nil {
+		c.formats = make(levelFormats)
+	}
+	c.formats[lvl] = format
+	return c
+}
+
+// Start the continuation lines of multi-line records, e.g. stack traces,
+// with indent so they stay recognizable as part of the record (chainable).
+// Encoded records are left alone.  Must be called before the first log
+// message is written.
+func (c *FileLogWriter) SetIndent(indent string) *FileLogWriter {
+	c.indent = indent
+	return c
+}
+
+// Set an encoder to use instead of the format (chainable).  Must be called
+// before the first log message is written.
+func (c *FileLogWriter) SetEncoder(enc Encoder) *FileLogWriter {
+	c.encoder = enc
+	return c
+}
+
+// Set the formats of a line written at the start and at the end of every
+// file, e.g. "File opened at %D %T", or "" for none (chainable).  They are
+// not written in audit mode, as they would break the chain.  Must be called
+// before the first log message is written.
+func (c *FileLogWriter) SetHeadFoot(head, foot string) *FileLogWriter {
+	c.header, c.trailer = head, foot
+	return c
+}
+
+// Call fn with the path of each log file once it is complete and closed,
+// e.g. to upload or index it (chainable).  fn is called while records are
+// being written, so slow work should be handed off.  Must be called before
+// the first log message is written.
+func (c *FileLogWriter) OnRotate(fn func(oldPath string)) *FileLogWriter {
+	c.onRotate = fn
+	return c
+}
+
+// Set the size at which a new file is started, BUFFERSIZE if 0.  Records
+// are written through a buffer of WRITE_BUFFERSIZE bytes that is flushed
+// every FLUSH_INTERVAL.
 func (c *FileLogWriter) SetBufSize(bufsize int) {
 	if bufsize == 0 {
 		c.bufsize = BUFFERSIZE
@@ -50,6 +127,22 @@ func (c *FileLogWriter) SetBufSize(bufsize int) {
 	return
 }
 
+// Also start a new file once the current one is d old, e.g. every 24h, if d
+// is not 0 (chainable).  Must be called before the first log message is
+// written.
+func (c *FileLogWriter) SetRotateInterval(d time.Duration) *FileLogWriter {
+	c.rotate = d
+	return c
+}
+
+// Flush records held in memory every d instead of FLUSH_INTERVAL, if d is
+// not 0 (chainable).  Must be called before the first log message is
+// written.
+func (c *FileLogWriter) SetFlushInterval(d time.Duration) *FileLogWriter {
+	c.flushInt = d
+	return c
+}
+
 func (c *FileLogWriter) SetCompress(compress bool) {
 	c.compress = compress
 	return
@@ -58,46 +151,259 @@ func (c *FileLogWriter) SetCompress(compress bool) {
 func (c *FileLogWriter) SetPath(path string) {
 	c.path = filepath.Clean(path) + "/"
 	if err := os.MkdirAll(path, 0777); err != nil {
-		fmt.Fprint(os.Stderr, "can not create mem log path at ", path, err)
+		reportError("FileLogWriter("+path+")", err)
 	}
 	return
 }
 
+// Move every file once complete out of the path into dir, which may be on
+// another filesystem, so that the path holds the file being written only.
+func (c *FileLogWriter) SetArchiveDir(dir string) {
+	c.archive = filepath.Clean(dir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		reportError("FileLogWriter("+dir+")", err)
+	}
+	return
+}
+
+// Append to the single file path+filename, which other processes may write
+// to as well, instead of starting a new file every bufsize bytes
+// (chainable).  Records are written under an advisory lock (flock, or
+// LockFileEx on Windows) and never split between writes, so records from
+// different processes do not interleave.  Files are then never complete:
+// headers, archiving, OnRotate and the name template do not apply, and
+// encryption and audit mode cannot be used.
+// Must be called before the first log message is written.
+func (c *FileLogWriter) SetShared(shared bool) *FileLogWriter {
+	c.shared = shared
+	return c
+}
+
+// Close completes and closes the file being written and stops flushing.
 func (c *FileLogWriter) Close() {
-	c.wg.Wait()
+	c.mu.Lock()
+	c.closeFile()
+	stop := c.stop
+	c.stop = nil
+	c.mu.Unlock()
 
-	if c.iow == nil || c.iow.Len() == 0 {
+	if stop != nil {
+		close(stop)
+		c.wg.Wait()
+	}
+}
+
+// Flush writes out the records buffered in memory.
+func (c *FileLogWriter) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bw == nil {
 		return
 	}
+	if err := c.bw.Flush(); err != nil {
+		reportError("FileLogWriter("+c.name+")", err)
+		c.dropFile()
+	}
+}
 
-	sfilename := c.MakeFileName()
-	fd, err := os.OpenFile(sfilename, os.O_WRONLY|os.O_CREATE, 0660)
+// Flush the buffer every flush interval until stop is closed
+func (c *FileLogWriter) flusher(stop chan struct{}) {
+	defer c.wg.Done()
+	every := c.flushInt
+	if every <= 0 {
+		every = FLUSH_INTERVAL
+	}
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			c.Flush()
+		}
+	}
+}
 
-	defer fd.Close()
+// Open a new log file, or the shared one, starting the flusher if needed
+func (c *FileLogWriter) openFile() error {
+	name := c.path + c.filename
+	if !c.shared {
+		name = c.MakeFileName()
+	}
+	fd, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "FileLogWriter(%s): %s\n", sfilename, err)
+		return err
+	}
+
+	var w io.Writer = fd
+	switch {
+	case c.shared:
+		w = lockedWriter{fd}
+	case c.cipher != nil:
+		w = encryptedWriter{c.cipher, fd}
+	}
+	c.file, c.bw, c.name, c.size, c.born = fd, bufio.NewWriterSize(w, WRITE_BUFFERSIZE), name, 0, clockNow()
+	if c.stop == nil {
+		c.stop = make(chan struct{})
+		c.wg.Add(1)
+		go c.flusher(c.stop)
+	}
+
+	switch {
+	case c.shared:
+	case c.audit != nil:
+		return c.write(c.audit.start())
+	case len(c.header) > 0:
+		return c.write(transcode(c.charset, FormatLogRecord(c.header, &LogRecord{Created: clockNow()})))
+	}
+	return nil
+}
+
+// Buffer s, first flushing the buffer if s does not fit, so that no record
+// is split between two writes
+func (c *FileLogWriter) write(s string) error {
+	if c.bw.Buffered() > 0 && c.bw.Available() < len(s) {
+		if err := c.bw.Flush(); err != nil {
+			return err
+		}
+	}
+	n, err := c.bw.Write([]byte(s))
+	c.size += n
+	return err
+}
+
+// Complete and close the file being written, if any, and pass it on
+func (c *FileLogWriter) closeFile() {
+	if c.file == nil {
+		return
+	}
+	var err error
+	switch {
+	case c.shared:
+	case c.audit != nil:
+		err = c.write(c.audit.sign())
+	case len(c.trailer) > 0:
+		err = c.write(transcode(c.charset, FormatLogRecord(c.trailer, &LogRecord{Created: clockNow()})))
+	}
+	if ferr := c.bw.Flush(); err == nil {
+		err = ferr
+	}
+	c.file.Sync()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	sfilename := c.name
+	c.file, c.bw = nil, nil
+	if err != nil {
+		reportError("FileLogWriter("+sfilename+")", err)
+		return
+	}
+	if c.shared {
 		return
 	}
 
-	tmp := c.iow
-	c.iow = bytes.NewBuffer(make([]byte, 0, c.bufsize))
+	if len(c.archive) > 0 {
+		if sfilename, err = archiveFile(sfilename, c.archive); err != nil {
+			reportError("FileLogWriter("+c.archive+")", err)
+			return
+		}
+	}
+	if c.onRotate != nil {
+		c.onRotate(sfilename)
+	}
+}
 
-	tmp.WriteTo(fd)
-	fd.Sync()
-	time.Sleep(200 * time.Millisecond)
+// Give up on a file that failed; the next record starts a new one
+func (c *FileLogWriter) dropFile() {
+	c.file.Close()
+	c.file, c.bw = nil, nil
 }
 
-func (c *FileLogWriter) Flush() {
-	c.Close()
+// Writes to a shared file while holding its lock
+type lockedWriter struct {
+	f *os.File
 }
 
-// Set the logging format (chainable).  Must be called before the first log
-// message is written.
-//example-20160314160255-814856400.log
+func (l lockedWriter) Write(p []byte) (int, error) {
+	if err := lockFile(l.f); err != nil {
+		return 0, err
+	}
+	defer unlockFile(l.f)
+	return l.f.Write(p)
+}
+
+// Move a file into dir, copying it if dir is on another filesystem, and
+// return its new path
+func archiveFile(src, dir string) (string, error) {
+	dst := filepath.Join(dir, filepath.Base(src))
+	if os.Rename(src, dst) == nil {
+		return dst, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return src, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return src, err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return src, err
+	}
+	return dst, os.Remove(src)
+}
+
+// The values a file name template is executed with
+type FileNameData struct {
+	Name string    // the name the writer was created with
+	Date string    // e.g. 20160314
+	Time string    // e.g. 160255
+	Nano int       // nanoseconds of the second
+	Host string    // host name
+	PID  int       // process ID
+	Seq  uint64    // number of the file, from 1
+	Now  time.Time // for other layouts, e.g. {{.Now.Format "2006-01"}}
+}
+
+// Name files with a text/template executed with a FileNameData instead of
+// the default name-timestamp-nanoseconds.log, e.g.
+// "{{.Name}}-{{.Host}}-{{.Date}}-{{.Seq}}.log".  The names must differ from
+// one file to the next, so templates without .Seq should include the time
+// down to the nanosecond.  Must be called before the first log message is
+// written.
+func (c *FileLogWriter) SetFileNameTemplate(text string) error {
+	tmpl, err := template.New(c.filename).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+	c.nameTmpl = tmpl
+	return nil
+}
+
+// The name of the next file, by default e.g.
+// example-20160314160255-814856400.log
 func (c *FileLogWriter) MakeFileName() string {
+	seq := atomic.AddUint64(&c.seq, 1)
+	if c.nameTmpl != nil {
+		name, err := c.templateFileName(seq)
+		if err == nil {
+			return c.path + name
+		}
+		reportError("FileLogWriter("+c.filename+")", err)
+	}
+
 	out := bytes.NewBuffer(make([]byte, 0, 64))
-	t := time.Now()
-	//fmt.Println(time.Now().String())
+	t := clockNow()
 	out.WriteString(fmt.Sprintf("%04d%02d%02d", t.Year(), t.Month(), t.Day()))
 	out.WriteString(fmt.Sprintf("%02d%02d%02d", t.Hour(), t.Minute(), t.Second()))
 	out.WriteString(fmt.Sprintf("-%d", t.Nanosecond()))
@@ -105,30 +411,56 @@ func (c *FileLogWriter) MakeFileName() string {
 	return sfilename
 }
 
+func (c *FileLogWriter) templateFileName(seq uint64) (string, error) {
+	t := clockNow()
+	host, _ := HostMetadata()[HOST_FIELD].(string)
+	data := &FileNameData{
+		Name: c.filename,
+		Date: t.Format("20060102"),
+		Time: t.Format("150405"),
+		Nano: t.Nanosecond(),
+		Host: host,
+		PID:  os.Getpid(),
+		Seq:  seq,
+		Now:  t,
+	}
+	var b strings.Builder
+	if err := c.nameTmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
 func (c *FileLogWriter) LogWrite(rec *LogRecord) {
-	s := FormatLogRecord(c.format, rec)
-	if c.iow == nil {
-		c.iow = bytes.NewBuffer(make([]byte, 0, c.bufsize))
+	s := encodeRecord(c.encoder, c.formats.get(c.format, rec.Level), rec)
+	if c.encoder == nil {
+		s = indentLines(s, c.indent)
 	}
-	c.iow.WriteString(s)
+	s = transcode(c.charset, s)
 
-	if c.iow.Len() > c.bufsize {
-		tmp := c.iow
-		c.iow = bytes.NewBuffer(make([]byte, 0, c.bufsize))
-		c.wg.Add(1)
-		go func() {
-			sfilename := c.MakeFileName()
-
-			fd, err := os.OpenFile(sfilename, os.O_WRONLY|os.O_CREATE, 0660)
-			defer fd.Close()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "FileLogWriter(%s): %s\n", sfilename, err)
-				return
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file != nil && !c.shared && c.rotate > 0 && clockNow().Sub(c.born) >= c.rotate {
+		c.closeFile()
+	}
+	if c.file == nil {
+		if err := c.openFile(); err != nil {
+			reportError("FileLogWriter("+c.filename+")", err)
+			if c.file != nil {
+				c.dropFile()
 			}
-
-			tmp.WriteTo(fd)
-			fd.Sync()
-			c.wg.Done()
-		}()
+			return
+		}
+	}
+	if c.audit != nil {
+		s = c.audit.link(s)
+	}
+	if err := c.write(s); err != nil {
+		reportError("FileLogWriter("+c.name+")", err)
+		c.dropFile()
+		return
+	}
+	if !c.shared && c.size > c.bufsize {
+		c.closeFile()
 	}
 }
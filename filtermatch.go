@@ -0,0 +1,60 @@
+package log4go
+
+import (
+	"regexp"
+)
+
+// Only write records whose message matches re (chainable).  A nil re removes
+// the restriction.  Must be called before the first log message is written.
+func (f *Filter) SetInclude(re *regexp.Regexp) *Filter {
+	f.include = re
+	return f
+}
+
+// Drop records whose message matches re (chainable).  A nil re removes the
+// restriction.  Must be called before the first log message is written.
+func (f *Filter) SetExclude(re *regexp.Regexp) *Filter {
+	f.exclude = re
+	return f
+}
+
+// Also match the include and exclude expressions against the record source
+// (chainable): a record is included if either matches, and excluded if either
+// matches.
+func (f *Filter) SetMatchSource(match bool) *Filter {
+	f.matchSource = match
+	return f
+}
+
+// Only write records for which fn returns true (chainable), e.g. those with
+// a given field value or logged during office hours.  A record must pass
+// every predicate added.  fn may be called from several goroutines at once.
+// Must be called before the first log message is written.
+func (f *Filter) AddPredicate(fn func(rec *LogRecord) bool) *Filter {
+	f.predicates = append(f.predicates, fn)
+	return f
+}
+
+// Reports whether rec passes the include and exclude expressions and the
+// predicates
+func (f *Filter) matches(rec *LogRecord) bool {
+	if f.include != nil && !f.matchOne(f.include, rec) {
+		return false
+	}
+	if f.exclude != nil && f.matchOne(f.exclude, rec) {
+		return false
+	}
+	for _, fn := range f.predicates {
+		if !fn(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) matchOne(re *regexp.Regexp, rec *LogRecord) bool {
+	if re.MatchString(rec.Message) {
+		return true
+	}
+	return f.matchSource && re.MatchString(rec.Source)
+}
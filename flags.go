@@ -0,0 +1,88 @@
+package log4go
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The logging options of a command line, set by the flags RegisterFlags
+// adds.  The fields may also be set directly.
+type Flags struct {
+	Level  string // -log.level: lowest level logged, INFO if empty
+	File   string // -log.file: file to write to instead of standard output
+	Format string // -log.format: format string or "json", the writer's own if empty
+	Config string // -log.config: configuration file replacing the others
+}
+
+// RegisterFlags adds -log.level, -log.file, -log.format and -log.config to
+// fs, or to the program's command line if fs is nil, so every program can be
+// told how to log in the same way.  Apply the options once the flags are
+// parsed:
+//
+//	lf := log4go.RegisterFlags(nil)
+//	flag.Parse()
+//	if err := lf.Apply(log4go.GetLogger("")); err != nil {
+//		fmt.Fprintln(os.Stderr, err)
+//		os.Exit(2)
+//	}
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	f := new(Flags)
+	fs.StringVar(&f.Level, "log.level", "", "lowest level logged: DEBUG, TRACE, INFO, WARNING, ERROR or CRITICAL (default INFO)")
+	fs.StringVar(&f.File, "log.file", "", "write the log to files named after this, e.g. logs/app.log, instead of standard output")
+	fs.StringVar(&f.Format, "log.format", "", "format string of the log lines, or json")
+	fs.StringVar(&f.Config, "log.config", "", "load logging from this XML, JSON or Toml configuration file instead")
+	return f
+}
+
+// Apply replaces the filters of log with those the options ask for: the
+// filters of the configuration file given with -log.config, or else a
+// "file" filter writing to -log.file, named as for NewProductionLogger, or
+// a "stdout" filter writing to standard output.  The filters are kept if the
+// options are unusable.
+func (f *Flags) Apply(log *Logger) error {
+	if len(f.Config) > 0 {
+		if len(f.Level) > 0 || len(f.File) > 0 || len(f.Format) > 0 {
+			return errors.New("-log.config cannot be combined with -log.level, -log.file or -log.format")
+		}
+		return log.ReloadConfig(f.Config)
+	}
+
+	lvl := INFO
+	if len(f.Level) > 0 {
+		var ok bool
+		if lvl, ok = ParseLevel(f.Level); !ok {
+			return fmt.Errorf("unknown -log.level %q", f.Level)
+		}
+	}
+	json := strings.ToLower(f.Format) == "json"
+
+	if len(f.File) == 0 {
+		w := NewConsoleLogWriter()
+		if json {
+			w.SetEncoder(JSONEncoder{})
+		} else if len(f.Format) > 0 {
+			w.SetFormat(f.Format)
+		}
+		log.replaceFilters(map[string]*Filter{"stdout": NewFilter(lvl, w)})
+		return nil
+	}
+
+	dir, name := filepath.Split(f.File)
+	w := NewFileLogWriter(strings.TrimSuffix(name, ".log"))
+	if len(dir) > 0 {
+		w.SetPath(dir)
+	}
+	if json {
+		w.SetEncoder(JSONEncoder{})
+	} else if len(f.Format) > 0 {
+		w.SetFormat(f.Format)
+	}
+	log.replaceFilters(map[string]*Filter{"file": NewFilter(lvl, w)})
+	return nil
+}
@@ -0,0 +1,132 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Longest a SocketLogWriter's Ping waits to connect
+const PING_TIMEOUT = 5 * time.Second
+
+// Ping w if it is a HealthChecker; other writers are taken to work
+func ping(w LogWriter) error {
+	if hc, ok := w.(HealthChecker); ok {
+		return hc.Ping()
+	}
+	return nil
+}
+
+// Health pings the writer of each filter, returning the errors by filter
+// name, nil for the writers that work or cannot tell.
+func (log *Logger) Health() map[string]error {
+	filters := log.load().filters
+	health := make(map[string]error, len(filters))
+	for name, filt := range filters {
+		health[name] = ping(filt.LogWriter)
+	}
+	return health
+}
+
+// Healthy reports whether every filter's writer works.
+func (log *Logger) Healthy() bool {
+	for _, err := range log.Health() {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Ping checks that the file being written is still there and that a file can
+// be created next to it.
+func (c *FileLogWriter) Ping() error {
+	c.mu.Lock()
+	name, open := c.name, c.file != nil
+	c.mu.Unlock()
+
+	dir := filepath.Dir(c.path + c.filename)
+	if open {
+		if _, err := os.Stat(name); err != nil {
+			return err
+		}
+		dir = filepath.Dir(name)
+	}
+	fd, err := ioutil.TempFile(dir, ".log4go-ping-")
+	if err != nil {
+		return err
+	}
+	fd.Close()
+	return os.Remove(fd.Name())
+}
+
+// Ping opens a connection of its own, as the writer's may only be used while
+// writing, to check that the server can be reached.
+func (s *SocketLogWriter) Ping() error {
+	dialer := &net.Dialer{Timeout: PING_TIMEOUT}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, s.proto, s.hostport, s.tls)
+	} else {
+		conn, err = dialer.Dial(s.proto, s.hostport)
+	}
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Ping reports the first writer that does not work.
+func (t *TeeLogWriter) Ping() error {
+	for i, w := range t.writers {
+		if err := ping(w); err != nil {
+			return fmt.Errorf("writer %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Ping fails only if neither writer works.
+func (f *FailoverLogWriter) Ping() error {
+	err := ping(f.primary)
+	if err == nil {
+		return nil
+	}
+	if serr := ping(f.secondary); serr != nil {
+		return fmt.Errorf("primary: %v; secondary: %v", err, serr)
+	}
+	return nil
+}
+
+func (a *AsyncLogWriter) Ping() error {
+	return ping(a.writer)
+}
+
+func (d *DedupLogWriter) Ping() error {
+	return ping(d.writer)
+}
+
+// Ping fails while the circuit is open.
+func (b *CircuitBreakerLogWriter) Ping() error {
+	if b.Stats().State == BreakerOpen {
+		return ErrCircuitOpen
+	}
+	return ping(b.writer)
+}
+
+// Ping fails while the writer refuses records, which then wait in the log.
+func (w *WALLogWriter) Ping() error {
+	w.mu.Lock()
+	failing := w.failing
+	w.mu.Unlock()
+	if failing {
+		return errors.New("delivery failing, records kept in the write-ahead log")
+	}
+	return ping(w.writer)
+}
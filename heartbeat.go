@@ -0,0 +1,57 @@
+package log4go
+
+import (
+	"time"
+)
+
+// When the process started, for the uptime in heartbeats
+var processStart = time.Now()
+
+// Heartbeat logs "still alive" at INFO every interval, to the filter with
+// the given name or, if it is empty, to all filters, so monitoring can tell
+// a hung process from a quiet one by the lack of them.  Each heartbeat has
+// the process's uptime and the counters of Stats as fields.  Call the
+// returned function to stop it.
+func (log *Logger) Heartbeat(interval time.Duration, filter string) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				log.heartbeat(filter)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (log *Logger) heartbeat(filter string) {
+	if log.skip(INFO) {
+		return
+	}
+	stats := log.Stats()
+	rec := &LogRecord{
+		Level:   INFO,
+		Created: clockNow(),
+		Source:  "heartbeat",
+		Message: "still alive",
+		Fields: Fields{
+			"uptime":     time.Since(processStart).Round(time.Second),
+			"enqueued":   stats.Enqueued,
+			"written":    stats.Written,
+			"dropped":    stats.Dropped,
+			"suppressed": stats.Suppressed,
+		},
+	}
+	if len(filter) > 0 {
+		log.dispatchTo(filter, rec)
+	} else {
+		log.dispatch(rec)
+	}
+}
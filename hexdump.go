@@ -0,0 +1,23 @@
+package log4go
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// LogHexDump logs data as one record with label and the length of data on
+// its first line, followed by a canonical dump of offset, hex bytes and
+// ASCII, as hexdump -C prints it, e.g. for debugging a protocol:
+//
+//	log.LogHexDump(DEBUG, "handshake", buf[:n])
+func (log *Logger) LogHexDump(lvl Level, label string, data []byte) {
+	if log.skip(lvl) {
+		return
+	}
+	msg := fmt.Sprintf("%s (%d bytes)", label, len(data))
+	if len(data) > 0 {
+		msg += "\n" + strings.TrimSuffix(hex.Dump(data), "\n")
+	}
+	log.intLog(2, lvl, nil, msg)
+}
@@ -0,0 +1,91 @@
+package log4go
+
+import (
+	"sync/atomic"
+)
+
+// A Hook is told about every record a Logger dispatches and about the outcome
+// of every write, for metrics, enrichment or alerting without a LogWriter.
+type Hook interface {
+	// Called before the record is handed to the filters; may modify it.
+	BeforeDispatch(rec *LogRecord)
+
+	// Called from the filter goroutine after its writer has written rec.
+	// err is only reported by writers implementing ErrorLogWriter.
+	AfterWrite(filter string, rec *LogRecord, err error)
+}
+
+// HookFuncs turns a pair of functions into a Hook; either may be nil.
+type HookFuncs struct {
+	Before func(rec *LogRecord)
+	After  func(filter string, rec *LogRecord, err error)
+}
+
+func (h HookFuncs) BeforeDispatch(rec *LogRecord) {
+	if h.Before != nil {
+		h.Before(rec)
+	}
+}
+
+func (h HookFuncs) AfterWrite(filter string, rec *LogRecord, err error) {
+	if h.After != nil {
+		h.After(filter, rec, err)
+	}
+}
+
+// Add a hook to the logger and all of its filters.  Filters added later with
+// AddFilter or from a configuration get it too.  Returns the logger for
+// chaining.
+func (log *Logger) AddHook(h Hook) *Logger {
+	log.update(false, func(st *loggerState) {
+		st.hooks = append(st.hooks[:len(st.hooks):len(st.hooks)], h)
+		for name, filt := range st.filters {
+			filt.setHooks(name, st.hooks)
+		}
+	})
+	return log
+}
+
+// Give a filter the logger's hooks under its name
+func (f *Filter) setHooks(name string, hooks []Hook) {
+	f.hooks.Store(filterHooks{name, hooks})
+}
+
+type filterHooks struct {
+	name  string
+	hooks []Hook
+}
+
+// Write records to the writer, in one call if it is a BulkLogWriter
+func (f *Filter) writeBatch(recs []*LogRecord) {
+	bw, ok := f.LogWriter.(BulkLogWriter)
+	if !ok || len(recs) == 1 {
+		for _, rec := range recs {
+			f.write(rec)
+		}
+		return
+	}
+
+	bw.BulkLogWrite(recs)
+	atomic.AddUint64(&f.written, uint64(len(recs)))
+	fh, _ := f.hooks.Load().(filterHooks)
+	for _, h := range fh.hooks {
+		for _, rec := range recs {
+			h.AfterWrite(fh.name, rec, nil)
+		}
+	}
+}
+
+// Write rec to the writer, telling the hooks how it went
+func (f *Filter) write(rec *LogRecord) {
+	atomic.AddUint64(&f.written, 1)
+	fh, _ := f.hooks.Load().(filterHooks)
+	if len(fh.hooks) == 0 {
+		f.LogWrite(rec)
+		return
+	}
+	err := logWriteErr(f.LogWriter, rec)
+	for _, h := range fh.hooks {
+		h.AfterWrite(fh.name, rec, err)
+	}
+}
@@ -0,0 +1,114 @@
+package log4go
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTPDumpOptions configure LogHTTPRequest and LogHTTPResponse.
+type HTTPDumpOptions struct {
+	// The headers to log; all of them if nil.
+	Headers []string
+
+	// Headers whose values are replaced with REDACTED, besides
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie, which
+	// always are.
+	Redact []string
+
+	// Log at most this many bytes of the body, none if 0.  The body is read
+	// that far and put back, so the request or response can still be used.
+	MaxBody int
+}
+
+// Headers never logged in the clear
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// LogHTTPRequest logs r at DEBUG as one record: the request line, then its
+// headers and, if opts.MaxBody is set, the start of its body, with the
+// method and url as fields.  Use it to debug clients before sending a
+// request, or handlers when receiving one.
+func (log *Logger) LogHTTPRequest(r *http.Request, opts HTTPDumpOptions) {
+	if log.skip(DEBUG) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(r.Method + " " + r.URL.String() + " " + r.Proto)
+	dumpHeader(&b, r.Header, opts)
+	if opts.MaxBody > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = dumpBody(&b, r.Body, opts.MaxBody)
+	}
+	log.intLog(2, DEBUG, Fields{"method": r.Method, "url": r.URL.String()}, b.String())
+}
+
+// LogHTTPResponse logs resp at DEBUG as one record: the status line, then
+// its headers and, if opts.MaxBody is set, the start of its body, with the
+// status and, if resp.Request is set, the method and url as fields.
+func (log *Logger) LogHTTPResponse(resp *http.Response, opts HTTPDumpOptions) {
+	if log.skip(DEBUG) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(resp.Proto + " " + resp.Status)
+	dumpHeader(&b, resp.Header, opts)
+	if opts.MaxBody > 0 && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = dumpBody(&b, resp.Body, opts.MaxBody)
+	}
+	fields := Fields{"status": resp.StatusCode}
+	if req := resp.Request; req != nil {
+		fields["method"] = req.Method
+		fields["url"] = req.URL.String()
+	}
+	log.intLog(2, DEBUG, fields, b.String())
+}
+
+// Write the selected headers, one per line and sorted, masking secrets
+func dumpHeader(b *strings.Builder, h http.Header, opts HTTPDumpOptions) {
+	names := opts.Headers
+	if names == nil {
+		for name := range h {
+			names = append(names, name)
+		}
+	}
+	names = append([]string(nil), names...)
+	for i, name := range names {
+		names[i] = http.CanonicalHeaderKey(name)
+	}
+	sort.Strings(names)
+
+	redact := make(map[string]bool)
+	for _, name := range append(redactedHeaders, opts.Redact...) {
+		redact[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range names {
+		for _, v := range h[name] {
+			if redact[name] {
+				v = REDACTED
+			}
+			b.WriteString("\n" + name + ": " + v)
+		}
+	}
+}
+
+// Write at most max bytes of body and return a body reading all of it again
+func dumpBody(b *strings.Builder, body io.ReadCloser, max int) io.ReadCloser {
+	head, err := ioutil.ReadAll(io.LimitReader(body, int64(max)+1))
+	b.WriteString("\n\n")
+	if len(head) > max {
+		b.Write(head[:max])
+		b.WriteString("…(truncated at " + strconv.Itoa(max) + " bytes)")
+	} else {
+		b.Write(head)
+	}
+	if err != nil {
+		b.WriteString("…(read error: " + err.Error() + ")")
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), body), body}
+}
@@ -0,0 +1,146 @@
+package log4go
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How HTTPMiddleware words the message of an access log record
+type HTTPLogFormat int
+
+const (
+	HTTPFormatShort    HTTPLogFormat = iota // "GET /path 200 512B 1.2ms"
+	HTTPFormatCommon                        // NCSA Common Log Format
+	HTTPFormatCombined                      // Common plus referer and user agent
+)
+
+// HTTPOptions configure HTTPMiddleware.
+type HTTPOptions struct {
+	// Only write access logs to the filter with this name; all filters get
+	// them if empty.
+	Filter string
+
+	// The message format.  The fields method, path, uri, proto, status,
+	// bytes, latency, remote and, if known, user, referer, useragent and
+	// request_id (see RequestIDMiddleware) are attached in any case, so the records can also be written with
+	// FORMAT_COMMON or FORMAT_COMBINED.
+	Format HTTPLogFormat
+}
+
+// HTTPMiddleware returns a function wrapping an http.Handler so that every
+// request it serves is logged to log once the response is written: at INFO,
+// or at ERROR for 5xx statuses.
+func HTTPMiddleware(log *Logger, opts HTTPOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := clockNow()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			log.logRequest(opts, r, sw, start)
+		})
+	}
+}
+
+func (log *Logger) logRequest(opts HTTPOptions, r *http.Request, sw *statusWriter, start time.Time) {
+	lvl := INFO
+	if sw.status >= 500 {
+		lvl = ERROR
+	}
+	if log.skip(lvl) {
+		return
+	}
+
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	latency := clockNow().Sub(start)
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	rec := &LogRecord{
+		Level:   lvl,
+		Created: start,
+		Source:  "http",
+		Fields: Fields{
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"uri":     r.RequestURI,
+			"proto":   r.Proto,
+			"status":  status,
+			"bytes":   sw.bytes,
+			"latency": latency,
+			"remote":  remote,
+		},
+	}
+	if name, _, ok := r.BasicAuth(); ok && len(name) > 0 {
+		rec.Fields["user"] = name
+	}
+	if referer := r.Referer(); len(referer) > 0 {
+		rec.Fields["referer"] = referer
+	}
+	if agent := r.UserAgent(); len(agent) > 0 {
+		rec.Fields["useragent"] = agent
+	}
+	if id := RequestID(r.Context()); len(id) > 0 {
+		rec.Fields[REQUEST_ID_FIELD] = id
+	}
+
+	switch opts.Format {
+	case HTTPFormatCommon:
+		rec.Message = strings.TrimSuffix(FormatLogRecord(FORMAT_COMMON, rec), "\n")
+	case HTTPFormatCombined:
+		rec.Message = strings.TrimSuffix(FormatLogRecord(FORMAT_COMBINED, rec), "\n")
+	default:
+		rec.Message = fmt.Sprintf("%s %s %d %dB %s", r.Method, r.URL.Path, status, sw.bytes, latency)
+	}
+
+	if len(opts.Filter) > 0 {
+		log.dispatchTo(opts.Filter, rec)
+	} else {
+		log.dispatch(rec)
+	}
+}
+
+// Records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := sw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("log4go: response writer does not support hijacking")
+}
@@ -0,0 +1,108 @@
+package log4go
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Default time an HTTPLogWriter waits for a request to be answered
+const HTTP_TIMEOUT = 10 * time.Second
+
+// This log writer sends each record to an HTTP endpoint in a POST request,
+// e.g. the ingestion API of a log collector, as JSON unless given an
+// encoder.  A response other than 2xx is an error.
+type HTTPLogWriter struct {
+	url     string
+	client  *http.Client
+	encoder Encoder
+	header  http.Header
+}
+
+// This creates a new HTTPLogWriter posting to url.
+func NewHTTPLogWriter(url string) *HTTPLogWriter {
+	return &HTTPLogWriter{
+		url:    url,
+		client: &http.Client{Timeout: HTTP_TIMEOUT},
+		header: make(http.Header),
+	}
+}
+
+// Set an encoder to use instead of JSON (chainable), e.g. a
+// ProtobufEncoder; the Content-Type follows it.  Must be called before the
+// first log message is written.
+func (w *HTTPLogWriter) SetEncoder(enc Encoder) *HTTPLogWriter {
+	w.encoder = enc
+	return w
+}
+
+// Connect with TLS using cfg (chainable), e.g. from LoadTLSConfig.  Must be
+// called before the first log message is written.
+func (w *HTTPLogWriter) SetTLS(cfg *tls.Config) *HTTPLogWriter {
+	w.client.Transport = &http.Transport{TLSClientConfig: cfg, Proxy: http.ProxyFromEnvironment}
+	return w
+}
+
+// Send a header with every request (chainable), e.g. Authorization.  Must
+// be called before the first log message is written.
+func (w *HTTPLogWriter) SetHeader(key, value string) *HTTPLogWriter {
+	w.header.Set(key, value)
+	return w
+}
+
+// The Content-Type of the records
+func (w *HTTPLogWriter) contentType() string {
+	switch w.encoder.(type) {
+	case nil, JSONEncoder:
+		return "application/json"
+	case ProtobufEncoder:
+		return "application/x-protobuf"
+	case MsgpackEncoder:
+		return "application/msgpack"
+	}
+	return "application/octet-stream"
+}
+
+func (w *HTTPLogWriter) LogWrite(rec *LogRecord) {
+	if err := w.LogWriteErr(rec); err != nil {
+		reportError("HTTPLogWriter("+w.url+")", err)
+	}
+}
+
+func (w *HTTPLogWriter) LogWriteErr(rec *LogRecord) error {
+	enc := w.encoder
+	if enc == nil {
+		enc = JSONEncoder{}
+	}
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(enc.Encode(nil, rec)))
+	if err != nil {
+		return err
+	}
+	for key, vals := range w.header {
+		req.Header[key] = vals
+	}
+	req.Header.Set("Content-Type", w.contentType())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Read the body so the connection is reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+func (w *HTTPLogWriter) Close() {
+	w.client.CloseIdleConnections()
+}
+
+func (w *HTTPLogWriter) Flush() {
+}
@@ -0,0 +1,71 @@
+package log4go
+
+import (
+	"io"
+	"sync"
+)
+
+// This log writer writes formatted records to any io.Writer, e.g. a pipe, a
+// network connection, a bytes.Buffer or a rotating file from another package.
+// Records are written synchronously, each with a single Write call.
+type IOLogWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	format  string
+	formats levelFormats // overrides format by level
+	encoder Encoder      // used instead of format if set
+}
+
+// This creates a new IOLogWriter writing records to w in the given format.
+// The writer remains the caller's: Close flushes it but does not close it.
+func NewIOLogWriter(w io.Writer, format string) *IOLogWriter {
+	return &IOLogWriter{w: w, format: format}
+}
+
+// Use format instead of the writer's format for records at lvl (chainable).
+// Must be called before the first log message is written.
+func (c *IOLogWriter) SetLevelFormat(lvl Level, format string) *IOLogWriter {
+	if c.formats == nil {
+		c.formats = make(levelFormats)
+	}
+	c.formats[lvl] = format
+	return c
+}
+
+// Set an encoder to use instead of the format (chainable).  Must be called
+// before the first log message is written.
+func (c *IOLogWriter) SetEncoder(enc Encoder) *IOLogWriter {
+	c.encoder = enc
+	return c
+}
+
+func (c *IOLogWriter) LogWrite(rec *LogRecord) {
+	if err := c.LogWriteErr(rec); err != nil {
+		reportError("IOLogWriter", err)
+	}
+}
+
+func (c *IOLogWriter) LogWriteErr(rec *LogRecord) error {
+	s := encodeRecord(c.encoder, c.formats.get(c.format, rec.Level), rec)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := io.WriteString(c.w, s)
+	return err
+}
+
+// Flush flushes the writer if it has a Flush method, as bufio.Writer does.
+func (c *IOLogWriter) Flush() {
+	f, ok := c.w.(interface{ Flush() error })
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := f.Flush(); err != nil {
+		reportError("IOLogWriter", err)
+	}
+}
+
+func (c *IOLogWriter) Close() {
+	c.Flush()
+}
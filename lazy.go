@@ -0,0 +1,47 @@
+package log4go
+
+// Lazy is a log argument that is only computed if the record is written by
+// some filter, for values that are expensive to build:
+//
+//	log.Debug("state: %v", Lazy(func() interface{} { return dumpState() }))
+//
+// A plain func() string argument is treated the same way.
+type Lazy func() interface{}
+
+// Replace lazy arguments by their values.  args is returned as is if there
+// are none.
+func resolveLazy(args []interface{}) []interface{} {
+	var resolved []interface{}
+	for i, arg := range args {
+		var value interface{}
+		switch fn := arg.(type) {
+		case Lazy:
+			value = fn()
+		case func() string:
+			value = fn()
+		default:
+			if resolved != nil {
+				resolved[i] = arg
+			}
+			continue
+		}
+		if resolved == nil {
+			resolved = make([]interface{}, len(args))
+			copy(resolved, args[:i])
+		}
+		resolved[i] = value
+	}
+	if resolved == nil {
+		return args
+	}
+	return resolved
+}
+
+// Send a log message whose text is only built, by calling closure, if the
+// record is written by some filter.
+func (log *Logger) Logc(lvl Level, closure func() string) {
+	if log.skip(lvl) {
+		return
+	}
+	log.intLog(2, lvl, nil, "%s", closure)
+}
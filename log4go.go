@@ -17,7 +17,11 @@ import (
 	"fmt"
 
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"time"
 )
@@ -53,7 +57,7 @@ var (
 )
 
 func (l Level) String() string {
-	if l < 0 || int(l) > len(levelStrings) {
+	if l < 0 || int(l) >= len(levelStrings) {
 		return "UNKNOWN"
 	}
 	return levelStrings[int(l)]
@@ -64,16 +68,30 @@ var (
 	// LogBufferLength specifies how many log messages a particular log4go
 	// logger can buffer at a time before writing them.
 	LogBufferLength = 32
+
+	// LogBatchLength is the most queued messages a filter hands to a
+	// BulkLogWriter at once.
+	LogBatchLength = 64
 )
 
 /****** LogRecord ******/
 
+// Fields are structured key/value pairs attached to a LogRecord
+type Fields map[string]interface{}
+
 // A LogRecord contains all of the pertinent information for each message
 type LogRecord struct {
-	Level   Level     // The log level
-	Created time.Time // The time at which the log message was created (nanoseconds)
-	Source  string    // The message source
-	Message string    // The log message
+	Level   Level           // The log level
+	Created time.Time       // The time at which the log message was created (nanoseconds)
+	Source  string          // The message source
+	Message string          // The log message
+	Fields  Fields          `json:",omitempty"` // Structured data, may be nil
+	Name    string          `json:",omitempty"` // The named logger it came from, may be empty
+	Tag     string          `json:",omitempty"` // The tag given with Logger.Tag, may be empty
+	Seq     uint64          `json:",omitempty"` // Numbers the records of a Logger from 1
+	Data    json.RawMessage `json:",omitempty"` // A JSON payload passed on as is, may be nil
+
+	format string // The format Message was made from, if any
 }
 
 /****** LogWriter ******/
@@ -89,6 +107,46 @@ type LogWriter interface {
 	Flush()
 }
 
+// ErrorLogWriter is implemented by writers that can tell whether a record was
+// actually written.  Decorators such as FailoverLogWriter use it to detect a
+// broken output.
+type ErrorLogWriter interface {
+	LogWriter
+
+	// Like LogWrite, but returns the reason the record could not be written.
+	LogWriteErr(rec *LogRecord) error
+}
+
+// BulkLogWriter is implemented by writers that can write several records at
+// once more cheaply, e.g. with a single syscall.  Filters pass everything
+// queued (up to LogBatchLength records) in one call.
+type BulkLogWriter interface {
+	LogWriter
+
+	// Write the records in order.  The slice is reused after the call
+	// returns, so it must not be retained.
+	BulkLogWrite(recs []*LogRecord)
+}
+
+// HealthChecker is implemented by writers that can tell whether their output
+// works, e.g. that a file can be written or a server reached, for readiness
+// probes.  See Logger.Health.
+type HealthChecker interface {
+	LogWriter
+
+	// Ping returns why records could not be written now, or nil.
+	Ping() error
+}
+
+// Write rec to w, returning the error if w is able to report one.
+func logWriteErr(w LogWriter, rec *LogRecord) error {
+	if ew, ok := w.(ErrorLogWriter); ok {
+		return ew.LogWriteErr(rec)
+	}
+	w.LogWrite(rec)
+	return nil
+}
+
 /****** Logger ******/
 
 // A Filter represents the log level below which no log records are written to
@@ -96,16 +154,54 @@ type LogWriter interface {
 type Filter struct {
 	Level Level
 
-	rec     chan *LogRecord // write queue
-	closing bool            // true if Socket was closed at API level
+	rec      chan *LogRecord    // write queue
+	flushReq chan chan struct{} // Flush requests, acknowledged by closing
+	closeReq chan chan struct{} // Close request, acknowledged by closing
+	done     chan struct{}      // closed when run returns
+	closing  int32              // set once Close has been called
+	sync     int32              // set to write records in the logging call
+	paused   int32              // set while the filter is disabled
+	writeMu  sync.Mutex         // serializes writes to the writer
+
+	overflow   OverflowPolicy // what to do when rec is full
+	dropped    uint64         // records discarded by the overflow policy
+	enqueued   uint64         // records put on rec
+	written    uint64         // records handed to the writer
+	suppressed uint64         // records held back by sampling or rate limits
+
+	hooks       atomic.Value            // filterHooks of the owning Logger
+	srcLevels   atomic.Value            // *sourceLevels overriding Level
+	include     *regexp.Regexp          // only write matching records
+	exclude     *regexp.Regexp          // drop matching records
+	matchSource bool                    // also match include/exclude on Source
+	predicates  []func(*LogRecord) bool // all must hold for a record
+	middleware  []Middleware            // runs before the restrictions below
+	routes      []fieldRoute            // fields a record must have
+	tags        []string                // patterns of the record tags taken
+	tagRes      []*regexp.Regexp        // expressions of the record tags taken
+	fallback    int32                   // set to only write records no route took
+	sampler     *sampler                // drops repeated messages
+	limit       *rateLimiter            // filter wide rate limit
+	levelLimits map[Level]*rateLimiter  // per level rate limits
 
 	LogWriter
 }
 
 func NewFilter(lvl Level, writer LogWriter) *Filter {
+	return NewFilterWithQueue(lvl, writer, LogBufferLength)
+}
+
+// Like NewFilter, but with a queue of queueSize records instead of
+// LogBufferLength, e.g. a larger one for a slow socket writer.
+func NewFilterWithQueue(lvl Level, writer LogWriter, queueSize int) *Filter {
+	if queueSize < 0 {
+		queueSize = 0
+	}
 	f := &Filter{
-		rec:     make(chan *LogRecord, LogBufferLength),
-		closing: false,
+		rec:      make(chan *LogRecord, queueSize),
+		flushReq: make(chan chan struct{}),
+		closeReq: make(chan chan struct{}),
+		done:     make(chan struct{}),
 
 		Level:     lvl,
 		LogWriter: writer,
@@ -116,141 +212,451 @@ func NewFilter(lvl Level, writer LogWriter) *Filter {
 }
 
 func (f *Filter) WriteToChan(rec *LogRecord) {
-	if f.closing {
-		//fmt.Fprintf(os.Stderr, "LogWriter: channel has been closed. Message is [%s]\n", rec.Message)
+	if atomic.LoadInt32(&f.closing) != 0 || f.Disabled() {
+		return
+	}
+	if len(f.middleware) > 0 {
+		cp := *rec
+		chainMiddleware(f.middleware, f.enqueue)(&cp)
 		return
 	}
-	f.rec <- rec
+	f.enqueue(rec)
+}
+
+// Queue a record for the writer unless the filter's restrictions drop it
+func (f *Filter) enqueue(rec *LogRecord) {
+	if (f.include != nil || f.exclude != nil || f.predicates != nil) && !f.matches(rec) {
+		return
+	}
+	if f.sampler != nil && !f.sampler.sample(clockNow(), rec) {
+		atomic.AddUint64(&f.suppressed, 1)
+		return
+	}
+	if f.limit != nil || f.levelLimits != nil {
+		ok, summary := f.rateLimit(rec)
+		if !ok {
+			atomic.AddUint64(&f.suppressed, 1)
+			return
+		}
+		if summary != nil {
+			f.send(summary)
+		}
+	}
+	f.send(rec)
 }
 
 func (f *Filter) run() {
+	defer close(f.done)
+
+	batch := make([]*LogRecord, 0, LogBatchLength)
 	for {
 		select {
-		case rec, ok := <-f.rec:
-			if !ok {
-				return
-			}
-			f.LogWrite(rec)
+		case rec := <-f.rec:
+			batch = append(batch[:0], rec)
+			f.writeMu.Lock()
+			f.writeBatch(f.drain(batch))
+			f.writeMu.Unlock()
+		case ack := <-f.flushReq:
+			f.writeMu.Lock()
+			f.drainAll(batch)
+			f.LogWriter.Flush()
+			f.writeMu.Unlock()
+			close(ack)
+		case ack := <-f.closeReq:
+			f.writeMu.Lock()
+			f.drainAll(batch)
+			f.LogWriter.Close()
+			f.writeMu.Unlock()
+			close(ack)
+			return
 		}
 	}
 }
 
-func (f *Filter) Close() {
-	if f.closing {
-		return
-	}
-	// sleep at most one second and let go routine running
-	// drain the log channel before closing
-	for i := 10; i > 0; i-- {
-		time.Sleep(100 * time.Millisecond)
-		if len(f.rec) <= 0 {
-			break
+// Add whatever else is queued to batch, without waiting for more
+func (f *Filter) drain(batch []*LogRecord) []*LogRecord {
+	for len(batch) < cap(batch) {
+		select {
+		case rec := <-f.rec:
+			batch = append(batch, rec)
+		default:
+			return batch
 		}
 	}
+	return batch
+}
 
-	// block write channel
-	f.closing = true
-
-	defer f.LogWriter.Close()
-
-	close(f.rec)
+// Write everything queued
+func (f *Filter) drainAll(batch []*LogRecord) {
+	for {
+		batch = f.drain(batch[:0])
+		if len(batch) == 0 {
+			return
+		}
+		f.writeBatch(batch)
+	}
+}
 
-	if len(f.rec) <= 0 {
+// Close writes out everything queued and closes the writer.  Records logged
+// to the filter afterwards are ignored.
+func (f *Filter) Close() {
+	if !atomic.CompareAndSwapInt32(&f.closing, 0, 1) {
 		return
 	}
-	// drain the log channel and write driect
-	for rec := range f.rec {
-		f.LogWrite(rec)
-	}
+	ack := make(chan struct{})
+	f.closeReq <- ack
+	<-ack
 }
 
+// Flush returns once everything queued before the call has been written and
+// the writer has been flushed.
 func (f *Filter) Flush() {
-	if f.closing {
+	if atomic.LoadInt32(&f.closing) != 0 {
 		return
 	}
-	// sleep at most one second and let go routine running
-	// drain the log channel before closing
-	for i := 10; i > 0; i-- {
-		time.Sleep(100 * time.Millisecond)
-		if len(f.rec) <= 0 {
-			break
-		}
+	ack := make(chan struct{})
+	select {
+	case f.flushReq <- ack:
+	case <-f.done:
+		return
 	}
-
-	f.LogWriter.Flush()
+	<-ack
 }
 
 // A Logger represents a collection of Filters through which log messages are
-// written.
-type Logger map[string]*Filter
+// written.  Filters may be added and removed while other goroutines log: the
+// logging path reads an immutable snapshot of the filters and never locks.
+// The zero value is a Logger without filters, ready to use.
+type Logger struct {
+	seq   uint64       // last record number; first for 64 bit alignment
+	mu    sync.Mutex   // serializes changes to state
+	state atomic.Value // *loggerState, replaced on every change
+
+	root   *Logger // set in children, which use the root's state
+	name   string  // stamped on records by children
+	fields Fields  // stamped on records by children
+	tag    string  // stamped on records by children
+}
+
+// The filters and settings of a Logger at one moment.  A state is never
+// modified once stored, so it can be read without locking.
+type loggerState struct {
+	filters    map[string]*Filter
+	hooks      []Hook
+	middleware []Middleware
+	fields     Fields // set with SetGlobalFields
+	sync       bool   // set with SetSync
+	subs       []*subscription
+	broadcast  *BroadcastLogWriter // hands the records to subs
+	verbosity  int                 // set with SetVerbosity
+	vmodule    *vmodule            // set with SetVModule
+}
+
+var emptyLoggerState = &loggerState{}
+
+// Create a new logger without filters.
+func NewLogger() *Logger {
+	return new(Logger)
+}
 
 // Create a new logger with a "stdout" filter configured to send log messages at
 // or above lvl to standard output.
-func NewDefaultLogger(lvl Level) Logger {
-	return Logger{
-		"stdout": NewFilter(lvl, NewConsoleLogWriter()),
+func NewDefaultLogger(lvl Level) *Logger {
+	return NewLogger().SetFilter("stdout", NewFilter(lvl, NewConsoleLogWriter()))
+}
+
+// The current snapshot of the logger
+func (log *Logger) load() *loggerState {
+	if log.root != nil {
+		return log.root.load()
+	}
+	if st, ok := log.state.Load().(*loggerState); ok {
+		return st
 	}
+	return emptyLoggerState
+}
+
+// Store a modified copy of the current state; filters is copied too if
+// copyFilters is set, the slices are not and must not be appended to in place
+func (log *Logger) update(copyFilters bool, change func(st *loggerState)) {
+	if log.root != nil {
+		log.root.update(copyFilters, change)
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	st := *log.load()
+	if copyFilters {
+		filters := make(map[string]*Filter, len(st.filters)+1)
+		for name, filt := range st.filters {
+			filters[name] = filt
+		}
+		st.filters = filters
+	}
+	change(&st)
+	log.state.Store(&st)
+}
+
+// Filter returns the filter added under name, or nil.
+func (log *Logger) Filter(name string) *Filter {
+	return log.load().filters[name]
 }
 
 // Closes all log writers in preparation for exiting the program or a
 // reconfiguration of logging.  Calling this is not really imperative, unless
 // you want to guarantee that all log messages are written.  Close removes
 // all filters (and thus all LogWriters) from the logger.
-func (log Logger) Close() {
+func (log *Logger) Close() {
+	var filters map[string]*Filter
+	log.update(false, func(st *loggerState) {
+		filters, st.filters = st.filters, nil
+	})
+
 	// Close all open loggers
-	for name, filt := range log {
+	for name, filt := range filters {
 		filt.Close()
-		delete(log, name)
 		fmt.Printf("Log close filter %s\n", name)
 	}
 }
 
-func (log Logger) Flush() {
+func (log *Logger) Flush() {
 	// Flush all open loggers
-	for name, filt := range log {
+	for name, filt := range log.load().filters {
 		filt.Flush()
 		fmt.Printf("Log Flush filter %s\n", name)
 	}
 }
 
 // Add a new LogWriter to the Logger which will only log messages at lvl or
-// higher.  This function should not be called from multiple goroutines.
+// higher.  Returns the logger for chaining.
+func (log *Logger) AddFilter(name string, lvl Level, writer LogWriter) *Logger {
+	return log.SetFilter(name, NewFilter(lvl, writer))
+}
+
+// Add filt to the Logger under name, closing the filter it replaces, if any.
 // Returns the logger for chaining.
-func (log Logger) AddFilter(name string, lvl Level, writer LogWriter) Logger {
-	log[name] = NewFilter(lvl, writer)
+func (log *Logger) SetFilter(name string, filt *Filter) *Logger {
+	var old *Filter
+	log.update(true, func(st *loggerState) {
+		old = st.filters[name]
+		filt.setHooks(name, st.hooks)
+		if st.sync {
+			filt.SetSync(true)
+		}
+		st.filters[name] = filt
+	})
+	if old != nil && old != filt {
+		old.Close()
+	}
 	return log
 }
 
+// Replace all of the logger's filters at once and close the ones it had, so
+// no record is written to a mix of old and new filters.
+func (log *Logger) replaceFilters(filters map[string]*Filter) {
+	var old map[string]*Filter
+	log.update(false, func(st *loggerState) {
+		for name, filt := range filters {
+			filt.setHooks(name, st.hooks)
+			if st.sync {
+				filt.SetSync(true)
+			}
+		}
+		old, st.filters = st.filters, filters
+	})
+	for _, filt := range old {
+		filt.Close()
+	}
+}
+
+// Remove the filter added under name and close it, leaving the others
+// alone: the records already queued are written before its writer is
+// closed.  Returns whether there was one.
+func (log *Logger) RemoveFilter(name string) bool {
+	var old *Filter
+	log.update(true, func(st *loggerState) {
+		old = st.filters[name]
+		delete(st.filters, name)
+	})
+	if old == nil {
+		return false
+	}
+	old.Close()
+	return true
+}
+
 /******* Logging *******/
 
 // Determine if any logging will be done
-func (log Logger) skip(lvl Level) bool {
-	for _, filt := range log {
-		if lvl >= filt.Level {
+func (log *Logger) skip(lvl Level) bool {
+	st := log.load()
+	for _, filt := range st.filters {
+		if lvl >= filt.minLevel() && !filt.Disabled() {
+			return false
+		}
+	}
+	for _, sub := range st.subs {
+		if lvl >= sub.lvl {
 			return false
 		}
 	}
 	return true
 }
 
-// Dispatch the logs
-func (log Logger) dispatch(rec *LogRecord) {
-	for _, filt := range log {
-		if rec.Level < filt.Level {
+// IsEnabledFor reports whether some filter would write records at lvl, so
+// callers can skip building expensive diagnostics that nothing would write.
+// A record at an enabled level may still be dropped by a filter's other
+// rules, such as routes or rate limits.
+func (log *Logger) IsEnabledFor(lvl Level) bool {
+	return !log.skip(lvl)
+}
+
+func (log *Logger) IsDebugEnabled() bool {
+	return !log.skip(DEBUG)
+}
+
+func (log *Logger) IsTraceEnabled() bool {
+	return !log.skip(TRACE)
+}
+
+func (log *Logger) IsInfoEnabled() bool {
+	return !log.skip(INFO)
+}
+
+func (log *Logger) IsWarnEnabled() bool {
+	return !log.skip(WARNING)
+}
+
+func (log *Logger) IsErrorEnabled() bool {
+	return !log.skip(ERROR)
+}
+
+// Dispatch the logs.  Fallback filters only get records no routed filter
+// accepted.
+func (log *Logger) dispatch(rec *LogRecord) {
+	log.dispatchState(log.load(), rec)
+}
+
+// Dispatch the logs to the named filter only
+func (log *Logger) dispatchTo(name string, rec *LogRecord) {
+	st := log.load()
+	filt, ok := st.filters[name]
+	if !ok {
+		return
+	}
+	log.dispatchState(&loggerState{
+		filters:    map[string]*Filter{name: filt},
+		hooks:      st.hooks,
+		middleware: st.middleware,
+		fields:     st.fields,
+		subs:       st.subs,
+		broadcast:  st.broadcast,
+	}, rec)
+}
+
+func (log *Logger) dispatchState(st *loggerState, rec *LogRecord) {
+	if log.root != nil || len(log.name) > 0 {
+		log.stamp(rec)
+	}
+	if rec.Seq == 0 {
+		rec.Seq = atomic.AddUint64(&log.rootLogger().seq, 1)
+	}
+	if len(st.fields) > 0 {
+		rec.Fields = mergeFields(st.fields, rec.Fields)
+	}
+	if len(st.middleware) > 0 {
+		chainMiddleware(st.middleware, st.deliver)(rec)
+		return
+	}
+	st.deliver(rec)
+}
+
+// Hand a record to the hooks and filters
+func (st *loggerState) deliver(rec *LogRecord) {
+	for _, h := range st.hooks {
+		h.BeforeDispatch(rec)
+	}
+	if r := currentRedactor(); r != nil {
+		r.Redact(rec)
+	}
+	if len(st.subs) > 0 {
+		st.broadcast.LogWrite(rec)
+	}
+
+	if len(rec.Tag) > 0 && st.deliverTagged(rec) {
+		return
+	}
+
+	routed, fallback := false, false
+	for _, filt := range st.filters {
+		if filt.tagged() {
+			continue
+		}
+		if filt.isFallback() {
+			fallback = true
+			continue
+		}
+		if !filt.accepts(rec) {
 			continue
 		}
+		if filt.routes != nil {
+			routed = true
+		}
 		filt.WriteToChan(rec)
 	}
+	if routed || !fallback {
+		return
+	}
+	for _, filt := range st.filters {
+		if filt.isFallback() && !filt.tagged() && filt.accepts(rec) {
+			filt.WriteToChan(rec)
+		}
+	}
 }
 
-// Send a formatted log message internally
-func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
+// Send a formatted log message internally; depth is passed to
+// runtime.Caller by intLog, 2 for the caller of the logging function
+func (log *Logger) intLogf(depth int, lvl Level, format string, args ...interface{}) {
+	log.intLog(depth+1, lvl, nil, format, args...)
+}
+
+// Send a formatted log message internally and return it as an error, which
+// wraps the error argument if there is one; depth is as for intLogf
+func (log *Logger) intLogErr(depth int, lvl Level, format string, args []interface{}) error {
+	args = resolveLazy(args)
+	msg, err := formatMessage(format, args)
+	if err == nil {
+		err = errors.New(msg)
+	}
+
+	if log.skip(lvl) {
+		return err
+	}
+	var fields Fields
+	if cause := lastError(args); cause != nil {
+		fields = errorFields(nil, cause)
+	}
+	rec := makeLogRecord(depth+1, lvl, fields, msg, nil)
+	rec.format = format
+	log.dispatch(rec)
+	return err
+}
+
+// Send a formatted log message with fields internally; depth is passed to
+// runtime.Caller to find the source
+func (log *Logger) intLog(depth int, lvl Level, fields Fields, format string, args ...interface{}) {
 	if log.skip(lvl) {
 		return
 	}
+	log.dispatch(makeLogRecord(depth+1, lvl, fields, format, args))
+}
 
+// Make the record of a log call; depth is passed to runtime.Caller to find
+// the source
+func makeLogRecord(depth int, lvl Level, fields Fields, format string, args []interface{}) *LogRecord {
 	// Determine caller func
-	pc, fullname, lineno, ok := runtime.Caller(DefaultFileDepth)
+	pc, fullname, lineno, ok := runtime.Caller(depth)
 	src := ""
 	if ok {
 		src = fmt.Sprintf("%s %s:%d", fullname, filepath.Base(runtime.FuncForPC(pc).Name()), lineno)
@@ -258,22 +664,67 @@ func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
 
 	msg := format
 	if len(args) > 0 {
-		msg = fmt.Sprintf(format, args...)
+		args = resolveLazy(args)
+		msg, _ = formatMessage(format, args)
+		if err := lastError(args); err != nil {
+			fields = errorFields(fields, err)
+		}
 	}
 
 	// Make the log record
-	rec := &LogRecord{
+	return &LogRecord{
 		Level:   lvl,
-		Created: time.Now(),
+		Created: clockNow(),
 		Source:  src,
 		Message: msg,
+		Fields:  fields,
+		format:  format,
 	}
+}
+
+// Send a formatted log message with structured fields attached
+func (log *Logger) LogFields(lvl Level, fields Fields, format string, args ...interface{}) {
+	log.intLog(2, lvl, fields, format, args...)
+}
 
+// Send a formatted log message carrying data as its JSON payload (see
+// LogRecord.Data), e.g. a request body to keep its structure instead of
+// flattening it into the message.  data is marshalled with encoding/json;
+// a json.RawMessage or []byte holding valid JSON is taken as it is.
+func (log *Logger) LogData(lvl Level, data interface{}, format string, args ...interface{}) {
+	if log.skip(lvl) {
+		return
+	}
+	rec := makeLogRecord(2, lvl, nil, format, args)
+	rec.Data = marshalData(data)
 	log.dispatch(rec)
 }
 
+// Encode a payload for LogRecord.Data, as a JSON string if all else fails
+func marshalData(data interface{}) json.RawMessage {
+	switch v := data.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		if json.Valid(v) {
+			return v
+		}
+		data = string(v)
+	case []byte:
+		if json.Valid(v) {
+			return json.RawMessage(v)
+		}
+		data = string(v)
+	}
+	js, err := json.Marshal(data)
+	if err != nil {
+		js, _ = json.Marshal(string(appendValue(nil, data)))
+	}
+	return js
+}
+
 // Send a log message with manual level, source, and message.
-func (log Logger) Log(lvl Level, source, message string) {
+func (log *Logger) Log(lvl Level, source, message string) {
 	if log.skip(lvl) {
 		return
 	}
@@ -281,7 +732,7 @@ func (log Logger) Log(lvl Level, source, message string) {
 	// Make the log record
 	rec := &LogRecord{
 		Level:   lvl,
-		Created: time.Now(),
+		Created: clockNow(),
 		Source:  source,
 		Message: message,
 	}
@@ -290,7 +741,7 @@ func (log Logger) Log(lvl Level, source, message string) {
 }
 
 // Send a log message with manual level, source, and message.
-func (log Logger) Json(data []byte) {
+func (log *Logger) Json(data []byte) {
 	var rec LogRecord
 
 	// Make the log record
@@ -298,7 +749,7 @@ func (log Logger) Json(data []byte) {
 	if err != nil {
 		// log to standard output
 		msg := "Err: " + err.Error() + " - " + string(data[0:])
-		log.intLogf(WARNING, msg)
+		log.intLogf(2, WARNING, msg)
 		return
 	}
 
@@ -309,39 +760,68 @@ func (log Logger) Json(data []byte) {
 	log.dispatch(&rec)
 }
 
-//=================================================================
-func (log Logger) Debug(arg0 string, args ...interface{}) {
-	log.intLogf(DEBUG, arg0, args...)
+// Send a record made elsewhere, e.g. received from another process.  The
+// record must not be changed afterwards.
+func (log *Logger) Dispatch(rec *LogRecord) {
+	if log.skip(rec.Level) {
+		return
+	}
+
+	log.dispatch(rec)
+}
 
+// Send a formatted log message at lvl.
+func (log *Logger) Logf(lvl Level, format string, args ...interface{}) {
+	log.intLogf(2, lvl, format, args...)
 }
 
-func (log Logger) Trace(arg0 string, args ...interface{}) {
-	log.intLogf(TRACE, arg0, args...)
+// =================================================================
+func (log *Logger) Debug(arg0 string, args ...interface{}) {
+	log.intLogf(2, DEBUG, arg0, args...)
 
 }
 
-func (log Logger) Info(arg0 string, args ...interface{}) {
-	log.intLogf(INFO, arg0, args...)
+func (log *Logger) Trace(arg0 string, args ...interface{}) {
+	log.intLogf(2, TRACE, arg0, args...)
+
 }
 
-func (log Logger) Warn(arg0 string, args ...interface{}) error {
-	msg := fmt.Sprintf(arg0, args...)
+func (log *Logger) Info(arg0 string, args ...interface{}) {
+	log.intLogf(2, INFO, arg0, args...)
+}
 
-	log.intLogf(WARNING, msg)
-	return errors.New(msg)
+func (log *Logger) Warn(arg0 string, args ...interface{}) error {
+	return log.intLogErr(2, WARNING, arg0, args)
 }
 
-func (log Logger) Error(arg0 string, args ...interface{}) error {
-	msg := fmt.Sprintf(arg0, args...)
+func (log *Logger) Error(arg0 string, args ...interface{}) error {
+	return log.intLogErr(2, ERROR, arg0, args)
+}
 
-	log.intLogf(ERROR, msg)
-	return errors.New(msg)
+func (log *Logger) Critical(arg0 string, args ...interface{}) error {
+	return log.intLogErr(2, CRITICAL, arg0, args)
 }
 
-func (log Logger) Critical(arg0 string, args ...interface{}) error {
-	msg := fmt.Sprintf(arg0, args...)
+// Print logs its arguments at INFO, formatted like fmt.Print.  With Printf
+// and Println it lets a Logger serve libraries that take a printf style
+// logger.
+func (log *Logger) Print(v ...interface{}) {
+	if log.skip(INFO) {
+		return
+	}
+	log.intLogf(2, INFO, fmt.Sprint(resolveLazy(v)...))
+}
 
-	log.intLogf(CRITICAL, msg)
-	return errors.New(msg)
+// Printf logs at INFO, formatted like fmt.Printf.
+func (log *Logger) Printf(format string, v ...interface{}) {
+	log.intLogf(2, INFO, format, v...)
 }
 
+// Println logs its arguments at INFO, formatted like fmt.Println but
+// without the newline.
+func (log *Logger) Println(v ...interface{}) {
+	if log.skip(INFO) {
+		return
+	}
+	log.intLogf(2, INFO, strings.TrimSuffix(fmt.Sprintln(resolveLazy(v)...), "\n"))
+}
@@ -1,14 +1,36 @@
 package log4go
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -92,10 +114,7 @@ var logRecordWriteTests = []struct {
 }
 
 func TestConsoleLogWriter(t *testing.T) {
-	console := new(ConsoleLogWriter)
-
-	console.color = false
-	console.format = "[%T %z %D] [%L] [%S] %M"
+	console := NewConsoleLogWriter().SetColor(false).SetFormat("[%T %z %D] [%L] [%S] %M")
 
 	r, w := io.Pipe()
 	console.iow = w
@@ -123,26 +142,26 @@ func TestLogger(t *testing.T) {
 	if sl == nil {
 		t.Fatalf("NewDefaultLogger should never return nil")
 	}
-	if lw, exist := sl["stdout"]; lw == nil || exist != true {
+	if lw := sl.Filter("stdout"); lw == nil {
 		t.Fatalf("NewDefaultLogger produced invalid logger (DNE or nil)")
 	}
-	if sl["stdout"].Level != WARNING {
+	if sl.Filter("stdout").Level != WARNING {
 		t.Fatalf("NewDefaultLogger produced invalid logger (incorrect level)")
 	}
-	if len(sl) != 1 {
+	if len(sl.Filters()) != 1 {
 		t.Fatalf("NewDefaultLogger produced invalid logger (incorrect map count)")
 	}
 
 	//func (l *Logger) AddFilter(name string, level int, writer LogWriter) {}
-	l := make(Logger)
+	l := NewLogger()
 	l.AddFilter("stdout", DEBUG, NewConsoleLogWriter())
-	if lw, exist := l["stdout"]; lw == nil || exist != true {
+	if lw := l.Filter("stdout"); lw == nil {
 		t.Fatalf("AddFilter produced invalid logger (DNE or nil)")
 	}
-	if l["stdout"].Level != DEBUG {
+	if l.Filter("stdout").Level != DEBUG {
 		t.Fatalf("AddFilter produced invalid logger (incorrect level)")
 	}
-	if len(l) != 1 {
+	if len(l.Filters()) != 1 {
 		t.Fatalf("AddFilter produced invalid logger (incorrect map count)")
 	}
 
@@ -173,7 +192,7 @@ func TestLogger(t *testing.T) {
 
 func TestLogOutput(t *testing.T) {
 	const (
-		expected = "fdf3e51e444da56b4cb400f30bc47424"
+		expected = "7d9a642547c3587dfa3454244675ceaf"
 	)
 
 	// Unbuffered output
@@ -182,10 +201,10 @@ func TestLogOutput(t *testing.T) {
 	}(LogBufferLength)
 	LogBufferLength = 0
 
-	l := make(Logger)
+	l := NewLogger()
 
 	// Delete and open the output log without a timestamp (for a constant md5sum)
-	l.AddFilter("file", DEBUG, NewFileLogWriter(testLogFile).SetFormat("[%L] %M"))
+	l.AddFilter("file", DEBUG, NewFileLogWriter(testLogFile).SetShared(true).SetFormat("[%L] %M"))
 	defer os.Remove(testLogFile)
 
 	// Send some log messages
@@ -255,9 +274,12 @@ func TestCountMallocs(t *testing.T) {
 }
 
 func TestXMLConfig(t *testing.T) {
-	const (
-		configfile = "_example.xml"
-	)
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configfile := filepath.Join(dir, "_example.xml")
 
 	fd, err := os.Create(configfile)
 	if err != nil {
@@ -268,107 +290,89 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "  <filter enabled=\"true\">")
 	fmt.Fprintln(fd, "    <tag>stdout</tag>")
 	fmt.Fprintln(fd, "    <type>console</type>")
-	fmt.Fprintln(fd, "    <!-- level is (:?FINEST|FINE|DEBUG|TRACE|INFO|WARNING|ERROR) -->")
+	fmt.Fprintln(fd, "    <!-- level is (:?DEBUG|TRACE|INFO|WARNING|ERROR|CRITICAL) -->")
 	fmt.Fprintln(fd, "    <level>DEBUG</level>")
 	fmt.Fprintln(fd, "        <property name=\"color\">true</property>")
-	fmt.Fprintln(fd, "        <property name=\"format\">[%D %T] [%L] (%S) %M</property>")
+	fmt.Fprintf(fd, "        <property name=\"format\">[%%D %%T] [%%L] (%%S) %%M</property>\n")
 	fmt.Fprintln(fd, "  </filter>")
 	fmt.Fprintln(fd, "  <filter enabled=\"true\">")
 	fmt.Fprintln(fd, "    <tag>file</tag>")
 	fmt.Fprintln(fd, "    <type>file</type>")
-	fmt.Fprintln(fd, "    <level>FINEST</level>")
+	fmt.Fprintln(fd, "    <level>DEBUG</level>")
 	fmt.Fprintln(fd, "    <property name=\"filename\">test.log</property>")
+	fmt.Fprintf(fd, "    <property name=\"path\">%s</property>\n", dir)
 	fmt.Fprintln(fd, "    <!--")
-	fmt.Fprintln(fd, "       %T - Time (15:04:05 MST)")
-	fmt.Fprintln(fd, "       %t - Time (15:04)")
-	fmt.Fprintln(fd, "       %D - Date (2006/01/02)")
-	fmt.Fprintln(fd, "       %d - Date (01/02/06)")
-	fmt.Fprintln(fd, "       %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)")
-	fmt.Fprintln(fd, "       %S - Source")
-	fmt.Fprintln(fd, "       %M - Message")
+	fmt.Fprintf(fd, "       %%T - Time (15:04:05 MST)\n")
+	fmt.Fprintf(fd, "       %%t - Time (15:04)\n")
+	fmt.Fprintf(fd, "       %%D - Date (2006/01/02)\n")
+	fmt.Fprintf(fd, "       %%d - Date (01/02/06)\n")
+	fmt.Fprintf(fd, "       %%L - Level (DEBG, TRAC, INFO, WARN, EROR, CRIT)\n")
+	fmt.Fprintf(fd, "       %%S - Source\n")
+	fmt.Fprintf(fd, "       %%M - Message\n")
 	fmt.Fprintln(fd, "       It ignores unknown format strings (and removes them)")
-	fmt.Fprintln(fd, "       Recommended: \"[%D %T] [%L] (%S) %M\"")
+	fmt.Fprintf(fd, "       Recommended: \"[%%D %%T] [%%L] (%%S) %%M\"\n")
 	fmt.Fprintln(fd, "    -->")
-	fmt.Fprintln(fd, "    <property name=\"format\">[%D %T] [%L] (%S) %M</property>")
-	fmt.Fprintln(fd, "    <property name=\"rotate\">false</property> <!-- true enables log rotation, otherwise append -->")
-	fmt.Fprintln(fd, "    <property name=\"maxsize\">0M</property> <!-- \\d+[KMG]? Suffixes are in terms of 2**10 -->")
-	fmt.Fprintln(fd, "    <property name=\"maxlines\">0K</property> <!-- \\d+[KMG]? Suffixes are in terms of thousands -->")
-	fmt.Fprintln(fd, "    <property name=\"daily\">true</property> <!-- Automatically rotates when a log message is written after midnight -->")
+	fmt.Fprintf(fd, "    <property name=\"format\">[%%D %%T] [%%L] (%%S) %%M</property>\n")
+	fmt.Fprintln(fd, "    <property name=\"rotateinterval\">24h</property> <!-- starts a new file once the current one is this old -->")
 	fmt.Fprintln(fd, "  </filter>")
 	fmt.Fprintln(fd, "  <filter enabled=\"true\">")
-	fmt.Fprintln(fd, "    <tag>xmllog</tag>")
-	fmt.Fprintln(fd, "    <type>xml</type>")
+	fmt.Fprintln(fd, "    <tag>jsonlog</tag>")
+	fmt.Fprintln(fd, "    <type>file</type>")
 	fmt.Fprintln(fd, "    <level>TRACE</level>")
-	fmt.Fprintln(fd, "    <property name=\"filename\">trace.xml</property>")
-	fmt.Fprintln(fd, "    <property name=\"rotate\">true</property> <!-- true enables log rotation, otherwise append -->")
-	fmt.Fprintln(fd, "    <property name=\"maxsize\">100M</property> <!-- \\d+[KMG]? Suffixes are in terms of 2**10 -->")
-	fmt.Fprintln(fd, "    <property name=\"maxrecords\">6K</property> <!-- \\d+[KMG]? Suffixes are in terms of thousands -->")
-	fmt.Fprintln(fd, "    <property name=\"daily\">false</property> <!-- Automatically rotates when a log message is written after midnight -->")
+	fmt.Fprintln(fd, "    <property name=\"filename\">trace.json</property>")
+	fmt.Fprintf(fd, "    <property name=\"path\">%s</property>\n", dir)
+	fmt.Fprintln(fd, "    <property name=\"encoding\">json</property>")
+	fmt.Fprintln(fd, "    <property name=\"bufsize\">100MiB</property> <!-- starts a new file once the current one is this big -->")
 	fmt.Fprintln(fd, "  </filter>")
 	fmt.Fprintln(fd, "  <filter enabled=\"false\"><!-- enabled=false means this logger won't actually be created -->")
 	fmt.Fprintln(fd, "    <tag>donotopen</tag>")
 	fmt.Fprintln(fd, "    <type>socket</type>")
-	fmt.Fprintln(fd, "    <level>FINEST</level>")
+	fmt.Fprintln(fd, "    <level>DEBUG</level>")
 	fmt.Fprintln(fd, "    <property name=\"endpoint\">192.168.1.255:12124</property> <!-- recommend UDP broadcast -->")
 	fmt.Fprintln(fd, "    <property name=\"protocol\">udp</property> <!-- tcp or udp -->")
 	fmt.Fprintln(fd, "  </filter>")
 	fmt.Fprintln(fd, "</logging>")
 	fd.Close()
 
-	log := make(Logger)
+	log := NewLogger()
 	log.LoadConfig(configfile)
-	defer os.Remove("trace.xml")
-	defer os.Remove("test.log")
 	defer log.Close()
 
 	// Make sure we got all loggers
-	if len(log) != 3 {
-		t.Fatalf("XMLConfig: Expected 3 filters, found %d", len(log))
+	if len(log.Filters()) != 3 {
+		t.Fatalf("XMLConfig: Expected 3 filters, found %d", len(log.Filters()))
 	}
 
 	// Make sure they're the right keys
-	if _, ok := log["stdout"]; !ok {
+	if filt := log.Filter("stdout"); filt == nil {
 		t.Errorf("XMLConfig: Expected stdout logger")
 	}
-	if _, ok := log["file"]; !ok {
+	if filt := log.Filter("file"); filt == nil {
 		t.Fatalf("XMLConfig: Expected file logger")
 	}
-	if _, ok := log["xmllog"]; !ok {
-		t.Fatalf("XMLConfig: Expected xmllog logger")
+	if filt := log.Filter("jsonlog"); filt == nil {
+		t.Fatalf("XMLConfig: Expected jsonlog logger")
 	}
 
 	// Make sure they're the right type
-	if _, ok := log["stdout"].LogWriter.(*ConsoleLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected stdout to be ConsoleLogWriter, found %T", log["stdout"].LogWriter)
+	if _, ok := log.Filter("stdout").LogWriter.(*ConsoleLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected stdout to be ConsoleLogWriter, found %T", log.Filter("stdout").LogWriter)
 	}
-	if _, ok := log["file"].LogWriter.(*FileLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected file to be *FileLogWriter, found %T", log["file"].LogWriter)
+	if _, ok := log.Filter("file").LogWriter.(*FileLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected file to be *FileLogWriter, found %T", log.Filter("file").LogWriter)
 	}
-	if _, ok := log["xmllog"].LogWriter.(*FileLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected xmllog to be *FileLogWriter, found %T", log["xmllog"].LogWriter)
+	if _, ok := log.Filter("jsonlog").LogWriter.(*FileLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected jsonlog to be *FileLogWriter, found %T", log.Filter("jsonlog").LogWriter)
 	}
 
 	// Make sure levels are set
-	if lvl := log["stdout"].Level; lvl != DEBUG {
+	if lvl := log.Filter("stdout").Level; lvl != DEBUG {
 		t.Errorf("XMLConfig: Expected stdout to be set to level %d, found %d", DEBUG, lvl)
 	}
 
-	if lvl := log["xmllog"].Level; lvl != TRACE {
-		t.Errorf("XMLConfig: Expected xmllog to be set to level %d, found %d", TRACE, lvl)
+	if lvl := log.Filter("jsonlog").Level; lvl != TRACE {
+		t.Errorf("XMLConfig: Expected jsonlog to be set to level %d, found %d", TRACE, lvl)
 	}
-
-	// Make sure the w is open and points to the right file
-	//	if fname := log["file"].LogWriter.(*FileLogWriter).file.Name(); fname != "test.log" {
-	//		t.Errorf("XMLConfig: Expected file to have opened %s, found %s", "test.log", fname)
-	//	}
-
-	// Make sure the XLW is open and points to the right file
-	//	if fname := log["xmllog"].LogWriter.(*FileLogWriter).file.Name(); fname != "trace.xml" {
-	//		t.Errorf("XMLConfig: Expected xmllog to have opened %s, found %s", "trace.xml", fname)
-	//	}
-
-	// Move XML log file
-	os.Rename(configfile, "examples/"+configfile) // Keep this so that an example with the documentation is available
 }
 
 func BenchmarkFormatLogRecord(b *testing.B) {
@@ -429,7 +433,7 @@ func BenchmarkConsoleUtilNotLog(b *testing.B) {
 }
 
 func BenchmarkFileLog(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log"))
 	b.StartTimer()
@@ -441,7 +445,7 @@ func BenchmarkFileLog(b *testing.B) {
 }
 
 func BenchmarkFileNotLogged(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log"))
 	b.StartTimer()
@@ -453,7 +457,7 @@ func BenchmarkFileNotLogged(b *testing.B) {
 }
 
 func BenchmarkFileUtilLog(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log"))
 	b.StartTimer()
@@ -465,7 +469,7 @@ func BenchmarkFileUtilLog(b *testing.B) {
 }
 
 func BenchmarkFileUtilNotLog(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log"))
 	b.StartTimer()
@@ -485,3 +489,3496 @@ func BenchmarkFileUtilNotLog(b *testing.B) {
 //elog.BenchmarkFileNotLogged       2000000         821 ns/op
 //elog.BenchmarkFileUtilLog           50000       33945 ns/op
 //elog.BenchmarkFileUtilNotLog      1000000        1258 ns/op
+
+// memLogWriter keeps every record it is given, for inspection by tests
+type memLogWriter struct {
+	mu      sync.Mutex
+	recs    []*LogRecord
+	flushed int
+	closed  int
+}
+
+func (m *memLogWriter) LogWrite(rec *LogRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recs = append(m.recs, rec)
+}
+
+func (m *memLogWriter) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed++
+}
+
+func (m *memLogWriter) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushed++
+}
+
+func (m *memLogWriter) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.recs)
+}
+
+func TestTeeLogWriter(t *testing.T) {
+	a, b := new(memLogWriter), new(memLogWriter)
+	tee := NewTeeLogWriter(a, nil, b)
+	if n := len(tee.Writers()); n != 2 {
+		t.Fatalf("TeeLogWriter: expected 2 writers, found %d", n)
+	}
+
+	tee.LogWrite(newLogRecord(INFO, "source", "message"))
+	tee.Flush()
+	tee.Close()
+
+	for i, m := range []*memLogWriter{a, b} {
+		if m.Len() != 1 || m.flushed != 1 || m.closed != 1 {
+			t.Errorf("TeeLogWriter: child %d got %d records, %d flushes, %d closes", i, m.Len(), m.flushed, m.closed)
+		}
+	}
+}
+
+// errLogWriter is a memLogWriter that fails while err is set
+type errLogWriter struct {
+	memLogWriter
+	err error
+}
+
+func (e *errLogWriter) LogWriteErr(rec *LogRecord) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.LogWrite(rec)
+	return nil
+}
+
+func TestFailoverLogWriter(t *testing.T) {
+	primary, secondary := new(errLogWriter), new(memLogWriter)
+	fo := NewFailoverLogWriter(primary, secondary).SetProbeInterval(50 * time.Millisecond)
+
+	fo.LogWrite(newLogRecord(INFO, "source", "first"))
+	primary.err = errors.New("down")
+	fo.LogWrite(newLogRecord(INFO, "source", "second"))
+	fo.LogWrite(newLogRecord(INFO, "source", "third"))
+	if fo.Active() != secondary {
+		t.Errorf("FailoverLogWriter: expected secondary to be active")
+	}
+
+	primary.err = nil
+	time.Sleep(60 * time.Millisecond)
+	fo.LogWrite(newLogRecord(INFO, "source", "fourth"))
+	if fo.Active() != primary {
+		t.Errorf("FailoverLogWriter: expected primary to be active after probe")
+	}
+
+	if primary.Len() != 2 || secondary.Len() != 2 {
+		t.Errorf("FailoverLogWriter: primary got %d, secondary got %d records", primary.Len(), secondary.Len())
+	}
+}
+
+// gateLogWriter is a memLogWriter that blocks writes until gate is closed
+type gateLogWriter struct {
+	memLogWriter
+	gate chan struct{}
+}
+
+func (g *gateLogWriter) LogWrite(rec *LogRecord) {
+	<-g.gate
+	g.memLogWriter.LogWrite(rec)
+}
+
+func TestRemoveFilterDrains(t *testing.T) {
+	slow := &gateLogWriter{gate: make(chan struct{})}
+	other := new(memLogWriter)
+	l := NewLogger().
+		SetFilter("slow", NewFilter(INFO, slow)).
+		SetFilter("other", NewFilter(INFO, other))
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		l.Info("queued %d", i)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(slow.gate)
+	}()
+	if !l.RemoveFilter("slow") {
+		t.Fatalf("RemoveFilter: filter not found")
+	}
+	if slow.Len() != 3 || slow.closed != 1 {
+		t.Errorf("RemoveFilter: %d records written before %d closes", slow.Len(), slow.closed)
+	}
+
+	l.Info("after")
+	l.Filter("other").Flush()
+	if l.Filter("slow") != nil || other.Len() != 4 || other.closed != 0 {
+		t.Errorf("RemoveFilter: other filter got %d records and %d closes", other.Len(), other.closed)
+	}
+}
+
+func TestCircuitBreakerLogWriter(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local))
+	SetClock(clock)
+	defer SetClock(nil)
+	var reports []string
+	SetErrorHandler(func(c string, err error) {
+		reports = append(reports, err.Error())
+	})
+	defer SetErrorHandler(nil)
+
+	w := &errLogWriter{err: errors.New("down")}
+	b := NewCircuitBreakerLogWriter(w, 3, time.Minute)
+	for i := 0; i < 5; i++ {
+		b.LogWrite(newLogRecord(INFO, "", "lost"))
+	}
+	if st := b.Stats(); st.State != BreakerOpen || st.Opened != 1 || st.Rejected != 2 || len(reports) != 1 {
+		t.Fatalf("CircuitBreakerLogWriter: got %+v and reports %q", st, reports)
+	}
+
+	// A failed probe keeps it open for another cooldown
+	clock.Advance(time.Minute)
+	if err := b.LogWriteErr(newLogRecord(INFO, "", "probe")); err == nil || err == ErrCircuitOpen {
+		t.Errorf("CircuitBreakerLogWriter: probe not written: %v", err)
+	}
+	if err := b.LogWriteErr(newLogRecord(INFO, "", "lost")); err != ErrCircuitOpen {
+		t.Errorf("CircuitBreakerLogWriter: got %v while open", err)
+	}
+
+	w.err = nil
+	clock.Advance(time.Minute)
+	b.LogWrite(newLogRecord(INFO, "", "back"))
+	b.LogWrite(newLogRecord(INFO, "", "again"))
+	if st := b.Stats(); st.State != BreakerClosed || st.Failures != 0 || w.Len() != 2 || len(reports) != 2 {
+		t.Errorf("CircuitBreakerLogWriter: got %+v, %d records and reports %q", st, w.Len(), reports)
+	}
+}
+
+func TestWALLogWriter(t *testing.T) {
+	SetErrorHandler(func(string, error) {})
+	defer SetErrorHandler(nil)
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Records the writer refuses stay in the log when it is closed
+	down := &errLogWriter{err: errors.New("down")}
+	w, err := NewWALLogWriter(dir, down)
+	if err != nil {
+		t.Fatalf("NewWALLogWriter: %s", err)
+	}
+	rec := newLogRecord(WARNING, "source", "first")
+	rec.Fields = Fields{"user": "bob"}
+	w.LogWrite(rec)
+	w.LogWrite(newLogRecord(INFO, "source", "second"))
+	w.Flush()
+	if !w.Pending() || down.Len() != 0 {
+		t.Errorf("WALLogWriter: expected 2 records pending, %d delivered", down.Len())
+	}
+	w.Close()
+	if err := w.LogWriteErr(rec); err != ErrWALClosed {
+		t.Errorf("WALLogWriter: got %v after Close", err)
+	}
+
+	// and are delivered by the next one before its own
+	mem := new(memLogWriter)
+	if w, err = NewWALLogWriter(dir, mem); err != nil {
+		t.Fatalf("NewWALLogWriter: %s", err)
+	}
+	w.LogWrite(newLogRecord(INFO, "source", "third"))
+	w.Flush()
+	if mem.Len() != 3 || w.Pending() {
+		t.Fatalf("WALLogWriter: expected 3 records delivered, got %d", mem.Len())
+	}
+	if got := mem.recs[0]; got.Message != "first" || got.Level != WARNING || got.Fields["user"] != "bob" || !got.Created.Equal(rec.Created) {
+		t.Errorf("WALLogWriter: got %+v", got)
+	}
+	if mem.recs[1].Message != "second" || mem.recs[2].Message != "third" {
+		t.Errorf("WALLogWriter: got %q and %q", mem.recs[1].Message, mem.recs[2].Message)
+	}
+	w.Close()
+
+	// Nothing is delivered twice after a clean Close
+	mem = new(memLogWriter)
+	if w, err = NewWALLogWriter(dir, mem); err != nil {
+		t.Fatalf("NewWALLogWriter: %s", err)
+	}
+	w.Flush()
+	w.Close()
+	if mem.Len() != 0 {
+		t.Errorf("WALLogWriter: %d records delivered again", mem.Len())
+	}
+	if seqs, _ := walSegments(dir); len(seqs) != 1 {
+		t.Errorf("WALLogWriter: expected delivered segments removed, found %d", len(seqs))
+	}
+}
+
+// Slowly counts records without locking, so the race detector sees
+// concurrent calls
+type countLogWriter struct{ n int }
+
+func (c *countLogWriter) LogWrite(rec *LogRecord) {
+	time.Sleep(100 * time.Microsecond)
+	c.n++
+}
+
+func (c *countLogWriter) Close() {}
+func (c *countLogWriter) Flush() {}
+
+// Records the log cannot take go to the writer while it delivers others
+func TestWALLogWriterFallback(t *testing.T) {
+	SetErrorHandler(func(string, error) {})
+	defer SetErrorHandler(nil)
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cw := new(countLogWriter)
+	w, err := NewWALLogWriter(dir, cw)
+	if err != nil {
+		t.Fatalf("NewWALLogWriter: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		w.LogWrite(newLogRecord(INFO, "source", "logged"))
+	}
+	// The disk fails
+	w.mu.Lock()
+	w.seg.Close()
+	w.mu.Unlock()
+	for i := 0; i < 100; i++ {
+		w.LogWrite(newLogRecord(INFO, "source", "passed on"))
+	}
+	w.Close()
+	if cw.n != 200 {
+		t.Errorf("WALLogWriter: %d of 200 records written", cw.n)
+	}
+}
+
+func TestAsyncLogWriter(t *testing.T) {
+	mem := new(memLogWriter)
+	async := NewAsyncLogWriter(mem, 8, 2, OverflowBlock)
+	for i := 0; i < 100; i++ {
+		async.LogWrite(newLogRecord(INFO, "source", "message"))
+	}
+	async.Flush()
+	if mem.Len() != 100 || mem.flushed != 1 {
+		t.Errorf("AsyncLogWriter: expected 100 records flushed, got %d (%d flushes)", mem.Len(), mem.flushed)
+	}
+	async.Close()
+	if mem.closed != 1 {
+		t.Errorf("AsyncLogWriter: expected writer to be closed once, got %d", mem.closed)
+	}
+
+	gate := &gateLogWriter{gate: make(chan struct{})}
+	async = NewAsyncLogWriter(gate, 1, 1, OverflowDropNewest)
+	for i := 0; i < 10; i++ {
+		async.LogWrite(newLogRecord(INFO, "source", "message"))
+	}
+	close(gate.gate)
+	async.Close()
+	if dropped := async.Dropped(); dropped < 8 || uint64(gate.Len())+dropped != 10 {
+		t.Errorf("AsyncLogWriter: wrote %d and dropped %d of 10 records", gate.Len(), dropped)
+	}
+}
+
+// Flush returns only once the records given before it are written, while
+// other goroutines keep logging
+func TestAsyncLogWriterFlush(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropOldest} {
+		mem := new(memLogWriter)
+		async := NewAsyncLogWriter(mem, 4, 3, policy)
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						async.LogWrite(newLogRecord(DEBUG, "source", "noise"))
+					}
+				}
+			}()
+		}
+
+		for i := 0; i < 50; i++ {
+			rec := newLogRecord(INFO, "source", strconv.Itoa(i))
+			async.LogWrite(rec)
+			async.Flush()
+			if policy != OverflowBlock {
+				continue
+			}
+			mem.mu.Lock()
+			found := false
+			for _, r := range mem.recs {
+				found = found || r == rec
+			}
+			mem.mu.Unlock()
+			if !found {
+				t.Fatalf("AsyncLogWriter: Flush returned before record %d was written", i)
+			}
+		}
+		close(stop)
+		wg.Wait()
+		async.Close()
+		if mem.flushed != 50 || mem.closed != 1 {
+			t.Errorf("AsyncLogWriter(%s): %d flushes and %d closes", policy, mem.flushed, mem.closed)
+		}
+	}
+}
+
+func TestFilterRateLimit(t *testing.T) {
+	mem := new(memLogWriter)
+	filt := NewFilter(DEBUG, mem).SetRateLimit(20, 2).SetLevelRateLimit(DEBUG, 0.001, 1)
+
+	for i := 0; i < 10; i++ {
+		filt.WriteToChan(newLogRecord(INFO, "source", "message"))
+		filt.WriteToChan(newLogRecord(DEBUG, "source", "message"))
+	}
+	time.Sleep(60 * time.Millisecond)
+	filt.WriteToChan(newLogRecord(INFO, "source", "message"))
+	filt.Close()
+
+	// The first INFO and DEBUG use up the burst, then a summary of the INFO
+	// records dropped by the filter limit precedes the last record; the DEBUG
+	// drops are counted by the DEBUG limit and not reported yet
+	if n := mem.Len(); n != 4 {
+		t.Fatalf("RateLimit: expected 4 records, got %d", n)
+	}
+	if got, want := mem.recs[2].Message, "rate limit: 9 records suppressed"; got != want {
+		t.Errorf("RateLimit: got summary %q, want %q", got, want)
+	}
+}
+
+// A record the filter limit drops keeps its level's token and is counted
+func TestFilterRateLimitBoth(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	mem := new(memLogWriter)
+	filt := NewFilter(DEBUG, mem).SetRateLimit(1, 1).SetLevelRateLimit(INFO, 0.5, 1)
+	filt.WriteToChan(newLogRecord(DEBUG, "source", "uses the filter token"))
+	filt.WriteToChan(newLogRecord(INFO, "source", "dropped by the filter limit"))
+	clock.Advance(time.Second)
+	filt.WriteToChan(newLogRecord(INFO, "source", "passes"))
+	filt.Close()
+
+	var got []string
+	for _, rec := range mem.recs {
+		got = append(got, rec.Message)
+	}
+	want := []string{"uses the filter token", "rate limit: 1 records suppressed", "passes"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("RateLimit: got %q, want %q", got, want)
+	}
+}
+
+func TestFilterSampling(t *testing.T) {
+	mem := new(memLogWriter)
+	filt := NewFilter(DEBUG, mem).SetSampling(3, 5)
+
+	for i := 0; i < 20; i++ {
+		filt.WriteToChan(newLogRecord(DEBUG, "source", "hot"))
+	}
+	filt.WriteToChan(newLogRecord(DEBUG, "source", "cold"))
+	filt.Close()
+
+	// 3 first, then the 8th, 13th and 18th, then the other message
+	if n := mem.Len(); n != 7 {
+		t.Errorf("Sampling: expected 7 records, got %d", n)
+	}
+}
+
+// Formatted messages are counted by their format string
+func TestLoggerSampling(t *testing.T) {
+	SetClock(NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local)))
+	defer SetClock(nil)
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem).SetSampling(2, 0))
+	for i := 0; i < 10; i++ {
+		l.Info("req %d", i)
+		l.Warn("req %d", i)
+	}
+	l.Info("other %d", 0)
+	l.Close()
+
+	var got []string
+	for _, rec := range mem.recs {
+		got = append(got, rec.Message)
+	}
+	want := []string{"req 0", "req 0", "req 1", "req 1", "other 0"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Sampling: got %q, want %q", got, want)
+	}
+}
+
+func TestDedupLogWriter(t *testing.T) {
+	mem := new(memLogWriter)
+	dedup := NewDedupLogWriter(mem, 20*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		dedup.LogWrite(newLogRecord(ERROR, "source", "disk full"))
+	}
+	dedup.LogWrite(newLogRecord(INFO, "source", "recovered"))
+	dedup.LogWrite(newLogRecord(INFO, "source", "recovered"))
+	time.Sleep(50 * time.Millisecond)
+	dedup.Close()
+
+	want := []string{"disk full", "last message repeated 4 times", "recovered", "last message repeated 1 times"}
+	if mem.Len() != len(want) {
+		t.Fatalf("DedupLogWriter: expected %d records, got %d", len(want), mem.Len())
+	}
+	for i, rec := range mem.recs {
+		if rec.Message != want[i] {
+			t.Errorf("DedupLogWriter: record %d is %q, want %q", i, rec.Message, want[i])
+		}
+	}
+}
+
+// The window is measured on the installed clock, not by the timer
+func TestDedupLogWriterClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	mem := new(memLogWriter)
+	dedup := NewDedupLogWriter(mem, 10*time.Millisecond)
+	dedup.LogWrite(newLogRecord(ERROR, "source", "disk full"))
+	dedup.LogWrite(newLogRecord(ERROR, "source", "disk full"))
+	time.Sleep(30 * time.Millisecond)
+	if n := mem.Len(); n != 1 {
+		t.Fatalf("DedupLogWriter: summary written before the clock moved (%d records)", n)
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	dedup.LogWrite(newLogRecord(ERROR, "source", "disk full"))
+	dedup.Close()
+
+	want := []string{"disk full", "last message repeated 1 times", "last message repeated 1 times"}
+	if mem.Len() != len(want) {
+		t.Fatalf("DedupLogWriter: expected %d records, got %d", len(want), mem.Len())
+	}
+	for i, rec := range mem.recs {
+		if rec.Message != want[i] {
+			t.Errorf("DedupLogWriter: record %d is %q, want %q", i, rec.Message, want[i])
+		}
+	}
+	if !mem.recs[1].Created.Equal(clock.Now()) {
+		t.Errorf("DedupLogWriter: summary stamped %v, want %v", mem.recs[1].Created, clock.Now())
+	}
+}
+
+func TestFilterIncludeExclude(t *testing.T) {
+	mem := new(memLogWriter)
+	filt := NewFilter(DEBUG, mem).
+		SetInclude(regexp.MustCompile(`^db:`)).
+		SetExclude(regexp.MustCompile(`vendor/`)).
+		SetMatchSource(true)
+
+	filt.WriteToChan(newLogRecord(INFO, "app/main.go", "db: connected"))
+	filt.WriteToChan(newLogRecord(INFO, "app/main.go", "http: listening"))
+	filt.WriteToChan(newLogRecord(INFO, "vendor/orm.go", "db: query"))
+	filt.Close()
+
+	if mem.Len() != 1 || mem.recs[0].Message != "db: connected" {
+		t.Errorf("IncludeExclude: expected only \"db: connected\", got %d records", mem.Len())
+	}
+}
+
+func TestSourceLevels(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(WARNING, mem))
+	if err := l.Filter("mem").SetSourceLevels("github.com/acme/db=DEBUG, *=ERROR"); err != nil {
+		t.Fatalf("SetSourceLevels: %s", err)
+	}
+	if l.skip(DEBUG) {
+		t.Errorf("SourceLevels: DEBUG should not be skipped with a DEBUG rule")
+	}
+
+	l.Log(DEBUG, "/go/src/github.com/acme/db/conn.go db.Query:10", "db debug")
+	l.Log(DEBUG, "/go/src/github.com/acme/dbx/conn.go dbx.Query:10", "dbx debug")
+	l.Log(WARNING, "/go/src/github.com/acme/web/srv.go web.Serve:10", "web warning")
+	l.Log(ERROR, "/go/src/github.com/acme/web/srv.go web.Serve:10", "web error")
+	l.Close()
+
+	if mem.Len() != 2 || mem.recs[0].Message != "db debug" || mem.recs[1].Message != "web error" {
+		t.Errorf("SourceLevels: expected db debug and web error, got %d records", mem.Len())
+	}
+}
+
+func TestFieldRouting(t *testing.T) {
+	billing, app := new(memLogWriter), new(memLogWriter)
+	l := NewLogger().
+		SetFilter("billing", NewFilter(DEBUG, billing).AddRoute("component", "billing")).
+		SetFilter("app", NewFilter(DEBUG, app).SetFallback(true))
+
+	l.LogFields(INFO, Fields{"component": "billing", "amount": 12}, "charged %s", "alice")
+	l.LogFields(INFO, Fields{"component": "web"}, "served")
+	l.Info("started")
+	l.Close()
+
+	if billing.Len() != 1 || billing.recs[0].Message != "charged alice" {
+		t.Fatalf("FieldRouting: expected billing to get 1 record, got %d", billing.Len())
+	}
+	if src := billing.recs[0].Source; !strings.Contains(src, "log4go_test.go") {
+		t.Errorf("FieldRouting: wrong source %q", src)
+	}
+	if app.Len() != 2 {
+		t.Errorf("FieldRouting: expected app to get 2 records, got %d", app.Len())
+	}
+	if got, want := FormatLogRecord("%M %F", billing.recs[0]), "charged alice amount=12 component=billing\n"; got != want {
+		t.Errorf("FieldRouting: formatted %q, want %q", got, want)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewDefaultRedactor()
+	fields := Fields{"user": "alice", "Password": "hunter2"}
+	rec := newLogRecord(INFO, "source", `login user=alice password="hunter2" card 4111 1111 1111 1111`)
+	rec.Fields = fields
+	r.Redact(rec)
+
+	if want := "login user=alice password=[REDACTED] card [REDACTED]"; rec.Message != want {
+		t.Errorf("Redactor: got message %q, want %q", rec.Message, want)
+	}
+	if rec.Fields["Password"] != REDACTED || rec.Fields["user"] != "alice" {
+		t.Errorf("Redactor: got fields %v", rec.Fields)
+	}
+	if fields["Password"] != "hunter2" {
+		t.Errorf("Redactor: caller's fields were modified")
+	}
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+	SetRedactor(r)
+	l.Info("token=abc123")
+	SetRedactor(nil)
+	l.Info("token=abc123")
+	l.Close()
+	if mem.Len() != 2 || mem.recs[0].Message != "token=[REDACTED]" || mem.recs[1].Message != "token=abc123" {
+		t.Errorf("Redactor: SetRedactor did not apply to dispatch")
+	}
+}
+
+func TestEncryptedFileLogWriter(t *testing.T) {
+	const key = "000102030405060708090a0b0c0d0e0f"
+	os.Setenv("LOG4GO_TEST_KEY", key)
+	defer os.Unsetenv("LOG4GO_TEST_KEY")
+
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewFileLogWriter("enc").SetFormat("[%L] %M")
+	w.SetPath(dir)
+	if err := w.SetEncryption(KeyFromEnv("LOG4GO_TEST_KEY")); err != nil {
+		t.Fatalf("SetEncryption: %s", err)
+	}
+	w.LogWrite(newLogRecord(INFO, "source", "secret message"))
+	w.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Encryption: expected 1 file, found %d", len(files))
+	}
+	raw, _ := ioutil.ReadFile(dir + "/" + files[0].Name())
+	if strings.Contains(string(raw), "secret") || !strings.HasPrefix(string(raw), ENCRYPTED_MAGIC) {
+		t.Fatalf("Encryption: file is not encrypted: %q", raw)
+	}
+
+	k, _ := hex.DecodeString(key)
+	var plain bytes.Buffer
+	if err := DecryptLog(&plain, bytes.NewReader(raw), k); err != nil {
+		t.Fatalf("DecryptLog: %s", err)
+	}
+	if got := plain.String(); got != "[INFO] secret message\n" {
+		t.Errorf("DecryptLog: got %q", got)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := []byte("audit key")
+	w := NewFileLogWriter("audit").SetFormat("[%L] %M").SetAudit(key, 2)
+	w.SetPath(dir)
+	w.LogWrite(newLogRecord(INFO, "source", "one"))
+	w.LogWrite(newLogRecord(INFO, "source", "two\nlines"))
+	w.LogWrite(newLogRecord(INFO, "source", "three"))
+	w.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Audit: expected 1 file, found %d", len(files))
+	}
+	contents, _ := ioutil.ReadFile(dir + "/" + files[0].Name())
+
+	if n, err := VerifyAuditLog(bytes.NewReader(contents), key); err != nil || n != 3 {
+		t.Fatalf("VerifyAuditLog: verified %d records: %v\n%s", n, err, contents)
+	}
+
+	tampered := bytes.Replace(contents, []byte("two"), []byte("TWO"), 1)
+	if _, err := VerifyAuditLog(bytes.NewReader(tampered), key); err == nil {
+		t.Errorf("VerifyAuditLog: modification not detected")
+	}
+	truncated := contents[:bytes.Index(contents, []byte("[INFO] two"))]
+	if _, err := VerifyAuditLog(bytes.NewReader(truncated), key); err == nil {
+		t.Errorf("VerifyAuditLog: truncation not detected")
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	var component string
+	var failure error
+	SetErrorHandler(func(c string, err error) {
+		component, failure = c, err
+	})
+	defer SetErrorHandler(nil)
+
+	w := NewSocketLogWriter("tcp", "127.0.0.1:1")
+	w.LogWrite(newLogRecord(ERROR, "source", "message"))
+	w.Close()
+
+	if component != "SocketLogWriter(127.0.0.1:1)" || failure == nil {
+		t.Errorf("ErrorHandler: got component %q and error %v", component, failure)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var before int
+	var after []string
+	hook := HookFuncs{
+		Before: func(rec *LogRecord) {
+			mu.Lock()
+			defer mu.Unlock()
+			before++
+			rec.Fields = Fields{"host": "test"}
+		},
+		After: func(filter string, rec *LogRecord, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			after = append(after, fmt.Sprintf("%s %v %v", filter, rec.Fields["host"], err))
+		},
+	}
+
+	failing := &errLogWriter{err: errors.New("down")}
+	l := NewLogger()
+	l.AddFilter("ok", DEBUG, new(memLogWriter))
+	l.AddHook(hook)
+	l.AddFilter("failing", DEBUG, failing)
+	l.Info("message")
+	l.Close()
+
+	sort.Strings(after)
+	if before != 1 || len(after) != 2 || after[0] != "failing test down" || after[1] != "ok test <nil>" {
+		t.Errorf("Hooks: got %d before calls and after calls %q", before, after)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	a, b := new(memLogWriter), new(memLogWriter)
+	l := NewLogger().
+		SetFilter("a", NewFilter(DEBUG, a)).
+		SetFilter("b", NewFilter(DEBUG, b).Use(func(rec *LogRecord, next func(*LogRecord)) {
+			rec.Message = "b: " + rec.Message
+			next(rec)
+		}))
+	l.Use(func(rec *LogRecord, next func(*LogRecord)) {
+		if !strings.HasPrefix(rec.Message, "noise") {
+			next(rec)
+		}
+	}, func(rec *LogRecord, next func(*LogRecord)) {
+		rec.Message = strings.ToUpper(rec.Message)
+		next(rec)
+	})
+
+	l.Info("noise")
+	l.Info("signal")
+	l.Close()
+
+	if a.Len() != 1 || a.recs[0].Message != "SIGNAL" {
+		t.Errorf("Middleware: filter a got %d records", a.Len())
+	}
+	if b.Len() != 1 || b.recs[0].Message != "b: SIGNAL" {
+		t.Errorf("Middleware: filter b got %d records", b.Len())
+	}
+}
+
+func TestLogOnceEvery(t *testing.T) {
+	mem := new(memLogWriter)
+	defer func(saved *Logger) { log = saved }(log)
+	log = NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+
+	for i := 0; i < 5; i++ {
+		LogOncef(WARNING, "deprecated %d", i)
+		LogEveryf(time.Hour, INFO, "hot path %d", i)
+	}
+	LogOncef(WARNING, "another call site")
+	log.Close()
+
+	if mem.Len() != 3 {
+		t.Fatalf("LogOnce: expected 3 records, got %d", mem.Len())
+	}
+	if rec := mem.recs[0]; rec.Message != "deprecated 0" || !strings.Contains(rec.Source, "log4go_test.go") {
+		t.Errorf("LogOnce: got %q from %q", rec.Message, rec.Source)
+	}
+
+	// A call site filtered out does not count as logged
+	mem = new(memLogWriter)
+	log = NewLogger().SetFilter("mem", NewFilter(WARNING, mem))
+	for i := 0; i < 3; i++ {
+		if i == 1 {
+			log.Filter("mem").SetSourceLevel("*", DEBUG)
+		}
+		LogOncef(DEBUG, "debug %d", i)
+	}
+	log.Close()
+	if mem.Len() != 1 || mem.recs[0].Message != "debug 1" {
+		t.Errorf("LogOnce: expected only \"debug 1\", got %d records", mem.Len())
+	}
+}
+
+func TestLazyArguments(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(INFO, mem))
+
+	calls := 0
+	expensive := func() string {
+		calls++
+		return "expensive"
+	}
+	l.Debug("skipped %s", expensive)
+	l.Logc(DEBUG, expensive)
+	l.Info("written %s %v", expensive, Lazy(func() interface{} { return 42 }))
+	l.Logc(INFO, expensive)
+	l.Close()
+
+	if calls != 2 {
+		t.Errorf("Lazy: expected 2 evaluations, got %d", calls)
+	}
+	if mem.Len() != 2 || mem.recs[0].Message != "written expensive 42" || mem.recs[1].Message != "expensive" {
+		t.Errorf("Lazy: got %d records", mem.Len())
+	}
+}
+
+func TestAppendLogRecord(t *testing.T) {
+	rec := newLogRecord(ERROR, "/src/pkg/source.go", "message")
+	rec.Created = rec.Created.Add(5 * time.Microsecond)
+	if got, want := FormatLogRecord("%D %m %d %s %L 100%% %Q", rec), "2009/02/13 23:31:30.1234617 13/02/09 source.go EROR 100% \n"; got != want {
+		t.Errorf("AppendLogRecord: got %q, want %q", got, want)
+	}
+
+	buf := make([]byte, 0, 256)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendLogRecord(buf[:0], FORMAT_DEFAULT, rec)
+	})
+	if allocs != 0 {
+		t.Errorf("AppendLogRecord: %v allocations per record, want 0", allocs)
+	}
+}
+
+func BenchmarkAppendLogRecord(b *testing.B) {
+	rec := &LogRecord{
+		Level:   CRITICAL,
+		Created: now,
+		Source:  "source",
+		Message: "message",
+	}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = AppendLogRecord(buf[:0], FORMAT_DEFAULT, rec)
+	}
+}
+
+// bulkLogWriter is a memLogWriter counting BulkLogWrite calls
+type bulkLogWriter struct {
+	memLogWriter
+	gate    chan struct{}
+	batches int
+}
+
+func (b *bulkLogWriter) LogWrite(rec *LogRecord) {
+	<-b.gate
+	b.memLogWriter.LogWrite(rec)
+}
+
+func (b *bulkLogWriter) BulkLogWrite(recs []*LogRecord) {
+	<-b.gate
+	b.mu.Lock()
+	b.batches++
+	b.mu.Unlock()
+	for _, rec := range recs {
+		b.memLogWriter.LogWrite(rec)
+	}
+}
+
+func TestFilterBatches(t *testing.T) {
+	bulk := &bulkLogWriter{gate: make(chan struct{})}
+	filt := NewFilter(DEBUG, bulk)
+
+	// The first records are taken while the rest queue up behind them
+	for i := 0; i < 10; i++ {
+		filt.WriteToChan(newLogRecord(INFO, "source", "message"))
+	}
+	close(bulk.gate)
+	filt.Close()
+
+	if bulk.Len() != 10 || bulk.batches < 1 || bulk.batches > 2 {
+		t.Errorf("Batches: expected 10 records in 1 or 2 batches, got %d in %d", bulk.Len(), bulk.batches)
+	}
+}
+
+func TestFilterQueueSize(t *testing.T) {
+	filt := NewFilterWithQueue(DEBUG, new(memLogWriter), 1000)
+	defer filt.Close()
+	if n := cap(filt.rec); n != 1000 {
+		t.Errorf("NewFilterWithQueue: expected queue of 1000, got %d", n)
+	}
+
+	props := []Property{{Name: "queuesize", Value: "4K"}}
+	if n := propToQueueSize(props); n != 4000 {
+		t.Errorf("propToQueueSize: expected 4000, got %d", n)
+	}
+	if n := propToQueueSize(nil); n != LogBufferLength {
+		t.Errorf("propToQueueSize: expected default of %d, got %d", LogBufferLength, n)
+	}
+}
+
+func TestFilterOverflow(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowDropOldest} {
+		gate := &gateLogWriter{gate: make(chan struct{})}
+		filt := NewFilterWithQueue(DEBUG, gate, 2).SetOverflow(policy)
+		for i := 0; i < 10; i++ {
+			filt.WriteToChan(newLogRecord(INFO, "source", strconv.Itoa(i)))
+		}
+		close(gate.gate)
+		filt.Close()
+
+		// the writer holds one record, the queue two
+		if n, dropped := gate.Len(), filt.Dropped(); uint64(n)+dropped != 10 || n < 2 || n > 3 {
+			t.Errorf("Overflow(%s): wrote %d and dropped %d of 10 records", policy, n, dropped)
+			continue
+		}
+		last := gate.recs[gate.Len()-1].Message
+		if policy == OverflowDropOldest && last != "9" || policy == OverflowDropNewest && last == "9" {
+			t.Errorf("Overflow(%s): wrong records kept, last is %s", policy, last)
+		}
+	}
+}
+
+func TestFilterStats(t *testing.T) {
+	gate := &gateLogWriter{gate: make(chan struct{})}
+	l := NewLogger().
+		SetFilter("gated", NewFilterWithQueue(DEBUG, gate, 2).SetOverflow(OverflowDropNewest)).
+		SetFilter("sampled", NewFilter(DEBUG, new(memLogWriter)).SetSampling(1, 0))
+	for i := 0; i < 10; i++ {
+		l.Info("message")
+	}
+	close(gate.gate)
+	l.Filter("gated").Flush()
+
+	gated := l.FilterStats()["gated"]
+	if gated.Enqueued+gated.Dropped != 10 || gated.Written != gated.Enqueued || gated.QueueSize != 2 {
+		t.Errorf("Stats: gated filter has %+v", gated)
+	}
+	total := l.Stats()
+	if total.Suppressed != 9 || total.Enqueued != gated.Enqueued+1 {
+		t.Errorf("Stats: logger has %+v", total)
+	}
+	l.Close()
+}
+
+func TestPresetLoggers(t *testing.T) {
+	dev := NewDevelopmentLogger()
+	filt := dev.Filter("stdout")
+	if cw, ok := filt.LogWriter.(*ConsoleLogWriter); !ok || filt.Level != DEBUG || cw.format != FORMAT_DEVELOPMENT {
+		t.Errorf("NewDevelopmentLogger: got %+v", filt)
+	}
+	recs, stop := dev.Subscribe(DEBUG)
+	dev.Debug("shown with its line")
+	checkSource(t, "NewDevelopmentLogger", <-recs, callerLine(1))
+	stop()
+	dev.Close()
+
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prod := NewProductionLogger(filepath.Join(dir, "logs", "app.log"))
+	prod.Debug("dropped")
+	for i := 0; i < 300; i++ {
+		prod.Info("hot loop")
+	}
+	prod.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "logs", "app-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("NewProductionLogger: expected 1 file, found %v", files)
+	}
+	contents, _ := ioutil.ReadFile(files[0])
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	var rec LogRecord
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil || rec.Message != "hot loop" || rec.Level != INFO {
+		t.Errorf("NewProductionLogger: first line %q", lines[0])
+	}
+	if len(lines) < 100 || len(lines) > 210 {
+		t.Errorf("NewProductionLogger: %d of 300 records written", len(lines))
+	}
+}
+
+func TestGetLogger(t *testing.T) {
+	payments := GetLogger("test.payments")
+	if GetLogger("test.payments") != payments || GetLogger("") != log || GetLogger("test.other") == payments {
+		t.Fatalf("GetLogger: loggers not kept by name")
+	}
+	defer closeNamedLoggers()
+
+	mem := new(memLogWriter)
+	payments.SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	payments.Info("charged")
+	if mem.Len() != 1 || mem.recs[0].Name != "test.payments" {
+		t.Errorf("GetLogger: records do not carry the name: %+v", mem.recs)
+	}
+
+	l := NewLogger()
+	defer l.Close()
+	cfg := `{"filters": {"out": {"type": "console", "level": "INFO"}},
+		"loggers": {"test.payments": {"filters": {"pay": {"type": "console", "level": "WARNING"}}}}}`
+	if err := l.ReloadConfigBuf("loggers.json", []byte(cfg)); err != nil {
+		t.Fatal(err)
+	}
+	if l.Filter("out") == nil || l.Filter("pay") != nil {
+		t.Errorf("GetLogger: loading logger got %v", l.Filters())
+	}
+	if filt := payments.Filter("pay"); filt == nil || filt.Level != WARNING || payments.Filter("mem") != nil || mem.closed != 1 {
+		t.Errorf("GetLogger: named logger got %v", payments.Filters())
+	}
+
+	xmlCfg := `<logging><logger name="test.other"><filter enabled="true"><tag>x</tag><type>console</type><level>ERROR</level></filter></logger></logging>`
+	if err := l.ReloadConfigBuf("loggers.xml", []byte(xmlCfg)); err != nil {
+		t.Fatal(err)
+	}
+	if filt := GetLogger("test.other").Filter("x"); filt == nil || filt.Level != ERROR {
+		t.Errorf("GetLogger: XML section got %v", GetLogger("test.other").Filters())
+	}
+
+	bad := `{"loggers": {"test.payments": {"filters": {"pay": {"type": "console", "level": "LOUD"}}}}}`
+	if err := CheckConfigBuf("loggers.json", []byte(bad)); err == nil || !strings.Contains(err.Error(), `(logger "test.payments")`) {
+		t.Errorf("GetLogger: bad section gave %v", err)
+	}
+	if payments.Filter("pay") == nil {
+		t.Errorf("GetLogger: checking a configuration changed the logger")
+	}
+	found := 0
+	for _, name := range LoggerNames() {
+		if name == "test.payments" || name == "test.other" {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("LoggerNames: got %v", LoggerNames())
+	}
+}
+
+func TestVerbose(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	defer l.Close()
+
+	l.V(0).Infof("shown %d", 0)
+	l.V(1).Info("hidden")
+	if l.V(1).Enabled() || !l.V(0).Enabled() {
+		t.Errorf("V: wrong levels enabled at verbosity 0")
+	}
+	l.SetVerbosity(2)
+	l.V(1).Infoln("shown", 1)
+	l.V(2).Infof("shown %d", 2)
+	l.V(3).Info("hidden")
+	if mem.Len() != 3 {
+		t.Fatalf("V: expected 3 records, got %d", mem.Len())
+	}
+	if r := mem.recs[1]; r.Message != "shown 1" || r.Level != TRACE || r.Fields[VERBOSITY_FIELD] != 1 || !strings.Contains(r.Source, "log4go_test.go") {
+		t.Errorf("V: got %+v", r)
+	}
+	if r := mem.recs[2]; r.Level != DEBUG {
+		t.Errorf("V(2): logged at %s", r.Level)
+	}
+
+	// This file gets more, other files do not
+	l.SetVerbosity(0)
+	if err := l.SetVModule("log4go_t*=3, nothing=9"); err != nil || l.VModule() == "" {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	if !l.V(3).Enabled() || l.V(4).Enabled() {
+		t.Errorf("SetVModule: this file not at verbosity 3")
+	}
+	vm, _ := parseVModule("db/*=2,file=1")
+	if level, ok := vm.levelOf("/src/app/db/conn.go"); !ok || level != 2 {
+		t.Errorf("SetVModule: db/conn.go at verbosity %d", level)
+	}
+	if level, ok := vm.levelOf("/src/other/files.go"); ok {
+		t.Errorf("SetVModule: other file at verbosity %d", level)
+	}
+	for _, spec := range []string{"db", "db=x", "[=1"} {
+		if err := l.SetVModule(spec); err == nil {
+			t.Errorf("SetVModule(%q): no error", spec)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	AdminHandler(l).ServeHTTP(w, httptest.NewRequest("POST", "/verbosity?v=5&vmodule=", nil))
+	if w.Code != http.StatusNoContent || l.Verbosity() != 5 || l.VModule() != "" {
+		t.Errorf("verbosity: got %d, verbosity %d and vmodule %q", w.Code, l.Verbosity(), l.VModule())
+	}
+}
+
+func TestFilters(t *testing.T) {
+	l := NewLogger().
+		SetFilter("mem", NewFilter(INFO, new(memLogWriter)).SetSync(true)).
+		SetFilter("file", NewFilterWithQueue(WARNING, NewRingLogWriter(4), 8).SetFallback(true))
+	defer l.Close()
+	l.DisableFilter("file")
+	l.Info("message")
+
+	infos := l.Filters()
+	if len(infos) != 2 || infos[0].Name != "file" || infos[1].Name != "mem" {
+		t.Fatalf("Filters: got %+v", infos)
+	}
+	file, mem := infos[0], infos[1]
+	if file.Level != WARNING || file.Writer != "*log4go.RingLogWriter" || !file.Disabled || !file.Fallback || file.Sync || file.Stats.QueueSize != 8 {
+		t.Errorf("Filters: got %+v", file)
+	}
+	if mem.Level != INFO || mem.Disabled || !mem.Sync || mem.Stats.Written != 1 {
+		t.Errorf("Filters: got %+v", mem)
+	}
+}
+
+func TestFilterFlushClose(t *testing.T) {
+	mem := new(memLogWriter)
+	filt := NewFilter(DEBUG, mem)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		filt.WriteToChan(newLogRecord(INFO, "source", "message"))
+	}
+	filt.Flush()
+	if mem.Len() != 100 || mem.flushed != 1 {
+		t.Errorf("Flush: returned with %d of 100 records written and %d flushes", mem.Len(), mem.flushed)
+	}
+
+	filt.WriteToChan(newLogRecord(INFO, "source", "message"))
+	filt.Close()
+	filt.Close()
+	filt.Flush()
+	filt.WriteToChan(newLogRecord(INFO, "source", "after close"))
+	if mem.Len() != 101 || mem.closed != 1 {
+		t.Errorf("Close: returned with %d of 101 records written and %d closes", mem.Len(), mem.closed)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("FlushClose: took %s", d)
+	}
+}
+
+// Runs itself again to call Exit, which ends the process
+func TestExit(t *testing.T) {
+	if dir := os.Getenv("LOG4GO_TEST_EXIT"); len(dir) > 0 {
+		w := NewFileLogWriter("exit")
+		w.SetPath(dir)
+		log.SetFilter("file", NewFilter(INFO, w))
+		log.Info("written by Exit")
+		named := NewFileLogWriter("named")
+		named.SetPath(dir)
+		GetLogger("test.exit").SetFilter("file", NewFilter(INFO, named))
+		GetLogger("test.exit").Info("written by Exit too")
+		Exit(3)
+	}
+
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExit$")
+	cmd.Env = append(os.Environ(), "LOG4GO_TEST_EXIT="+dir)
+	err = cmd.Run()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 3 {
+		t.Fatalf("Exit: process ended with %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "exit-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("Exit: expected 1 file, found %v", files)
+	}
+	if contents, _ := ioutil.ReadFile(files[0]); !strings.Contains(string(contents), "written by Exit") {
+		t.Errorf("Exit: buffered record lost, file holds %q", contents)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "named-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("Exit: expected 1 file of the named logger, found %v", files)
+	}
+	if contents, _ := ioutil.ReadFile(files[0]); !strings.Contains(string(contents), "written by Exit too") {
+		t.Errorf("Exit: record of the named logger lost, file holds %q", contents)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	mem := new(memLogWriter)
+	gate := &gateLogWriter{gate: make(chan struct{})}
+	log := NewLogger().
+		SetFilter("fast", NewFilter(DEBUG, mem)).
+		SetFilter("slow", NewFilter(DEBUG, gate))
+	log.Info("message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := log.Shutdown(ctx)
+	serr, ok := err.(*ShutdownError)
+	if !ok || len(serr.Filters) != 1 || serr.Filters[0] != "slow" || serr.Err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown: expected slow filter to time out, got %v", err)
+	}
+	if len(log.Filters()) != 0 {
+		t.Errorf("Shutdown: %d filters left in logger", len(log.Filters()))
+	}
+	if mem.Len() != 1 || mem.closed != 1 {
+		t.Errorf("Shutdown: fast filter wrote %d records and closed %d times", mem.Len(), mem.closed)
+	}
+	close(gate.gate)
+
+	log = NewLogger().SetFilter("fast", NewFilter(DEBUG, new(memLogWriter)))
+	if err := log.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: unexpected error %v", err)
+	}
+}
+
+func TestLoggerConcurrentFilters(t *testing.T) {
+	l := NewLogger()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					l.Info("message")
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		name := strconv.Itoa(i % 5)
+		l.AddFilter(name, DEBUG, new(memLogWriter))
+		if i%3 == 0 {
+			l.RemoveFilter(name)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// 45 and 48 removed "0" and "3" again
+	if n := len(l.Filters()); n != 3 {
+		t.Errorf("Logger: expected 3 filters, got %d", n)
+	}
+	if l.RemoveFilter("missing") {
+		t.Errorf("RemoveFilter: removed a filter that was never added")
+	}
+	l.Close()
+	if l.Filter("1") != nil {
+		t.Errorf("Close: filters left in logger")
+	}
+}
+
+// The line of the caller, less back lines before
+func callerLine(back int) int {
+	_, _, line, _ := runtime.Caller(1)
+	return line - back
+}
+
+// Check that rec came from the line of this test file
+func checkSource(t *testing.T, what string, rec *LogRecord, line int) {
+	t.Helper()
+	if src := FormatLogRecord("%s", rec); !strings.HasPrefix(src, "log4go_test.go ") || !strings.HasSuffix(src, ":"+strconv.Itoa(line)+"\n") {
+		t.Errorf("%s: source is %q, expected line %d of log4go_test.go", what, strings.TrimSpace(src), line)
+	}
+}
+
+// Every entry point finds the line that called it
+func TestSource(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	defer l.Close()
+	calls := []struct {
+		what string
+		log  func() int
+	}{
+		{"Debug", func() int { l.Debug("x"); return callerLine(0) }},
+		{"Trace", func() int { l.Trace("x"); return callerLine(0) }},
+		{"Info", func() int { l.Info("x"); return callerLine(0) }},
+		{"Warn", func() int { l.Warn("x"); return callerLine(0) }},
+		{"Error", func() int { l.Error("x"); return callerLine(0) }},
+		{"Critical", func() int { l.Critical("x"); return callerLine(0) }},
+		{"Json", func() int { l.Json([]byte("bad")); return callerLine(0) }},
+		{"With", func() int { l.With(Fields{"k": 1}).Info("x"); return callerLine(0) }},
+		{"Named", func() int { l.Named("db").Warn("x"); return callerLine(0) }},
+	}
+	for _, call := range calls {
+		line := call.log()
+		checkSource(t, call.what, mem.recs[mem.Len()-1], line)
+	}
+
+	// The package functions log to the default logger
+	log.SetFilter("test.source", NewFilter(DEBUG, mem).SetSync(true))
+	defer log.RemoveFilter("test.source")
+	pkg := []struct {
+		what string
+		log  func() int
+	}{
+		{"LogInfof", func() int { LogInfof("x"); return callerLine(0) }},
+		{"LogWarnf", func() int { LogWarnf("x"); return callerLine(0) }},
+		{"LogDebug", func() int { LogDebug("x"); return callerLine(0) }},
+		{"LogError", func() int { LogError("x"); return callerLine(0) }},
+	}
+	for _, call := range pkg {
+		line := call.log()
+		checkSource(t, call.what, mem.recs[mem.Len()-1], line)
+	}
+}
+
+func TestChildLogger(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+
+	db := l.Named("db").With(Fields{"shard": 1, "env": "test"})
+	db.Named("pool").LogFields(INFO, Fields{"shard": 2}, "opened")
+	db.Info("query")
+	l.Info("plain")
+	l.Flush()
+
+	want := []string{
+		"[INFO] db.pool env=test shard=2 opened\n",
+		"[INFO] db env=test shard=1 query\n",
+		"[INFO]   plain\n",
+	}
+	if mem.Len() != len(want) {
+		t.Fatalf("Named: expected %d records, got %d", len(want), mem.Len())
+	}
+	for i, rec := range mem.recs {
+		if got := FormatLogRecord("[%L] %N %F %M", rec); got != want[i] {
+			t.Errorf("Named: record %d is %q, expected %q", i, got, want[i])
+		}
+	}
+	if db.Name() != "db" || l.Name() != "" {
+		t.Errorf("Name: got %q and %q", db.Name(), l.Name())
+	}
+
+	l.AddFilter("late", DEBUG, new(memLogWriter))
+	if db.Filter("late") == nil {
+		t.Errorf("Named: child does not see filters added to its parent")
+	}
+	l.Close()
+}
+
+func TestRingLogWriter(t *testing.T) {
+	ring := NewRingLogWriter(3).SetFormat("%M")
+	for i := 0; i < 5; i++ {
+		ring.LogWrite(newLogRecord(INFO, "source", strconv.Itoa(i)))
+	}
+	if got := strings.Join(ring.Tail(0), ""); got != "2\n3\n4\n" {
+		t.Errorf("Tail(0): got %q", got)
+	}
+	if got := strings.Join(ring.Tail(2), ""); got != "3\n4\n" {
+		t.Errorf("Tail(2): got %q", got)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	ring := NewRingLogWriter(10).SetFormat("[%L] %M")
+	l := NewLogger().
+		SetFilter("ring", NewFilter(INFO, ring)).
+		SetFilter("mem", NewFilter(INFO, new(memLogWriter)))
+	defer l.Close()
+	h := AdminHandler(l)
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	if w := do("POST", "/level?filter=ring&level=debug"); w.Code != http.StatusNoContent {
+		t.Fatalf("level: got %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/level?filter=nope&level=debug"); w.Code != http.StatusNotFound {
+		t.Errorf("level: expected 404 for unknown filter, got %d", w.Code)
+	}
+	// The short names Level.String writes are accepted too
+	if w := do("POST", "/level?filter=mem&level=WARN"); w.Code != http.StatusNoContent {
+		t.Errorf("level: WARN got %d %s", w.Code, w.Body)
+	}
+	l.Debug("debug")
+	l.Info("info")
+	if w := do("POST", "/flush"); w.Code != http.StatusNoContent {
+		t.Errorf("flush: got %d", w.Code)
+	}
+
+	w := do("GET", "/filters")
+	var list []adminFilter
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("filters: got %s (%v)", w.Body, err)
+	}
+	if list[1].Name != "ring" || list[1].Level != "DEBG" || list[1].Stats.Written != 2 {
+		t.Errorf("filters: got %+v", list[1])
+	}
+	if list[0].Name != "mem" || list[0].Level != "WARN" {
+		t.Errorf("filters: got %+v", list[0])
+	}
+
+	if w := do("GET", "/tail?n=5"); w.Body.String() != "[DEBG] debug\n[INFO] info\n" {
+		t.Errorf("tail: got %q", w.Body)
+	}
+	if w := do("GET", "/tail?filter=mem"); w.Code != http.StatusNotFound {
+		t.Errorf("tail: expected 404 without a ring buffer, got %d", w.Code)
+	}
+}
+
+func TestDisableFilter(t *testing.T) {
+	a, b := new(memLogWriter), new(memLogWriter)
+	l := NewLogger().
+		SetFilter("a", NewFilter(DEBUG, a)).
+		SetFilter("b", NewFilter(WARNING, b)).
+		SetSync(true)
+	defer l.Close()
+
+	if !l.DisableFilter("a") || l.DisableFilter("nope") || !l.Filter("a").Disabled() {
+		t.Fatalf("DisableFilter: filter a not disabled")
+	}
+	if l.IsDebugEnabled() {
+		t.Errorf("DisableFilter: DEBUG still enabled")
+	}
+	l.Warn("muted")
+	l.Debug("dropped")
+	if !l.EnableFilter("a") || l.EnableFilter("nope") {
+		t.Fatalf("EnableFilter: filter a not enabled")
+	}
+	l.Warn("back")
+	if a.Len() != 1 || a.recs[0].Message != "back" || b.Len() != 2 {
+		t.Errorf("DisableFilter: a got %d records, b %d", a.Len(), b.Len())
+	}
+
+	h := AdminHandler(l)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/disable?filter=b", nil))
+	if w.Code != http.StatusNoContent || !l.Filter("b").Disabled() {
+		t.Errorf("disable: got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/enable?filter=nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("enable: expected 404 for unknown filter, got %d", w.Code)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := NewSocketLogWriter("tcp", ln.Addr().String())
+	file := NewFileLogWriter("health")
+	file.SetPath(dir)
+
+	l := NewLogger().
+		SetFilter("file", NewFilter(INFO, file)).
+		SetFilter("socket", NewFilter(INFO, NewTeeLogWriter(new(memLogWriter), up))).
+		SetFilter("mem", NewFilter(INFO, new(memLogWriter)))
+	defer l.Close()
+	if h := l.Health(); len(h) != 3 || h["file"] != nil || h["socket"] != nil || !l.Healthy() {
+		t.Fatalf("Health: got %v", h)
+	}
+
+	ln.Close()
+	os.RemoveAll(dir)
+	h := l.Health()
+	if h["file"] == nil || h["socket"] == nil || h["mem"] != nil || l.Healthy() {
+		t.Errorf("Health: got %v", h)
+	}
+
+	w := httptest.NewRecorder()
+	AdminHandler(l).ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	var failing map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &failing); err != nil || w.Code != http.StatusServiceUnavailable || len(failing) != 2 {
+		t.Errorf("health: got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	access, app := new(memLogWriter), new(memLogWriter)
+	l := NewLogger().
+		SetFilter("access", NewFilter(INFO, access)).
+		SetFilter("app", NewFilter(INFO, app))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	serve := func(opts HTTPOptions, target string) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.RemoteAddr = "10.0.0.1:5555"
+		r.Header.Set("User-Agent", "test/1.0")
+		HTTPMiddleware(l, opts)(handler).ServeHTTP(httptest.NewRecorder(), r)
+	}
+	serve(HTTPOptions{Filter: "access"}, "/hello?x=1")
+	serve(HTTPOptions{Filter: "access", Format: HTTPFormatCombined}, "/fail")
+	l.Flush()
+
+	if access.Len() != 2 || app.Len() != 0 {
+		t.Fatalf("HTTPMiddleware: access got %d records, app %d", access.Len(), app.Len())
+	}
+	rec := access.recs[0]
+	if rec.Level != INFO || rec.Fields["status"] != 200 || rec.Fields["bytes"] != int64(5) ||
+		rec.Fields["path"] != "/hello" || rec.Fields["remote"] != "10.0.0.1" {
+		t.Errorf("HTTPMiddleware: got %+v", rec)
+	}
+	if !strings.HasPrefix(rec.Message, "GET /hello 200 5B ") {
+		t.Errorf("HTTPMiddleware: short format got %q", rec.Message)
+	}
+	rec = access.recs[1]
+	clf := regexp.MustCompile(`^10\.0\.0\.1 - - \[[^]]+\] "GET /fail HTTP/1\.1" 500 5 "-" "test/1\.0"$`)
+	if rec.Level != ERROR || !clf.MatchString(rec.Message) {
+		t.Errorf("HTTPMiddleware: combined format got %s %q", rec.Level, rec.Message)
+	}
+	l.Close()
+}
+
+func TestLogHTTPDump(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+
+	req, _ := http.NewRequest("POST", "http://example.com/login?x=1", strings.NewReader(`{"user":"bob","pass":"x"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", "k")
+	l.LogHTTPRequest(req, HTTPDumpOptions{Redact: []string{"x-api-key"}, MaxBody: 12})
+	want := "POST http://example.com/login?x=1 HTTP/1.1\n" +
+		"Authorization: [REDACTED]\nContent-Type: application/json\nX-Api-Key: [REDACTED]\n\n" +
+		`{"user":"bob…(truncated at 12 bytes)`
+	if mem.Len() != 1 || mem.recs[0].Message != want || mem.recs[0].Fields["method"] != "POST" {
+		t.Fatalf("LogHTTPRequest: got %q", mem.recs[0].Message)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != `{"user":"bob","pass":"x"}` {
+		t.Errorf("LogHTTPRequest: body left as %q", body)
+	}
+
+	resp := &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: 404,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Set-Cookie": {"sid=1"}, "Server": {"x"}},
+		Body:       ioutil.NopCloser(strings.NewReader("gone")),
+		Request:    req,
+	}
+	l.LogHTTPResponse(resp, HTTPDumpOptions{Headers: []string{"set-cookie"}, MaxBody: 100})
+	rec := mem.recs[1]
+	if rec.Message != "HTTP/1.1 404 Not Found\nSet-Cookie: [REDACTED]\n\ngone" || rec.Fields["status"] != 404 ||
+		rec.Fields["url"] != "http://example.com/login?x=1" || !strings.Contains(rec.Source, "TestLogHTTPDump") {
+		t.Errorf("LogHTTPResponse: got %q %v from %s", rec.Message, rec.Fields, rec.Source)
+	}
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	mem := new(memLogWriter)
+	defer func(saved *Logger) { log = saved }(log)
+	log = NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+
+	CapturePanics(func() {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if v := recover(); v != "again" {
+				t.Errorf("RecoverLogAndPanic: recovered %v", v)
+			}
+		}()
+		defer RecoverLogAndPanic(log)
+		panic("again")
+	}()
+	log.Flush()
+
+	if mem.Len() != 2 {
+		t.Fatalf("RecoverAndLog: expected 2 records, got %d", mem.Len())
+	}
+	rec := mem.recs[0]
+	if rec.Level != CRITICAL || !strings.HasPrefix(rec.Message, "panic: boom\n") ||
+		!strings.Contains(rec.Message, "goroutine ") {
+		t.Errorf("RecoverAndLog: got %s %q", rec.Level, rec.Message)
+	}
+	if !strings.Contains(rec.Source, "log4go_test.go") || !strings.Contains(rec.Source, "TestRecoverAndLog") {
+		t.Errorf("RecoverAndLog: source is %q", rec.Source)
+	}
+	if !strings.HasPrefix(mem.recs[1].Message, "panic: again\n") {
+		t.Errorf("RecoverLogAndPanic: got %q", mem.recs[1].Message)
+	}
+}
+
+func TestApacheFormats(t *testing.T) {
+	rec := newLogRecord(INFO, "http", "")
+	rec.Fields = Fields{
+		"remote": "10.0.0.1", "method": "GET", "uri": "/a?b=c", "proto": "HTTP/1.1",
+		"status": 200, "bytes": int64(42), "useragent": "curl/8.0",
+	}
+	want := `10.0.0.1 - - [13/Feb/2009:23:31:30 +0000] "GET /a?b=c HTTP/1.1" 200 42 "-" "curl/8.0"` + "\n"
+	if got := FormatLogRecord(FORMAT_COMBINED, rec); got != want {
+		t.Errorf("FORMAT_COMBINED: got %q, want %q", got, want)
+	}
+	if got := FormatLogRecord("%{status} %{unclosed", rec); got != "200 %{unclosed\n" {
+		t.Errorf("%%{key}: got %q", got)
+	}
+}
+
+func TestSIEMEncoders(t *testing.T) {
+	rec := newLogRecord(ERROR, "db|pool", "login failed\nfor bob")
+	rec.Fields = Fields{"user": "bob=admin", "src ip": "10.0.0.1"}
+
+	cef := &CEFEncoder{Vendor: "Acme", Product: "Billing", Version: "1.0"}
+	want := "CEF:0|Acme|Billing|1.0|EROR|login failed for bob|8|rt=1234567890123 cs1Label=source cs1=db|pool src_ip=10.0.0.1 user=bob\\=admin\n"
+	if got := string(cef.Encode(nil, rec)); got != want {
+		t.Errorf("CEFEncoder: got %q, want %q", got, want)
+	}
+
+	leef := &LEEFEncoder{Vendor: "Acme", Product: "Billing", Version: "1.0"}
+	want = "LEEF:1.0|Acme|Billing|1.0|EROR|devTime=1234567890123\tdevTimeFormat=epoch\tsev=8\tmsg=login failed for bob\tsource=db|pool\tsrc_ip=10.0.0.1\tuser=bob=admin\n"
+	if got := string(leef.Encode(nil, rec)); got != want {
+		t.Errorf("LEEFEncoder: got %q, want %q", got, want)
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	rec := newLogRecord(WARNING, "source", "disk \"sda\" at 91%, check")
+	rec.Fields = Fields{"host": "db1", "pct": 91}
+
+	enc := NewCSVEncoder("time", "level", "host", "missing", "pct", "message")
+	want := `2009-02-13T23:31:30.123456789Z,WARN,db1,,91,"disk ""sda"" at 91%, check"` + "\n"
+	if got := string(enc.Encode([]byte("x"), rec)); got != "x"+want {
+		t.Errorf("CSVEncoder: got %q, want %q", got, "x"+want)
+	}
+}
+
+func TestProtobufSocket(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer ln.Close()
+	got := make(chan []*LogRecord)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- nil
+			return
+		}
+		defer conn.Close()
+		var recs []*LogRecord
+		r := bufio.NewReader(conn)
+		for {
+			rec, err := ReadProtobufRecord(r)
+			if err != nil {
+				break
+			}
+			recs = append(recs, rec)
+		}
+		got <- recs
+	}()
+
+	w := NewSocketLogWriter("tcp", ln.Addr().String()).SetEncoder(ProtobufEncoder{})
+	rec := newLogRecord(WARNING, "source", "line one\nline two")
+	rec.Fields = Fields{"user": "bob", "n": 3}
+	rec.Name = "db"
+	w.BulkLogWrite([]*LogRecord{rec, newLogRecord(DEBUG, "", "")})
+	w.Close()
+
+	recs := <-got
+	if len(recs) != 2 {
+		t.Fatalf("ProtobufEncoder: decoded %d records, want 2", len(recs))
+	}
+	dec := recs[0]
+	if dec.Level != WARNING || !dec.Created.Equal(rec.Created) || dec.Source != "source" ||
+		dec.Message != rec.Message || dec.Name != "db" || dec.Fields["user"] != "bob" || dec.Fields["n"] != "3" {
+		t.Errorf("ProtobufEncoder: decoded %+v", dec)
+	}
+	if recs[1].Level != DEBUG || recs[1].Message != "" || recs[1].Fields != nil {
+		t.Errorf("ProtobufEncoder: decoded %+v", recs[1])
+	}
+
+	if _, err := UnmarshalProtobufRecord([]byte{0x1a, 0x05, 'a'}); err == nil {
+		t.Errorf("UnmarshalProtobufRecord: accepted a truncated record")
+	}
+}
+
+func TestDataPayload(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	l.LogData(INFO, map[string]interface{}{"id": 7, "tags": []string{"a", "b"}}, "order %d", 7)
+	l.LogData(INFO, []byte(`{"raw":true}`), "raw")
+	l.LogData(INFO, []byte("not json"), "bytes")
+	if mem.Len() != 3 {
+		t.Fatalf("LogData: wrote %d records, want 3", mem.Len())
+	}
+	rec := mem.recs[0]
+	if rec.Message != "order 7" || string(rec.Data) != `{"id":7,"tags":["a","b"]}` ||
+		!strings.Contains(rec.Source, "TestDataPayload") {
+		t.Errorf("LogData: got %+v", rec)
+	}
+	if string(mem.recs[1].Data) != `{"raw":true}` || string(mem.recs[2].Data) != `"not json"` {
+		t.Errorf("LogData: got payloads %s and %s", mem.recs[1].Data, mem.recs[2].Data)
+	}
+
+	// The payload survives a round trip through Json
+	js, _ := json.Marshal(rec)
+	l.Json(js)
+	if mem.Len() != 4 || string(mem.recs[3].Data) != string(rec.Data) {
+		t.Errorf("Json: payload not passed on")
+	}
+
+	if got := FormatLogRecord("%M %J", rec); got != `order 7 {"id":7,"tags":["a","b"]}`+"\n" {
+		t.Errorf("FormatLogRecord: %%J gave %q", got)
+	}
+	if got := string(JSONEncoder{}.Encode(nil, rec)); !strings.Contains(got, `"Data":{"id":7,"tags":["a","b"]}`) {
+		t.Errorf("JSONEncoder: got %s", got)
+	}
+	dec, err := ReadProtobufRecord(bufio.NewReader(bytes.NewReader(ProtobufEncoder{}.Encode(nil, rec))))
+	if err != nil || string(dec.Data) != string(rec.Data) {
+		t.Errorf("ProtobufEncoder: decoded %+v, %v", dec, err)
+	}
+}
+
+func TestLogHexDump(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(INFO, mem)).SetSync(true)
+	l.LogHexDump(INFO, "packet", []byte("GET / HTTP/1.1\r\n\x00"))
+	l.LogHexDump(DEBUG, "skipped", []byte("x"))
+	if mem.Len() != 1 {
+		t.Fatalf("LogHexDump: wrote %d records, want 1", mem.Len())
+	}
+	want := "packet (17 bytes)\n" +
+		"00000000  47 45 54 20 2f 20 48 54  54 50 2f 31 2e 31 0d 0a  |GET / HTTP/1.1..|\n" +
+		"00000010  00                                                |.|"
+	if rec := mem.recs[0]; rec.Message != want || !strings.Contains(rec.Source, "TestLogHexDump") {
+		t.Errorf("LogHexDump: got %q from %s", rec.Message, rec.Source)
+	}
+}
+
+func TestLineParser(t *testing.T) {
+	rec := &LogRecord{
+		Level:   WARNING,
+		Created: time.Date(2024, 3, 14, 16, 2, 55, 814856400, time.FixedZone("", -7*3600)),
+		Source:  "/src/db.go main.query:42",
+		Message: "slow query [1]",
+		Fields:  Fields{"user": "bob", "note": "a b", "n": 3},
+		Name:    "db",
+		Seq:     12,
+	}
+	for _, format := range []string{FORMAT_DEFAULT, "%D %m %Z [%L] %N#%q %s: %M {%F} %{user} %{missing} 100%%"} {
+		p, err := NewLineParser(format)
+		if err != nil {
+			t.Fatalf("NewLineParser(%q): %s", format, err)
+		}
+		got, err := p.Parse(FormatLogRecord(format, rec))
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", format, err)
+		}
+		if got.Level != WARNING || !strings.HasSuffix(rec.Source, got.Source) || got.Message != rec.Message {
+			t.Errorf("Parse(%q): got %+v", format, got)
+		}
+		if format == FORMAT_DEFAULT {
+			if got.Created.Format("2006/01/02 15:04:05") != "2024/03/14 16:02:55" {
+				t.Errorf("Parse(%q): created %s", format, got.Created)
+			}
+			continue
+		}
+		if !got.Created.Equal(rec.Created) || got.Name != "db" || got.Seq != 12 ||
+			got.Source != "db.go main.query:42" || got.Fields["user"] != "bob" || got.Fields["note"] != "a b" ||
+			got.Fields["n"] != "3" || len(got.Fields) != 3 {
+			t.Errorf("Parse(%q): got %+v", format, got)
+		}
+	}
+
+	p, _ := NewLineParser(FORMAT_SHORT)
+	if _, err := p.Parse("continued line"); err != ErrLineFormat {
+		t.Errorf("Parse: got %v for a line of another format", err)
+	}
+	if lvl, ok := ParseLevel("warn"); !ok || lvl != WARNING {
+		t.Errorf("ParseLevel: got %v, %v", lvl, ok)
+	}
+	if _, ok := ParseLevel("loud"); ok {
+		t.Errorf("ParseLevel: accepted an unknown level")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	l := NewLogger()
+	recs, cancel := l.Subscribe(WARNING)
+	all, cancelAll := l.Subscribe(DEBUG)
+	l.Debug("debug")
+	l.Warn("warn")
+	if rec := <-recs; rec.Message != "warn" {
+		t.Errorf("Subscribe: got %q", rec.Message)
+	}
+	if rec := <-all; rec.Message != "debug" {
+		t.Errorf("Subscribe: got %q", rec.Message)
+	}
+	cancel()
+	cancel()
+	if _, ok := <-recs; ok {
+		t.Errorf("Subscribe: channel not closed")
+	}
+	if !l.IsDebugEnabled() {
+		t.Errorf("Subscribe: DEBUG skipped with a DEBUG subscriber")
+	}
+
+	// A slow subscriber misses records instead of blocking
+	for i := 0; i < SUBSCRIBE_BUFFER+10; i++ {
+		l.Info("flood")
+	}
+	cancelAll()
+	n := 0
+	for range all {
+		n++
+	}
+	if n != SUBSCRIBE_BUFFER {
+		t.Errorf("Subscribe: buffered %d records, want %d", n, SUBSCRIBE_BUFFER)
+	}
+	// The unread "warn" took one place
+	if d := l.SubscribersDropped(); d != 11 {
+		t.Errorf("SubscribersDropped: got %d, want 11", d)
+	}
+	if l.IsEnabledFor(CRITICAL) {
+		t.Errorf("Subscribe: subscription not removed")
+	}
+
+	// Records sent to one filter, e.g. heartbeats, reach the subscribers too
+	mem := new(memLogWriter)
+	l.SetFilter("mem", NewFilter(INFO, mem))
+	defer l.Close()
+	recs, cancel = l.Subscribe(INFO)
+	defer cancel()
+	l.dispatchTo("mem", newLogRecord(INFO, "source", "heartbeat"))
+	if rec := <-recs; rec.Message != "heartbeat" {
+		t.Errorf("Subscribe: got %q for a record sent to one filter", rec.Message)
+	}
+}
+
+func TestMsgpackEncoder(t *testing.T) {
+	rec := newLogRecord(ERROR, "src", "msg")
+	rec.Fields = Fields{"n": -300, "ok": true}
+
+	want := []byte{0x85,
+		0xa5, 'L', 'e', 'v', 'e', 'l', 0x04,
+		0xa7, 'C', 'r', 'e', 'a', 't', 'e', 'd', 0xc7, 12, 0xff,
+		0x07, 0x5b, 0xcd, 0x15, 0, 0, 0, 0, 0x49, 0x96, 0x02, 0xd2,
+		0xa6, 'S', 'o', 'u', 'r', 'c', 'e', 0xa3, 's', 'r', 'c',
+		0xa7, 'M', 'e', 's', 's', 'a', 'g', 'e', 0xa3, 'm', 's', 'g',
+		0xa6, 'F', 'i', 'e', 'l', 'd', 's', 0x82,
+		0xa1, 'n', 0xd1, 0xfe, 0xd4,
+		0xa2, 'o', 'k', 0xc3,
+	}
+	if got := (MsgpackEncoder{}).Encode(nil, rec); !bytes.Equal(got, want) {
+		t.Errorf("MsgpackEncoder: got % x\nwant % x", got, want)
+	}
+}
+
+func TestSocketTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	defer srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer ln.Close()
+	got := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		got <- line
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	w := NewSocketLogWriter("tcp", ln.Addr().String()).
+		SetEncoder(JSONEncoder{}).
+		SetTLS(&tls.Config{RootCAs: roots})
+	if err := w.LogWriteErr(newLogRecord(INFO, "source", "secret")); err != nil {
+		t.Fatalf("SocketLogWriter: %s", err)
+	}
+	if line := <-got; !strings.Contains(line, `"Message":"secret"`) {
+		t.Errorf("SocketLogWriter: server read %q", line)
+	}
+	w.Close()
+
+	if _, err := LoadTLSConfig("missing-ca.pem", "", ""); err == nil {
+		t.Errorf("LoadTLSConfig: accepted a missing CA file")
+	}
+}
+
+func TestHTTPLogWriter(t *testing.T) {
+	type request struct {
+		contentType, auth string
+		rec               *LogRecord
+	}
+	reqs := make(chan request, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var rec *LogRecord
+		if r.Header.Get("Content-Type") == "application/x-protobuf" {
+			rec, _ = ReadProtobufRecord(bufio.NewReader(bytes.NewReader(body)))
+		} else {
+			rec = new(LogRecord)
+			json.Unmarshal(body, rec)
+		}
+		reqs <- request{r.Header.Get("Content-Type"), r.Header.Get("Authorization"), rec}
+		if r.URL.Path == "/down" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	w := NewHTTPLogWriter(srv.URL).SetHeader("Authorization", "Bearer t0k")
+	defer w.Close()
+	if err := w.LogWriteErr(newLogRecord(ERROR, "source", "posted")); err != nil {
+		t.Fatalf("LogWriteErr: %s", err)
+	}
+	if r := <-reqs; r.contentType != "application/json" || r.auth != "Bearer t0k" || r.rec.Message != "posted" || r.rec.Level != ERROR {
+		t.Errorf("LogWriteErr: server got %+v", r)
+	}
+
+	w = NewHTTPLogWriter(srv.URL + "/down").SetEncoder(ProtobufEncoder{})
+	defer w.Close()
+	if err := w.LogWriteErr(newLogRecord(INFO, "source", "refused")); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("LogWriteErr: got %v for a 503", err)
+	}
+	if r := <-reqs; r.contentType != "application/x-protobuf" || r.rec == nil || r.rec.Message != "refused" {
+		t.Errorf("LogWriteErr: server got %+v", r)
+	}
+}
+
+func TestSocketFraming(t *testing.T) {
+	tests := []struct {
+		framing Framing
+		want    string
+	}{
+		{FramingNone, "prev|a\nb"},
+		{FramingNewline, "prev|a\nb\n"},
+		{FramingLength, "prev|\x00\x00\x00\x03a\nb"},
+		{FramingOctet, "prev|3 a\nb"},
+	}
+	for _, test := range tests {
+		dst := append([]byte("prev|"), "a\nb"...)
+		if got := string(frameRecord(dst, 5, test.framing)); got != test.want {
+			t.Errorf("frameRecord(%s): got %q, want %q", test.framing, got, test.want)
+		}
+	}
+
+	w := NewSocketLogWriter("udp", "127.0.0.1:1").SetFraming(FramingOctet)
+	if data, _ := w.encode(nil, newLogRecord(INFO, "", "")); data[0] != '{' {
+		t.Errorf("SocketLogWriter: framed a datagram: %q", data)
+	}
+}
+
+func TestTailHandler(t *testing.T) {
+	hub := NewBroadcastLogWriter()
+	l := NewLogger().SetFilter("tail", NewFilter(DEBUG, hub))
+	srv := httptest.NewServer(TailHandler(hub))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?level=warn&format=sse")
+	if err != nil {
+		t.Fatalf("TailHandler: %s", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("TailHandler: content type %q", ct)
+	}
+
+	l.Info("quiet")
+	l.Warn("loud")
+	r := bufio.NewReader(resp.Body)
+	line, _ := r.ReadString('\n')
+	if !strings.HasPrefix(line, "data: {") || !strings.Contains(line, `"Message":"loud"`) {
+		t.Errorf("TailHandler: got %q", line)
+	}
+
+	l.Close()
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Errorf("TailHandler: %s", err)
+	}
+	if _, err := r.ReadString('\n'); err != io.EOF {
+		t.Errorf("TailHandler: stream not ended by Close: %v", err)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	config := func(lvl string) string {
+		return `{"Filters": [{"Enabled": "true", "Tag": "stdout", "Type": "console", "Level": "` + lvl + `"}]}`
+	}
+
+	var mu sync.Mutex
+	index, value := 1, config("DEBUG")
+	changed := make(chan bool)
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/app/logging" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		current := strconv.Itoa(index)
+		mu.Unlock()
+		if r.FormValue("index") == current {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		io.WriteString(w, value)
+	}))
+	defer consul.Close()
+
+	log := NewLogger()
+	defer log.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- log.WatchConfig(ctx, &ConsulSource{Addr: consul.URL, Key: "app/logging"}, "logging.json")
+	}()
+
+	for i := 0; i < 100 && log.Filter("stdout") == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if filt := log.Filter("stdout"); filt == nil || filt.Level != DEBUG {
+		t.Fatalf("WatchConfig: first configuration not applied")
+	}
+	mu.Lock()
+	index, value = 2, config("ERROR")
+	mu.Unlock()
+	close(changed)
+	for i := 0; i < 100 && log.Filter("stdout").Level != ERROR; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lvl := log.Filter("stdout").Level; lvl != ERROR {
+		t.Errorf("WatchConfig: level %d after change, want ERROR", lvl)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WatchConfig: returned %v, want context.Canceled", err)
+	}
+
+	// A broken configuration keeps the filters
+	if err := log.ReloadConfigBuf("logging.json", []byte(config("LOUD"))); err == nil {
+		t.Errorf("ReloadConfigBuf: no error for an unknown level")
+	}
+	if filt := log.Filter("stdout"); filt == nil || filt.Level != ERROR {
+		t.Errorf("ReloadConfigBuf: filters changed by a broken configuration")
+	}
+
+	etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		val := base64.StdEncoding.EncodeToString([]byte(config("WARNING")))
+		fmt.Fprintf(w, `{"header": {"revision": "9"}, "kvs": [{"value": %q, "mod_revision": "7"}]}`, val)
+	}))
+	defer etcd.Close()
+	buf, rev, err := (&EtcdSource{Endpoint: etcd.URL, Key: "/app/logging"}).Watch(context.Background(), 0)
+	if err != nil || rev != 7 || string(buf) != config("WARNING") {
+		t.Errorf("EtcdSource: got %q, %d, %v", buf, rev, err)
+	}
+}
+
+func TestConfigInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, contents string) string {
+		name = dir + "/" + name
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		return name
+	}
+	write("base.json", `{"Filters": [
+		{"Enabled": "true", "Tag": "stdout", "Type": "console", "Level": "DEBUG"},
+		{"Enabled": "true", "Tag": "extra", "Type": "console", "Level": "INFO"}]}`)
+	service := write("service.xml", `<logging>
+		<include>base.json</include>
+		<filter enabled="true"><tag>stdout</tag><type>console</type><level>ERROR</level></filter>
+		<filter enabled="false"><tag>extra</tag><type>console</type><level>INFO</level></filter>
+	</logging>`)
+
+	log := NewLogger()
+	defer log.Close()
+	if err := log.ReloadConfig(service); err != nil {
+		t.Fatalf("ReloadConfig: %s", err)
+	}
+	if filters := log.load().filters; len(filters) != 1 || filters["stdout"] == nil || filters["stdout"].Level != ERROR {
+		t.Errorf("ReloadConfig: included filters not overridden: %v", filters)
+	}
+
+	write("a.json", `{"Include": ["b.toml"]}`)
+	write("b.toml", `Include = ["a.json"]`)
+	err = log.ReloadConfig(dir + "/a.json")
+	if err == nil || !strings.Contains(err.Error(), "could not load") {
+		t.Errorf("ReloadConfig: include cycle not detected: %v", err)
+	}
+	if log.Filter("stdout") == nil {
+		t.Errorf("ReloadConfig: filters changed by a broken configuration")
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	lf := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-log.level", "warning", "-log.file", filepath.Join(dir, "logs", "tool.log"), "-log.format", "%L %M"}); err != nil {
+		t.Fatal(err)
+	}
+	log := NewLogger()
+	if err := lf.Apply(log); err != nil {
+		t.Fatalf("Apply: %s", err)
+	}
+	log.Info("hidden")
+	log.Warn("shown")
+	log.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "logs", "tool-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("Apply: expected 1 file, found %v", files)
+	}
+	if contents, _ := ioutil.ReadFile(files[0]); string(contents) != "WARN shown\n" {
+		t.Errorf("Apply: file holds %q", contents)
+	}
+
+	log = NewLogger().SetFilter("keep", NewFilter(INFO, new(memLogWriter)))
+	defer log.Close()
+	for _, bad := range []Flags{{Level: "loud"}, {Config: "log.xml", Level: "INFO"}, {Config: filepath.Join(dir, "missing.xml")}} {
+		if err := bad.Apply(log); err == nil || log.Filter("keep") == nil {
+			t.Errorf("Apply: %+v gave %v", bad, err)
+		}
+	}
+	if err := (&Flags{Format: "json"}).Apply(log); err != nil || log.Filter("stdout") == nil || log.Filter("keep") != nil {
+		t.Errorf("Apply: standard output gave %v, %v", err, log.Filters())
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	cfg := configFromEnv([]string{"HOME=/root"})
+	if len(cfg.Filters) != 1 || cfg.Filters[0].Tag != "stdout" || cfg.Filters[0].Level != "INFO" {
+		t.Errorf("ConfigFromEnv: empty environment gave %+v", cfg.Filters)
+	}
+
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg = configFromEnv([]string{
+		"LOG4GO_LEVEL=DEBUG",
+		"LOG4GO_CONSOLE_ENABLED=false",
+		"LOG4GO_FILE_PATH=" + dir,
+		"LOG4GO_FILE_FILENAME=app",
+		"LOG4GO_FILE_ROTATE_SIZE=1MB",
+		"LOG4GO_FILE_FORMAT=%L %M",
+		"LOG4GO_SOCKET_LEVEL=ERROR",
+		"LOG4GO_SOCKET_ENDPOINT=127.0.0.1:1",
+		"LOG4GO_SOCKET_PROTOCOL=udp",
+	})
+	log := NewLogger()
+	defer log.Close()
+	if err := log.replaceConfig(&configLoad{name: ENV_CONFIG_NAME}, cfg); err != nil {
+		t.Fatalf("ConfigFromEnv: %s", err)
+	}
+	filters := log.load().filters
+	if len(filters) != 2 || filters["file"] == nil || filters["file"].Level != DEBUG || filters["socket"].Level != ERROR {
+		t.Fatalf("ConfigFromEnv: got %v", filters)
+	}
+	if flw, ok := filters["file"].LogWriter.(*FileLogWriter); !ok || flw.format != "%L %M" {
+		t.Errorf("ConfigFromEnv: file writer %+v", filters["file"].LogWriter)
+	}
+
+	cfg = configFromEnv([]string{"LOG4GO_CONSOLE_LEVEL=LOUD"})
+	if err := log.replaceConfig(&configLoad{name: ENV_CONFIG_NAME}, cfg); err == nil || !strings.Contains(err.Error(), ENV_CONFIG_NAME) || log.Filter("file") == nil {
+		t.Errorf("ConfigFromEnv: bad level gave %v", err)
+	}
+}
+
+func TestConfigReaderFS(t *testing.T) {
+	log := NewLogger()
+	defer log.Close()
+	toml := `[filters.out]
+type = "console"
+level = "WARNING"`
+	if err := log.ReloadConfigReader(strings.NewReader(toml), "TOML"); err != nil {
+		t.Fatalf("ReloadConfigReader: %s", err)
+	}
+	if filt := log.Filter("out"); filt == nil || filt.Level != WARNING {
+		t.Errorf("ReloadConfigReader: got %v", log.Filters())
+	}
+	if err := log.ReloadConfigReader(strings.NewReader(toml), "yaml"); err == nil || log.Filter("out") == nil {
+		t.Errorf("ReloadConfigReader: unknown type gave %v", err)
+	}
+	if err := log.ReloadConfigBytes([]byte(`{"filters": {"bytes": {"type": "console", "level": "ERROR"}}}`), "json"); err != nil {
+		t.Fatalf("ReloadConfigBytes: %s", err)
+	}
+	if filt := log.Filter("bytes"); filt == nil || filt.Level != ERROR || log.Filter("out") != nil {
+		t.Errorf("ReloadConfigBytes: got %v", log.Filters())
+	}
+
+	fsys := fstest.MapFS{
+		"conf/base.json": {Data: []byte(`{"filters": {"base": {"type": "console", "level": "DEBUG"}}}`)},
+		"conf/app.xml": {Data: []byte(`<logging>
+			<include>base.json</include>
+			<filter enabled="true"><tag>app</tag><type>console</type><level>ERROR</level></filter>
+		</logging>`)},
+		"conf/loop.toml": {Data: []byte(`include = ["../conf/loop.toml"]`)},
+	}
+	if err := log.ReloadConfigFS(fsys, "conf/app.xml"); err != nil {
+		t.Fatalf("ReloadConfigFS: %s", err)
+	}
+	if filters := log.load().filters; len(filters) != 2 || filters["base"] == nil || filters["app"].Level != ERROR {
+		t.Errorf("ReloadConfigFS: got %v", filters)
+	}
+	if err := log.ReloadConfigFS(fsys, "conf/loop.toml"); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("ReloadConfigFS: include cycle gave %v", err)
+	}
+	if err := log.ReloadConfigFS(fsys, "conf/missing.xml"); err == nil || log.Filter("app") == nil {
+		t.Errorf("ReloadConfigFS: missing file gave %v", err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := dir + "/good.xml"
+	ioutil.WriteFile(good, []byte(`<logging>
+		<filter enabled="true"><tag>file</tag><type>file</type><level>INFO</level>
+			<property name="filename">`+dir+`/app</property></filter>
+	</logging>`), 0644)
+	if err := CheckConfig(good); err != nil {
+		t.Errorf("CheckConfig: %s", err)
+	}
+
+	bad := dir + "/bad.xml"
+	ioutil.WriteFile(bad, []byte(`<logging>
+		<filter enabled="true"><tag>a</tag><type>console</type><level>LOUD</level></filter>
+		<filter enabled="true"><tag>b</tag><type>file</type><level>INFO</level>
+			<property name="filename">`+dir+`/app</property>
+			<property name="nametemplate">{{.Nope</property>
+			<property name="colour">red</property></filter>
+		<filter enabled="true"><tag>c</tag><type>socket</type><level>INFO</level></filter>
+	</logging>`), 0644)
+	err = CheckConfig(bad)
+	cerr, ok := err.(*ConfigError)
+	if !ok || len(cerr.Errors) != 3 || len(cerr.Warnings) != 1 || !strings.Contains(cerr.Warnings[0], `"colour"`) {
+		t.Fatalf("CheckConfig: got %#v", err)
+	}
+	if !strings.HasPrefix(err.Error(), `could not load configuration in "`+bad+`": Required child <level>`) {
+		t.Errorf("CheckConfig: got %q", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("CheckConfig: created files")
+	}
+
+	log := NewLogger()
+	defer log.Close()
+	if err := log.ReloadConfig(bad); !reflect.DeepEqual(err, cerr) {
+		t.Errorf("ReloadConfig: got %v", err)
+	}
+}
+
+func TestRegisterWriterType(t *testing.T) {
+	var made []*memLogWriter
+	RegisterWriterType("testmem", func(props []Property) (LogWriter, error) {
+		for _, prop := range props {
+			if prop.Name != "size" {
+				return nil, fmt.Errorf("unknown property %q", prop.Name)
+			}
+		}
+		mem := new(memLogWriter)
+		made = append(made, mem)
+		return mem, nil
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("RegisterWriterType: no panic for a taken name")
+			}
+		}()
+		RegisterWriterType("file", func([]Property) (LogWriter, error) { return nil, nil })
+	}()
+
+	log := NewLogger()
+	defer log.Close()
+	err := log.ReloadConfigBuf("test.xml", []byte(`<logging>
+		<filter enabled="true"><tag>mem</tag><type>testmem</type><level>INFO</level>
+			<property name="size">10</property><property name="queuesize">4</property></filter>
+	</logging>`))
+	if err != nil || len(made) != 1 || log.load().filters["mem"].LogWriter != made[0] {
+		t.Fatalf("ReloadConfigBuf: got %v with %d writers made", err, len(made))
+	}
+
+	err = log.ReloadConfigBuf("test.xml", []byte(`<logging>
+		<filter enabled="true"><tag>mem</tag><type>testmem</type><level>INFO</level>
+			<property name="colour">red</property></filter>
+	</logging>`))
+	if err == nil || !strings.Contains(err.Error(), `testmem writer: unknown property "colour"`) {
+		t.Errorf("ReloadConfigBuf: got %v", err)
+	}
+}
+
+func TestConfigVersion(t *testing.T) {
+	v2 := `
+version = 2
+[filters.out]
+type = "socket"
+level = "INFO"
+endpoint = "127.0.0.1:5140"
+[filters.out.tls]
+enabled = true
+ca = "ca.pem"
+[filters.out.queue]
+size = 4
+`
+	if err := CheckConfigBuf("test.toml", []byte(v2)); err != nil {
+		t.Errorf("CheckConfigBuf(v2): %s", err)
+	}
+
+	log := NewLogger()
+	defer log.Close()
+	if err := log.ReloadConfigBuf("test.json", []byte(`{"version": 2, "filters": {"mem": {"type": "console", "level": "INFO", "queue": {"size": 4}}}}`)); err != nil {
+		t.Fatalf("ReloadConfigBuf(v2): %s", err)
+	}
+	if size := log.load().filters["mem"].Stats().QueueSize; size != 4 {
+		t.Errorf("ReloadConfigBuf(v2): queue of %d", size)
+	}
+
+	// Names of the other version are understood, with a warning
+	v1 := `<logging><filter enabled="true"><tag>out</tag><type>socket</type><level>INFO</level>
+		<property name="endpoint">127.0.0.1:5140</property><property name="tls.ca">ca.pem</property></filter></logging>`
+	cerr, ok := CheckConfigBuf("test.xml", []byte(v1)).(*ConfigError)
+	if !ok || len(cerr.Errors) != 0 || len(cerr.Warnings) != 1 || !strings.Contains(cerr.Warnings[0], "needs configuration version 2") {
+		t.Errorf("CheckConfigBuf(v1): got %#v", cerr)
+	}
+	v1 = strings.Replace(strings.Replace(v1, "tls.ca", "ca", 1), "<logging>", `<logging version="2">`, 1)
+	cerr, ok = CheckConfigBuf("test.xml", []byte(v1)).(*ConfigError)
+	if !ok || len(cerr.Warnings) != 1 || !strings.Contains(cerr.Warnings[0], `is named "tls.ca"`) {
+		t.Errorf("CheckConfigBuf(v2): got %#v", cerr)
+	}
+
+	err := CheckConfigBuf("test.toml", []byte("version = 3\n"))
+	if err == nil || !strings.Contains(err.Error(), "unsupported configuration version 3") {
+		t.Errorf("CheckConfigBuf(v3): got %v", err)
+	}
+}
+
+func TestNestedConfig(t *testing.T) {
+	tomlConfig := `
+include = []
+
+[filters.stdout]
+type = "console"
+level = "WARNING"
+color = false
+format = "%L %M"
+
+[filters.off]
+type = "console"
+level = "INFO"
+enabled = false
+`
+	log := NewLogger()
+	defer log.Close()
+	if err := log.ReloadConfigBuf("nested.toml", []byte(tomlConfig)); err != nil {
+		t.Fatalf("ReloadConfigBuf(toml): %s", err)
+	}
+	if filters := log.load().filters; len(filters) != 1 || filters["stdout"] == nil || filters["stdout"].Level != WARNING {
+		t.Errorf("ReloadConfigBuf(toml): got filters %v", filters)
+	}
+
+	jsonConfig := `{"filters": {"csv": {"type": "console", "level": "ERROR", "encoding": "csv", "columns": ["level", "message"]}}}`
+	if err := log.ReloadConfigBuf("nested.json", []byte(jsonConfig)); err != nil {
+		t.Fatalf("ReloadConfigBuf(json): %s", err)
+	}
+	if filt := log.Filter("csv"); filt == nil || filt.Level != ERROR || log.Filter("stdout") != nil {
+		t.Errorf("ReloadConfigBuf(json): got filters %v", log.Filters())
+	}
+
+	cfg := new(Config)
+	if err := unmarshalConfig(json.Unmarshal, []byte(`{"filters": {"bad": {"type": {"x": 1}}}}`), cfg); err == nil {
+		t.Errorf("unmarshalConfig: no error for a table setting")
+	}
+}
+
+func TestConfigWriters(t *testing.T) {
+	xmlConfig := `<logging>
+		<filter enabled="true">
+			<tag>out</tag>
+			<level>INFO</level>
+			<property name="queuesize">10</property>
+			<writer type="console"><property name="format">%M</property></writer>
+			<writer type="socket"><property name="endpoint">127.0.0.1:9</property><property name="protocol">udp</property></writer>
+		</filter>
+	</logging>`
+	log := NewLogger()
+	defer log.Close()
+	if err := log.ReloadConfigBuf("writers.xml", []byte(xmlConfig)); err != nil {
+		t.Fatalf("ReloadConfigBuf(xml): %s", err)
+	}
+	filt := log.Filter("out")
+	if filt == nil {
+		t.Fatalf("ReloadConfigBuf(xml): no filter")
+	}
+	tee, ok := filt.LogWriter.(*TeeLogWriter)
+	if !ok || len(tee.Writers()) != 2 {
+		t.Fatalf("ReloadConfigBuf(xml): writer %T, want a TeeLogWriter of 2", filt.LogWriter)
+	}
+	if _, ok := tee.Writers()[0].(*ConsoleLogWriter); !ok {
+		t.Errorf("ReloadConfigBuf(xml): first writer %T", tee.Writers()[0])
+	}
+	if _, ok := tee.Writers()[1].(*SocketLogWriter); !ok {
+		t.Errorf("ReloadConfigBuf(xml): second writer %T", tee.Writers()[1])
+	}
+
+	tomlConfig := `
+[filters.out]
+type = "console"
+level = "ERROR"
+
+[[filters.out.writers]]
+type = "console"
+format = "%L %M"
+`
+	if err := log.ReloadConfigBuf("writers.toml", []byte(tomlConfig)); err != nil {
+		t.Fatalf("ReloadConfigBuf(toml): %s", err)
+	}
+	filt = log.Filter("out")
+	if tee, ok := filt.LogWriter.(*TeeLogWriter); !ok || len(tee.Writers()) != 2 || filt.Level != ERROR {
+		t.Errorf("ReloadConfigBuf(toml): writer %T at %d", filt.LogWriter, filt.Level)
+	}
+
+	if err := log.ReloadConfigBuf("writers.json", []byte(`{"filters": {"out": {"level": "INFO", "writers": [{"type": "nope"}]}}}`)); err == nil {
+		t.Errorf("ReloadConfigBuf(json): no error for an unknown writer type")
+	}
+}
+
+func TestTagRouting(t *testing.T) {
+	db, app, audit := new(memLogWriter), new(memLogWriter), new(memLogWriter)
+	l := NewLogger().
+		SetFilter("db", NewFilter(INFO, db).AddTag("db*")).
+		SetFilter("app", NewFilter(DEBUG, app)).
+		SetFilter("audit", NewFilter(DEBUG, audit))
+
+	l.Tag("db").Info("query")
+	line := callerLine(1)
+	l.Tag("dbpool").Debug("below the db level")
+	l.Tag("audit").Info("login")
+	l.Tag("other").Named("x").Info("tagged elsewhere")
+	l.Info("plain")
+	l.Flush()
+	if db.Len() > 0 {
+		checkSource(t, "Tag", db.recs[0], line)
+	}
+
+	got := func(mem *memLogWriter) (lines []string) {
+		for _, rec := range mem.recs {
+			lines = append(lines, FormatLogRecord("%G %M", rec))
+		}
+		return lines
+	}
+	check := func(name string, mem *memLogWriter, want ...string) {
+		if lines := got(mem); strings.Join(lines, "") != strings.Join(want, "") {
+			t.Errorf("Tag: filter %s got %q, want %q", name, lines, want)
+		}
+	}
+	check("db", db, "db query\n")
+	check("app", app, "other tagged elsewhere\n", " plain\n")
+	check("audit", audit, "audit login\n", "other tagged elsewhere\n", " plain\n")
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+
+	var outgoing string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outgoing = r.Header.Get(REQUEST_ID_HEADER)
+	}))
+	defer backend.Close()
+	client := &http.Client{Transport: &RequestIDTransport{}}
+
+	h := RequestIDMiddleware(l)(HTTPMiddleware(l, HTTPOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("handling")
+		req, _ := http.NewRequest("GET", backend.URL, nil)
+		if resp, err := client.Do(req.WithContext(r.Context())); err == nil {
+			resp.Body.Close()
+		}
+	})))
+
+	req := httptest.NewRequest("GET", "/a", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	l.Flush()
+
+	if id := w.Header().Get(REQUEST_ID_HEADER); id != "abc-123" {
+		t.Errorf("RequestIDMiddleware: response ID %q", id)
+	}
+	if outgoing != "abc-123" {
+		t.Errorf("RequestIDTransport: passed on ID %q", outgoing)
+	}
+	if mem.Len() != 2 {
+		t.Fatalf("RequestIDMiddleware: expected 2 records, got %d", mem.Len())
+	}
+	for _, rec := range mem.recs {
+		if rec.Fields[REQUEST_ID_FIELD] != "abc-123" {
+			t.Errorf("RequestIDMiddleware: record %q has fields %v", rec.Message, rec.Fields)
+		}
+	}
+
+	// Missing or unsafe IDs are replaced
+	req = httptest.NewRequest("GET", "/b", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "bad\nid")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if id := w.Header().Get(REQUEST_ID_HEADER); len(id) != 32 {
+		t.Errorf("RequestIDMiddleware: generated ID %q", id)
+	}
+	l.Close()
+}
+
+func TestPrintMethods(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(INFO, mem))
+
+	var printer interface {
+		Print(v ...interface{})
+		Printf(format string, v ...interface{})
+		Println(v ...interface{})
+	} = l
+	printer.Print("a", 1, 2, "b")
+	printer.Printf("%d%%", 50)
+	printer.Println("c", 3)
+	l.Logf(INFO, "d%d", 4)
+	line := callerLine(4)
+	l.Close()
+
+	want := []string{"a1 2b", "50%", "c 3", "d4"}
+	if mem.Len() != len(want) {
+		t.Fatalf("Print: expected %d records, got %d", len(want), mem.Len())
+	}
+	for i, rec := range mem.recs {
+		if rec.Level != INFO || rec.Message != want[i] {
+			t.Errorf("Print: record %d is %v %q, expected INFO %q", i, rec.Level, rec.Message, want[i])
+		}
+		checkSource(t, "Print: record "+strconv.Itoa(i), rec, line+i)
+	}
+}
+
+type stackError struct{ msg string }
+
+func (e *stackError) Error() string        { return e.msg }
+func (e *stackError) StackTrace() []string { return []string{"main.go:1", "lib.go:2"} }
+
+func TestErrorFields(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+
+	base := &stackError{"disk full"}
+	err := l.ErrorErr(fmt.Errorf("saving: %w", base), "upload failed", Fields{"user": "bob"})
+	if !errors.Is(err, base) || err.Error() != "upload failed: saving: disk full" {
+		t.Errorf("ErrorErr: returned %v", err)
+	}
+	werr := l.Warn("retrying %s", "host", base)
+	if !errors.Is(werr, base) || werr.Error() != "retrying host: disk full" {
+		t.Errorf("Warn: returned %v", werr)
+	}
+	l.Info("wrapped %w", base)
+	l.Debug("plain %d%%", 5)
+	l.Close()
+
+	if mem.Len() != 4 {
+		t.Fatalf("ErrorErr: expected 4 records, got %d", mem.Len())
+	}
+	rec := mem.recs[0]
+	if rec.Level != ERROR || rec.Message != "upload failed: saving: disk full" || rec.Fields["user"] != "bob" ||
+		rec.Fields[ERROR_TYPE_FIELD] != "*fmt.wrapError" || rec.Fields[ERROR_STACK_FIELD] != "[main.go:1 lib.go:2]" {
+		t.Errorf("ErrorErr: got %q %v", rec.Message, rec.Fields)
+	}
+	if rec := mem.recs[1]; rec.Message != "retrying host: disk full" || rec.Fields[ERROR_FIELD] != "disk full" {
+		t.Errorf("Warn: got %q %v", rec.Message, rec.Fields)
+	}
+	if rec := mem.recs[2]; rec.Message != "wrapped disk full" || rec.Fields[ERROR_TYPE_FIELD] != "*log4go.stackError" {
+		t.Errorf("Info: got %q %v", rec.Message, rec.Fields)
+	}
+	if rec := mem.recs[3]; rec.Message != "plain 5%" || rec.Fields != nil {
+		t.Errorf("Debug: got %q %v", rec.Message, rec.Fields)
+	}
+}
+
+func TestIsEnabledFor(t *testing.T) {
+	l := NewLogger()
+	if l.IsEnabledFor(CRITICAL) {
+		t.Errorf("IsEnabledFor: enabled without filters")
+	}
+	l.AddFilter("mem", INFO, new(memLogWriter))
+	defer l.Close()
+	if l.IsDebugEnabled() || l.IsTraceEnabled() || !l.IsInfoEnabled() || !l.IsWarnEnabled() || !l.IsErrorEnabled() {
+		t.Errorf("IsEnabledFor: wrong levels enabled at INFO")
+	}
+	l.Filter("mem").SetSourceLevel("*", DEBUG)
+	if !l.Named("child").IsDebugEnabled() {
+		t.Errorf("IsEnabledFor: source level rule not seen")
+	}
+}
+
+func TestLevelFormats(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewConsoleLogWriter().SetFormat("%M").SetLevelFormat(ERROR, "%L %M (%s)")
+	w.iow = buf
+	w.LogWrite(&LogRecord{Level: INFO, Source: "a.go:1", Message: "fine"})
+	w.LogWrite(&LogRecord{Level: ERROR, Source: "a.go:2", Message: "broken"})
+	w.Close()
+	if got, want := buf.String(), "fine\nEROR broken (a.go:2)\n"; got != want {
+		t.Errorf("SetLevelFormat: got %q, want %q", got, want)
+	}
+
+	props := []Property{{"format", "%M"}, {"format.debug", "%M %S"}, {"format.warn", "%L %M"}}
+	clw, ok := propToConsoleLogWriter(&configLoad{name: "test.xml"}, props, true)
+	if !ok || clw.formats[DEBUG] != "%M %S" || clw.formats[WARNING] != "%L %M" || len(clw.formats) != 2 {
+		t.Errorf("propToConsoleLogWriter: got formats %v", clw.formats)
+	}
+	if clw != nil {
+		clw.Close()
+	}
+	if _, ok := propToFileLogWriter(&configLoad{name: "test.xml"}, []Property{{"format.loud", "%M"}}, false); ok {
+		t.Errorf("propToFileLogWriter: no error for an unknown level")
+	}
+}
+
+func TestConsoleTheme(t *testing.T) {
+	for spec, want := range map[string]string{
+		"red":              "\x1b[0;31m",
+		"yellow/blue,bold": "\x1b[0;33;44;1m",
+		"208":              "\x1b[0;38;5;208m",
+		"#ff8800/236":      "\x1b[0;38;2;255;136;0;48;5;236m",
+	} {
+		style, err := parseStyle(spec)
+		if err != nil || style.escape() != want {
+			t.Errorf("parseStyle(%q): got %q, %v, want %q", spec, style.escape(), err, want)
+		}
+	}
+	if _, err := parseStyle("red,blink"); err == nil {
+		t.Errorf("parseStyle: no error for an unknown flag")
+	}
+
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	defer os.Setenv("CLICOLOR_FORCE", os.Getenv("CLICOLOR_FORCE"))
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("CLICOLOR_FORCE", "1")
+	if !colorFromEnv(false) {
+		t.Errorf("colorFromEnv: CLICOLOR_FORCE ignored")
+	}
+	os.Setenv("NO_COLOR", "1")
+	if colorFromEnv(true) {
+		t.Errorf("colorFromEnv: NO_COLOR ignored")
+	}
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("CLICOLOR_FORCE", "")
+
+	buf := new(bytes.Buffer)
+	w := NewConsoleLogWriter().SetFormat("%M").SetColor(true).SetTheme(Theme{ERROR: {Fg: ColorRGB(1, 2, 3)}})
+	w.iow = buf
+	w.LogWrite(&LogRecord{Level: INFO, Message: "plain"})
+	w.LogWrite(&LogRecord{Level: ERROR, Message: "red"})
+	w.Close()
+	if got, want := buf.String(), "plain\n\x1b[0;38;2;1;2;3mred\x1b[0m\n"; got != want {
+		t.Errorf("SetTheme: got %q, want %q", got, want)
+	}
+}
+
+func TestConsoleColorLines(t *testing.T) {
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	defer os.Setenv("CLICOLOR_FORCE", os.Getenv("CLICOLOR_FORCE"))
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("CLICOLOR_FORCE", "")
+
+	buf := new(bytes.Buffer)
+	w := NewConsoleLogWriter().SetFormat("%L %M").SetColor(true)
+	w.iow = buf
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				lvl := Level(i % len(levelStrings))
+				w.LogWrite(&LogRecord{Level: lvl, Message: fmt.Sprintf("%d-%d\n%s continued", g, i, levelStrings[lvl])})
+			}
+		}(g)
+	}
+	wg.Wait()
+	w.Close()
+
+	theme := DefaultTheme()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 8*50*2 {
+		t.Fatalf("SetColor: expected %d lines, got %d", 8*50*2, len(lines))
+	}
+	for _, line := range lines {
+		var lvl Level = -1
+		for l, name := range levelStrings {
+			if style, ok := theme[Level(l)]; ok && strings.HasPrefix(line, style.escape()+name+" ") {
+				lvl = Level(l)
+			}
+		}
+		if lvl < 0 || !strings.HasSuffix(line, colorReset) || strings.Count(line, "\x1b[") != 2 {
+			t.Fatalf("SetColor: line %q does not carry its own color and reset", line)
+		}
+	}
+
+	for _, env := range []struct {
+		noColor string
+		color   bool
+	}{{"1", true}, {"", false}} {
+		os.Setenv("NO_COLOR", env.noColor)
+		buf.Reset()
+		w := NewConsoleLogWriter().SetFormat("%L %M").SetColor(env.color)
+		w.iow = buf
+		w.LogWrite(&LogRecord{Level: ERROR, Message: "two\nlines"})
+		w.Close()
+		if got := buf.String(); got != "EROR two\nlines\n" {
+			t.Errorf("SetColor(%v) with NO_COLOR=%q: got %q", env.color, env.noColor, got)
+		}
+	}
+}
+
+func TestConsoleStderr(t *testing.T) {
+	out, errs := new(bytes.Buffer), new(bytes.Buffer)
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = errs
+
+	clw, ok := propToConsoleLogWriter(&configLoad{name: "test.xml"}, []Property{{"format", "%L %M"}, {"color", "false"}, {"stderr", "warn"}}, true)
+	if !ok {
+		t.Fatalf("propToConsoleLogWriter: stderr property refused")
+	}
+	clw.iow = out
+	for _, lvl := range []Level{DEBUG, INFO, WARNING, CRITICAL} {
+		clw.LogWrite(&LogRecord{Level: lvl, Message: "m"})
+	}
+	clw.Close()
+	if out.String() != "DEBG m\nINFO m\n" || errs.String() != "WARN m\nCRIT m\n" {
+		t.Errorf("SetStderrLevel: stdout %q, stderr %q", out, errs)
+	}
+	if _, ok := propToConsoleLogWriter(&configLoad{name: "test.xml"}, []Property{{"stderr", "loud"}}, false); ok {
+		t.Errorf("propToConsoleLogWriter: no error for an unknown level")
+	}
+}
+
+func TestJSONConsole(t *testing.T) {
+	buf := new(bytes.Buffer)
+	clw, ok := propToConsoleLogWriter(&configLoad{name: "test.xml"}, []Property{{"format", "json"}, {"color", "true"}}, true)
+	if !ok {
+		t.Fatalf("propToConsoleLogWriter: json format refused")
+	}
+	clw.iow = buf
+	clw.LogWrite(&LogRecord{Level: ERROR, Message: "a", Fields: Fields{"n": 1}})
+	clw.LogWrite(&LogRecord{Level: INFO, Message: "b", Fields: Fields{"f": func() {}}})
+	clw.Close()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("json console: got %q", buf)
+	}
+	for i, line := range lines {
+		var rec LogRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec.Message != []string{"a", "b"}[i] {
+			t.Errorf("json console: line %d is %q: %v", i, line, err)
+		}
+	}
+}
+
+func TestHostMetadata(t *testing.T) {
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"NODE_NAME":               "node-1",
+	}
+	files := map[string]string{
+		"/var/run/secrets/kubernetes.io/serviceaccount/namespace": "shop\n",
+		"/proc/self/cgroup": "0::/kubepods/burstable/pod1/cri-containerd-" + strings.Repeat("ab", 32) + ".scope\n",
+	}
+	readFile := func(name string) ([]byte, error) {
+		if s, ok := files[name]; ok {
+			return []byte(s), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	fields := hostMetadata("web-7f9c", func(k string) string { return env[k] }, readFile)
+	want := Fields{"host": "web-7f9c", "pod": "web-7f9c", "namespace": "shop", "node": "node-1", "container": strings.Repeat("ab", 32)}
+	if fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Errorf("hostMetadata: got %v, want %v", fields, want)
+	}
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).Use(EnrichMiddleware(Fields{"host": "a", "pod": "b"}))
+	l.LogFields(INFO, Fields{"pod": "mine"}, "enriched")
+	l.Close()
+	if mem.Len() != 1 || FormatLogRecord("%H %F", mem.recs[0]) != "a host=a pod=mine\n" {
+		t.Errorf("EnrichMiddleware: got %v", mem.recs)
+	}
+}
+
+func TestGlobalFields(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+	global := map[string]interface{}{"service": "shop", "env": "prod"}
+	l.SetGlobalFields(global)
+	global["env"] = "changed"
+
+	l.Info("plain")
+	l.With(Fields{"env": "child"}).LogFields(INFO, Fields{"id": 1}, "child")
+	l.SetGlobalFields(nil).Info("cleared")
+	l.Close()
+
+	want := []string{"env=prod service=shop plain\n", "env=child id=1 service=shop child\n", " cleared\n"}
+	if mem.Len() != len(want) {
+		t.Fatalf("SetGlobalFields: expected %d records, got %d", len(want), mem.Len())
+	}
+	for i, rec := range mem.recs {
+		if got := FormatLogRecord("%F %M", rec); got != want[i] {
+			t.Errorf("SetGlobalFields: record %d is %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestBuildMetadata(t *testing.T) {
+	info := &debug.BuildInfo{
+		Main: debug.Module{Path: "example.com/shop", Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "abc123"},
+			{Key: "vcs.time", Value: "2024-01-02T03:04:05Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	fields := buildMetadata(info)
+	want := Fields{"module": "example.com/shop", "version": "v1.2.3", "revision": "abc123", "build_time": "2024-01-02T03:04:05Z", "modified": true}
+	if fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Errorf("buildMetadata: got %v, want %v", fields, want)
+	}
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+	l.LogBuildInfo()
+	l.Close()
+	if mem.Len() != 1 || mem.recs[0].Message != "logger started" {
+		t.Errorf("LogBuildInfo: got %d records", mem.Len())
+	}
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+	l.Info("one")
+	l.Named("child").Info("two")
+	l.Dispatch(&LogRecord{Level: INFO, Message: "remote", Seq: 77})
+	l.Info("three")
+	l.Close()
+
+	want := []string{"1 one\n", "2 two\n", "77 remote\n", "3 three\n"}
+	if mem.Len() != len(want) {
+		t.Fatalf("Seq: expected %d records, got %d", len(want), mem.Len())
+	}
+	for i, rec := range mem.recs {
+		if got := FormatLogRecord("%q %M", rec); got != want[i] {
+			t.Errorf("Seq: record %d is %q, want %q", i, got, want[i])
+		}
+	}
+
+	buf := ProtobufEncoder{}.Encode(nil, mem.recs[1])
+	rec, err := ReadProtobufRecord(bufio.NewReader(bytes.NewReader(buf)))
+	if err != nil || rec.Seq != 2 {
+		t.Errorf("ProtobufEncoder: Seq not kept: %v, %v", rec, err)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 814856400, time.Local))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+	l.Info("first")
+	clock.Advance(time.Minute)
+	l.Info("second")
+	l.Close()
+	if mem.Len() != 2 || !mem.recs[0].Created.Equal(clock.Now().Add(-time.Minute)) || !mem.recs[1].Created.Equal(clock.Now()) {
+		t.Errorf("FakeClock: records not stamped with its time")
+	}
+
+	w := NewFileLogWriter("example")
+	if name := w.MakeFileName(); name != "example-20240314160355-814856400.log" {
+		t.Errorf("MakeFileName: got %q", name)
+	}
+}
+
+func TestTimeTrack(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	func() {
+		defer TimeTrack(l, INFO, "load users")()
+		clock.Advance(1500 * time.Millisecond)
+	}()
+	l.LogDuration(DEBUG, "100% done", time.Millisecond)
+	if mem.Len() != 2 {
+		t.Fatalf("TimeTrack: wrote %d records, want 2", mem.Len())
+	}
+	if rec := mem.recs[0]; rec.Message != "load users took 1.5s" || rec.Fields[DURATION_FIELD] != 1500*time.Millisecond ||
+		rec.Level != INFO || !strings.Contains(rec.Source, "TestTimeTrack") {
+		t.Errorf("TimeTrack: got %+v", rec)
+	}
+	if rec := mem.recs[1]; rec.Message != "100% done took 1ms" || rec.Level != DEBUG {
+		t.Errorf("LogDuration: got %+v", rec)
+	}
+}
+
+func TestReportRuntimeStats(t *testing.T) {
+	mem, other := new(memLogWriter), new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetFilter("other", NewFilter(DEBUG, other)).SetSync(true)
+
+	var prev, ms runtime.MemStats
+	runtime.ReadMemStats(&prev)
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	l.reportRuntimeStats(INFO, "mem", &ms, &prev)
+	if mem.Len() != 1 || other.Len() != 0 {
+		t.Fatalf("ReportRuntimeStats: wrote %d and %d records, want 1 and 0", mem.Len(), other.Len())
+	}
+	rec := mem.recs[0]
+	if rec.Fields["num_gc"].(uint32) < 1 || rec.Fields["goroutines"].(int) < 1 || rec.Fields["heap_alloc"].(uint64) == 0 ||
+		!strings.HasPrefix(rec.Message, "runtime: ") {
+		t.Errorf("ReportRuntimeStats: got %s %v", rec.Message, rec.Fields)
+	}
+
+	stop := l.ReportRuntimeStats(time.Millisecond, DEBUG, "")
+	for deadline := time.Now().Add(5 * time.Second); other.Len() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	if other.Len() == 0 {
+		t.Errorf("ReportRuntimeStats: nothing reported")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	mem, other := new(memLogWriter), new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetFilter("other", NewFilter(DEBUG, other)).SetSync(true)
+	l.Info("one")
+	l.heartbeat("mem")
+	if mem.Len() != 2 || other.Len() != 1 {
+		t.Fatalf("Heartbeat: wrote %d and %d records, want 2 and 1", mem.Len(), other.Len())
+	}
+	rec := mem.recs[1]
+	if rec.Message != "still alive" || rec.Level != INFO || rec.Fields["written"] != uint64(2) {
+		t.Errorf("Heartbeat: got %s %v", rec.Message, rec.Fields)
+	}
+
+	stop := l.Heartbeat(time.Millisecond, "")
+	for deadline := time.Now().Add(5 * time.Second); other.Len() == 1 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	if other.Len() == 1 {
+		t.Errorf("Heartbeat: nothing written")
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	defer l.Watchdog(INFO, time.Minute, nil)()
+	w := l.load().hooks[0].(*watchdog)
+
+	clock.Advance(50 * time.Second)
+	l.Debug("below the level")
+	clock.Advance(20 * time.Second)
+	w.check()
+	w.check()
+	if mem.Len() != 2 || mem.recs[1].Level != WARNING || mem.recs[1].Message != "no INFO records for 1m10s" {
+		t.Fatalf("Watchdog: got %d records", mem.Len())
+	}
+
+	// Its own warning does not end the silence, records do
+	l.Info("back")
+	clock.Advance(30 * time.Second)
+	w.check()
+	var silence time.Duration
+	w.alert = func(d time.Duration) { silence = d }
+	clock.Advance(30 * time.Second)
+	w.check()
+	if mem.Len() != 3 || silence != time.Minute {
+		t.Errorf("Watchdog: %d records and alert after %s, want 3 and 1m0s", mem.Len(), silence)
+	}
+}
+
+func TestFileRotateHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	rotated := map[string]bool{}
+	w := NewFileLogWriter("rotate").SetFormat("[%L] %M").OnRotate(func(oldPath string) {
+		if _, err := os.Stat(oldPath); err != nil {
+			t.Errorf("OnRotate: %s", err)
+		}
+		mu.Lock()
+		rotated[filepath.Base(oldPath)] = true
+		mu.Unlock()
+	})
+	w.SetPath(dir)
+	w.SetBufSize(16)
+	w.LogWrite(newLogRecord(INFO, "source", "a record filling the buffer"))
+	w.LogWrite(newLogRecord(INFO, "source", "short"))
+	w.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 || len(rotated) != 2 {
+		t.Fatalf("OnRotate: %d files, %d rotated", len(files), len(rotated))
+	}
+	for _, f := range files {
+		if !rotated[f.Name()] {
+			t.Errorf("OnRotate: not called for %s", f.Name())
+		}
+	}
+}
+
+func TestFileRotateInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	w := NewFileLogWriter("interval").SetFormat("[%L] %M").SetRotateInterval(time.Hour)
+	w.SetPath(dir)
+	w.LogWrite(newLogRecord(INFO, "source", "first"))
+	clock.Advance(59 * time.Minute)
+	w.LogWrite(newLogRecord(INFO, "source", "second"))
+	clock.Advance(time.Minute)
+	w.LogWrite(newLogRecord(INFO, "source", "third"))
+	w.Close()
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("SetRotateInterval: expected 2 files, found %d", len(files))
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]int64{
+		"512": 512, "10B": 10, "4K": 4096, "64KB": 64000, "1.5 MiB": 1572864, "2mb": 2000000, "1G": 1 << 30, "1GiB": 1 << 30,
+	}
+	for s, want := range sizes {
+		if got, err := ParseSize(s); err != nil || got != want {
+			t.Errorf("ParseSize(%q): got %d, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "MB", "10XB", "-1K", "ten"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q): no error", s)
+		}
+	}
+
+	durations := map[string]time.Duration{"30s": 30 * time.Second, "15m": 15 * time.Minute, "1h30m": 90 * time.Minute, "7d": 7 * 24 * time.Hour}
+	for s, want := range durations {
+		if got, err := ParseDuration(s); err != nil || got != want {
+			t.Errorf("ParseDuration(%q): got %s, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "30", "-5m", "xd"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q): no error", s)
+		}
+	}
+
+	if n, err := strToNumSuffix("4K", 1000); err != nil || n != 4000 {
+		t.Errorf("strToNumSuffix: got %d, %v", n, err)
+	}
+	if _, err := strToNumSuffix("4X", 1000); err == nil {
+		t.Errorf("strToNumSuffix: no error for 4X")
+	}
+
+	err := CheckConfigBuf("test.xml", []byte(`<logging><filter enabled="true"><tag>f</tag><type>file</type><level>INFO</level>
+		<property name="filename">app</property><property name="bufsize">10XB</property>
+		<property name="rotateinterval">daily</property><property name="auditevery">lots</property></filter></logging>`))
+	if cerr, ok := err.(*ConfigError); !ok || len(cerr.Errors) != 3 || !strings.Contains(cerr.Errors[0], `unknown unit "XB"`) {
+		t.Errorf("CheckConfigBuf: got %#v", err)
+	}
+}
+
+func TestFileHeadFoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	SetClock(NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.UTC)))
+	defer SetClock(nil)
+
+	w := NewFileLogWriter("headfoot").SetFormat("[%L] %M").SetHeadFoot("File opened at %D %T", "File closed at %D %T")
+	w.SetPath(dir)
+	w.LogWrite(newLogRecord(INFO, "source", "message"))
+	w.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("SetHeadFoot: expected 1 file, found %d", len(files))
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	want := "File opened at 2024/03/14 16:02:55\n[INFO] message\nFile closed at 2024/03/14 16:02:55\n"
+	if string(contents) != want {
+		t.Errorf("SetHeadFoot: got %q, want %q", contents, want)
+	}
+}
+
+func TestFileNameTemplate(t *testing.T) {
+	SetClock(NewFakeClock(time.Date(2024, 3, 14, 16, 2, 55, 0, time.UTC)))
+	defer SetClock(nil)
+
+	w := NewFileLogWriter("app")
+	if err := w.SetFileNameTemplate("{{.Name}}-{{.Date}}-{{.Time}}-{{.Seq}}.log"); err != nil {
+		t.Fatalf("SetFileNameTemplate: %s", err)
+	}
+	for _, want := range []string{"app-20240314-160255-1.log", "app-20240314-160255-2.log"} {
+		if name := w.MakeFileName(); name != want {
+			t.Errorf("MakeFileName: got %q, want %q", name, want)
+		}
+	}
+
+	host, _ := os.Hostname()
+	w.SetFileNameTemplate(`{{.Host}}-{{.PID}}-{{.Now.Format "2006-01"}}.log`)
+	if name, want := w.MakeFileName(), fmt.Sprintf("%s-%d-2024-03.log", host, os.Getpid()); name != want {
+		t.Errorf("MakeFileName: got %q, want %q", name, want)
+	}
+	if err := w.SetFileNameTemplate("{{.Name"); err == nil {
+		t.Errorf("SetFileNameTemplate: no error for a bad template")
+	}
+}
+
+func TestFileArchiveDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var archived []string
+	w := NewFileLogWriter("archive").SetFormat("[%L] %M").OnRotate(func(oldPath string) {
+		archived = append(archived, oldPath)
+	})
+	w.SetPath(filepath.Join(dir, "hot"))
+	w.SetArchiveDir(filepath.Join(dir, "archive"))
+	w.LogWrite(newLogRecord(INFO, "source", "message"))
+	w.Close()
+
+	if hot, _ := ioutil.ReadDir(filepath.Join(dir, "hot")); len(hot) != 0 {
+		t.Errorf("SetArchiveDir: %d files left in the path", len(hot))
+	}
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "archive"))
+	if len(files) != 1 || len(archived) != 1 || archived[0] != filepath.Join(dir, "archive", files[0].Name()) {
+		t.Fatalf("SetArchiveDir: archived %v", archived)
+	}
+	if contents, _ := ioutil.ReadFile(archived[0]); string(contents) != "[INFO] message\n" {
+		t.Errorf("SetArchiveDir: got %q", contents)
+	}
+
+	// A file that cannot be moved or copied stays where it is
+	src := filepath.Join(dir, "copy.log")
+	ioutil.WriteFile(src, []byte("data"), 0660)
+	os.Mkdir(filepath.Join(dir, "dst"), 0777)
+	os.Mkdir(filepath.Join(dir, "dst", "copy.log"), 0777) // makes Rename fail
+	if _, err := archiveFile(src, filepath.Join(dir, "dst")); err == nil {
+		t.Errorf("archiveFile: no error for an existing target")
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("archiveFile: source removed after a failure")
+	}
+}
+
+func TestSharedFileLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two writers stand in for two processes sharing the file
+	var wg sync.WaitGroup
+	for _, name := range []string{"one", "two"} {
+		w := NewFileLogWriter("shared.log").SetFormat("[%L] %M").SetShared(true)
+		w.SetPath(dir)
+		w.SetBufSize(64)
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.LogWrite(newLogRecord(INFO, "source", fmt.Sprintf("%s %d", name, i)))
+			}
+			w.Close()
+		}(name)
+	}
+	wg.Wait()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("SetShared: expected 1 file, found %d", len(files))
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, "shared.log"))
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if len(lines) != 200 {
+		t.Fatalf("SetShared: expected 200 lines, found %d", len(lines))
+	}
+	for _, line := range lines {
+		if !regexp.MustCompile(`^\[INFO\] (one|two) \d+$`).MatchString(line) {
+			t.Errorf("SetShared: bad line %q", line)
+		}
+	}
+}
+
+func TestIOLogWriter(t *testing.T) {
+	var out bytes.Buffer
+	bw := bufio.NewWriter(&out)
+	w := NewIOLogWriter(bw, "[%L] %M").SetLevelFormat(ERROR, "!! %M")
+	l := NewLogger().SetFilter("io", NewFilter(DEBUG, w))
+	l.Info("hello")
+	l.Error("failed")
+	l.Close()
+	if want := "[INFO] hello\n!! failed\n"; out.String() != want {
+		t.Errorf("IOLogWriter: got %q, want %q", out.String(), want)
+	}
+
+	if err := NewIOLogWriter(failWriter{}, "%M").LogWriteErr(newLogRecord(INFO, "source", "x")); err == nil {
+		t.Errorf("IOLogWriter: no error from a failing writer")
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("broken") }
+
+func TestFileLogWriterFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewFileLogWriter("flush").SetFormat("[%L] %M")
+	w.SetPath(dir)
+	read := func() string {
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 1 {
+			t.Fatalf("Flush: expected 1 file, found %d", len(files))
+		}
+		contents, _ := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+		return string(contents)
+	}
+
+	w.LogWrite(newLogRecord(INFO, "source", "one"))
+	w.Flush()
+	if got := read(); got != "[INFO] one\n" {
+		t.Errorf("Flush: got %q", got)
+	}
+
+	// The file stays open across flushes
+	w.LogWrite(newLogRecord(INFO, "source", "two"))
+	w.Flush()
+	w.LogWrite(newLogRecord(INFO, "source", "three"))
+	w.Close()
+	if got := read(); got != "[INFO] one\n[INFO] two\n[INFO] three\n" {
+		t.Errorf("Close: got %q", got)
+	}
+}
+
+func TestSyncMode(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).SetSync(true)
+	l.Info("first")
+	if mem.Len() != 1 {
+		t.Fatalf("SetSync: record not written in the logging call")
+	}
+
+	// Filters added later write inline too
+	later := new(memLogWriter)
+	l.SetFilter("later", NewFilter(DEBUG, later))
+	l.Warn("second")
+	if mem.Len() != 2 || later.Len() != 1 || !l.Filter("later").Sync() {
+		t.Errorf("SetSync: filter added later is not synchronous")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info("concurrent")
+			}
+		}()
+	}
+	wg.Wait()
+	if mem.Len() != 402 {
+		t.Errorf("SetSync: %d records written, want 402", mem.Len())
+	}
+
+	l.Close()
+	if mem.closed != 1 {
+		t.Errorf("SetSync: writer closed %d times", mem.closed)
+	}
+}
+
+func TestFilterPredicates(t *testing.T) {
+	mem := new(memLogWriter)
+	filt := NewFilter(DEBUG, mem).
+		AddPredicate(func(rec *LogRecord) bool { return strings.HasPrefix(rec.Message, "audit:") }).
+		AddPredicate(func(rec *LogRecord) bool { return rec.Fields["user"] != "system" })
+
+	filt.WriteToChan(newLogRecord(INFO, "source", "audit: login"))
+	filt.WriteToChan(newLogRecord(INFO, "source", "request served"))
+	rec := newLogRecord(INFO, "source", "audit: cron run")
+	rec.Fields = Fields{"user": "system"}
+	filt.WriteToChan(rec)
+	filt.Close()
+
+	if mem.Len() != 1 || mem.recs[0].Message != "audit: login" {
+		t.Errorf("AddPredicate: expected only \"audit: login\", got %d records", mem.Len())
+	}
+}
+
+func TestTagPatterns(t *testing.T) {
+	store, cache, app := new(memLogWriter), new(memLogWriter), new(memLogWriter)
+	l := NewLogger().
+		SetFilter("store", NewFilter(DEBUG, store).AddTagRegexp(regexp.MustCompile(`^(db|kv)\.`))).
+		SetFilter("cache.*", NewFilter(DEBUG, cache)).
+		SetFilter("app", NewFilter(DEBUG, app))
+
+	l.Tag("db.query").Info("select")
+	l.Tag("kv.get").Info("get")
+	l.Tag("cache.redis").Info("hit")
+	l.Tag("http").Info("request")
+	l.Flush()
+
+	messages := func(mem *memLogWriter) (msgs []string) {
+		for _, rec := range mem.recs {
+			msgs = append(msgs, rec.Message)
+		}
+		return msgs
+	}
+	if got := messages(store); strings.Join(got, ",") != "select,get" {
+		t.Errorf("AddTagRegexp: got %q", got)
+	}
+	// The pattern named filter also gets untagged and untaken records
+	if got := messages(cache); strings.Join(got, ",") != "hit,request" {
+		t.Errorf("Pattern filter name: got %q", got)
+	}
+	if got := messages(app); strings.Join(got, ",") != "request" {
+		t.Errorf("Pattern filter name: app got %q", got)
+	}
+
+	filt := NewFilter(DEBUG, new(memLogWriter))
+	defer filt.Close()
+	if !propToFilter(&configLoad{name: "test"}, []Property{{"tags", `/^db\./, cache*`}}, filt) || !filt.takesTag("db.tx") || !filt.takesTag("cache") || filt.takesTag("kv.get") {
+		t.Errorf("Config tags: regular expressions in slashes not taken")
+	}
+}
+
+func TestMessageTemplates(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem))
+	l.Infot("user {user} logged in from {ip}", Fields{"user": "alice", "ip": "10.0.0.1"})
+	l.Warnt("{count} retries, {missing} left, {{literal}} 100%", Fields{"count": 3})
+	l.Flush()
+
+	if mem.Len() != 2 {
+		t.Fatalf("Infot: %d records", mem.Len())
+	}
+	if rec := mem.recs[0]; rec.Message != "user alice logged in from 10.0.0.1" || rec.Fields["ip"] != "10.0.0.1" || !strings.Contains(rec.Source, "log4go_test.go") {
+		t.Errorf("Infot: got %q from %s with %v", rec.Message, rec.Source, rec.Fields)
+	}
+	if rec := mem.recs[1]; rec.Level != WARNING || rec.Message != "3 retries, {missing} left, {literal} 100%" {
+		t.Errorf("Warnt: got %q", rec.Message)
+	}
+}
+
+func TestCharset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gbk, err := parseCharset("GBK")
+	if err != nil {
+		t.Fatalf("parseCharset: %s", err)
+	}
+	w := NewFileLogWriter("gbk").SetFormat("%M").SetCharset(gbk)
+	w.SetPath(dir)
+	w.LogWrite(newLogRecord(INFO, "source", "日志"))
+	w.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("SetCharset: expected 1 file, found %d", len(files))
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if want := "\xc8\xd5\xd6\xbe\n"; string(contents) != want {
+		t.Errorf("SetCharset: got %x, want %x", contents, want)
+	}
+
+	sjis, _ := parseCharset("shift_jis")
+	if got := transcode(sjis, "ログ ☃"); got != "\x83\x8d\x83O \x1a" {
+		t.Errorf("transcode: got %x", got)
+	}
+	if _, err := parseCharset("klingon"); err == nil {
+		t.Errorf("parseCharset: no error for an unknown set")
+	}
+}
+
+func TestSanitizeMiddleware(t *testing.T) {
+	for _, test := range []struct {
+		mode     SanitizeMode
+		msg, out string
+	}{
+		{SanitizeEscape, "user bob\n[2024/01/01] [CRIT] forged", `user bob\n[2024/01/01] [CRIT] forged`},
+		{SanitizeEscape, "red \x1b[31mtext\x1b[0m\tok\r", `red \x1b[31mtext\x1b[0m` + "\tok" + `\r`},
+		{SanitizeEscape, "c1 \u009b and \u2028", `c1 \u009b and \u2028`},
+		{SanitizeStrip, "two\nlines \x1b[31mred\x07", "two lines [31mred"},
+		{SanitizeEscape, "clean", "clean"},
+	} {
+		mem := new(memLogWriter)
+		l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).Use(SanitizeMiddleware(test.mode))
+		fields := Fields{"input": test.msg, "n": 1}
+		l.LogFields(INFO, fields, test.msg)
+		l.Close()
+		if rec := mem.recs[0]; rec.Message != test.out || rec.Fields["input"] != test.out {
+			t.Errorf("Sanitize(%q): got %q and %q, want %q", test.msg, rec.Message, rec.Fields["input"], test.out)
+		}
+		if fields["input"] != test.msg {
+			t.Errorf("Sanitize: the caller's fields were changed")
+		}
+	}
+}
+
+func TestTruncateMiddleware(t *testing.T) {
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(DEBUG, mem)).Use(TruncateMiddleware(10, 4))
+	fields := Fields{"body": "0123456789", "short": "ok", "n": 12345}
+	l.LogFields(INFO, fields, "héllo wörld, and more")
+	l.Info("short")
+	l.Close()
+
+	if got := mem.recs[0].Message; got != "héllo wö…(truncated 13 bytes)" {
+		t.Errorf("Truncate: message %q", got)
+	}
+	if f := mem.recs[0].Fields; f["body"] != "0123…(truncated 6 bytes)" || f["short"] != "ok" || f["n"] != 12345 {
+		t.Errorf("Truncate: fields %v", f)
+	}
+	if fields["body"] != "0123456789" {
+		t.Errorf("Truncate: the caller's fields were changed")
+	}
+	if got := mem.recs[1].Message; got != "short" {
+		t.Errorf("Truncate: short message changed to %q", got)
+	}
+}
+
+func TestIndentContinuationLines(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewConsoleLogWriter().SetFormat("[%L] %M").SetIndent("    ")
+	w.iow = buf
+	w.LogWrite(&LogRecord{Level: ERROR, Message: "panic: boom\ngoroutine 1:\nmain.main()"})
+	w.LogWrite(&LogRecord{Level: INFO, Message: "single line"})
+	w.Close()
+	if got, want := buf.String(), "[EROR] panic: boom\n    goroutine 1:\n    main.main()\n[INFO] single line\n"; got != want {
+		t.Errorf("SetIndent: got %q, want %q", got, want)
+	}
+
+	clw, ok := propToConsoleLogWriter(&configLoad{name: "test.xml"}, []Property{{"indent", "2"}}, true)
+	if !ok || clw.indent != "  " {
+		t.Errorf("propToConsoleLogWriter: indent not set")
+	}
+	if clw != nil {
+		clw.Close()
+	}
+	if parseIndent("tab") != "\t" || parseIndent("> ") != "> " {
+		t.Errorf("parseIndent: tab or text not taken")
+	}
+}
@@ -1,9 +1,11 @@
 package log4go
 
 import (
-	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 )
@@ -12,16 +14,36 @@ const (
 	FORMAT_DEFAULT = "[%D %T %z] [%L] (%S) %M"
 	FORMAT_SHORT   = "[%t %d] [%L] %M"
 	FORMAT_ABBREV  = "[%L] %M"
+
+	// Apache access log formats, for records with the fields attached by
+	// HTTPMiddleware
+	FORMAT_COMMON   = `%{remote} - %{user} [%A] "%{method} %{uri} %{proto}" %{status} %{bytes}`
+	FORMAT_COMBINED = FORMAT_COMMON + ` "%{referer}" "%{useragent}"`
 )
 
+// Time layout of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// The date and time strings of one second, shared by all records created in
+// it, so they are only rendered once a second
 type formatCacheType struct {
-	LastUpdateSeconds               int64
-	longTime, shortTime, detailTime string
-	longZone, shortZone             string
-	longDate, shortDate             string
+	LastUpdateSeconds   int64
+	location            *time.Location
+	longTime, shortTime string
+	longZone, shortZone string
+	longDate, shortDate string
+	clfTime             string
 }
 
-var formatCache = &formatCacheType{}
+var formatCache atomic.Value // *formatCacheType
+
+// Buffers for FormatLogRecord
+var formatBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
 
 // Known format codes:
 // %T - Time (15:04:05)
@@ -29,12 +51,20 @@ var formatCache = &formatCacheType{}
 // %m - Time (15:04:05.1234567)
 // %Z - Zone (-0700)
 // %z - Zone (MST)
+// %A - Date and time (02/Jan/2006:15:04:05 -0700)
 // %D - Date (2006/01/02)
-// %d - Date (01/02/06)
-// %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
+// %d - Date (02/01/06)
+// %L - Level (DEBG, TRAC, INFO, WARN, EROR, CRIT)
 // %S - Source
 // %s - Short Source
 // %M - Message
+// %N - Name of the child logger (see Logger.Named)
+// %G - Tag (see Logger.Tag)
+// %q - Sequence number of the record within its Logger
+// %H - Host, from the host field if set (see HostMetadata)
+// %F - Fields (key=value, sorted by key)
+// %J - Data, the JSON payload of the record (see Logger.LogData)
+// %{key} - The value of one field, or - if the record does not have it
 // Ignores unknown formats
 // Recommended: "[%D %T] [%L] (%S) %M"
 func FormatLogRecord(format string, rec *LogRecord) string {
@@ -45,72 +75,225 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 		return ""
 	}
 
-	out := bytes.NewBuffer(make([]byte, 0, 64))
-	msecs := rec.Created.UnixNano() / 1e6
-
-	cache := *formatCache
-	if cache.LastUpdateSeconds != msecs {
-		month, day, year := rec.Created.Month(), rec.Created.Day(), rec.Created.Year()
-		hour, minute, second := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second()
-
-		updated := &formatCacheType{
-			LastUpdateSeconds: msecs,
-			shortTime:         fmt.Sprintf("%02d:%02d", hour, minute),
-			longTime:          fmt.Sprintf("%02d:%02d:%02d", hour, minute, second),
-			shortZone:         rec.Created.Format("MST"),
-			longZone:          rec.Created.Format("-0700"),
-			shortDate:         fmt.Sprintf("%02d/%02d/%02d", day, month, year%100),
-			longDate:          fmt.Sprintf("%04d/%02d/%02d", year, month, day),
-		}
-		tt := float64(time.Now().Nanosecond()) / float64(10e8)
-		detailTime := fmt.Sprintf("%s.%.07f", updated.shortTime, float64(second)+tt)
+	buf := formatBufPool.Get().(*[]byte)
+	*buf = AppendLogRecord((*buf)[:0], format, rec)
+	s := string(*buf)
+	formatBufPool.Put(buf)
+	return s
+}
 
-		updated.detailTime = detailTime
-		cache = *updated
-		formatCache = updated
+// AppendLogRecord is like FormatLogRecord, but appends the formatted record
+// (and its newline) to dst and returns the extended buffer.  It does not
+// allocate if dst is large enough and the record has no fields.
+func AppendLogRecord(dst []byte, format string, rec *LogRecord) []byte {
+	if rec == nil {
+		return append(dst, "<nil>"...)
+	}
+	if len(format) == 0 {
+		return dst
 	}
 
-	// Split the string into pieces by % signs
-	pieces := bytes.Split([]byte(format), []byte{'%'})
-
-	// Iterate over the pieces, replacing known formats
-	for i, piece := range pieces {
-		if i > 0 && len(piece) > 0 {
-			switch piece[0] {
-			case 'T':
-				out.WriteString(cache.longTime)
-			case 't':
-				out.WriteString(cache.shortTime)
-			case 'm':
-				out.WriteString(cache.detailTime)
-			case 'Z':
-				out.WriteString(cache.longZone)
-			case 'z':
-				out.WriteString(cache.shortZone)
-			case 'D':
-				out.WriteString(cache.longDate)
-			case 'd':
-				out.WriteString(cache.shortDate)
-			case 'L':
-				out.WriteString(levelStrings[rec.Level])
-			case 'S':
-				out.WriteString(rec.Source)
-			case 's':
-				slice := strings.Split(rec.Source, "/")
-				out.WriteString(slice[len(slice)-1])
-			case 'M':
-				msg := strings.TrimRightFunc(rec.Message, unicode.IsSpace)
-				out.WriteString(msg)
+	cache := cachedTimes(rec.Created)
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			dst = append(dst, format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'T':
+			dst = append(dst, cache.longTime...)
+		case 't':
+			dst = append(dst, cache.shortTime...)
+		case 'm':
+			dst = append(dst, cache.longTime...)
+			dst = append(dst, '.')
+			dst = appendInt(dst, rec.Created.Nanosecond()/100, 7)
+		case 'Z':
+			dst = append(dst, cache.longZone...)
+		case 'z':
+			dst = append(dst, cache.shortZone...)
+		case 'A':
+			dst = append(dst, cache.clfTime...)
+		case 'D':
+			dst = append(dst, cache.longDate...)
+		case 'd':
+			dst = append(dst, cache.shortDate...)
+		case 'L':
+			dst = append(dst, rec.Level.String()...)
+		case 'S':
+			dst = append(dst, rec.Source...)
+		case 's':
+			dst = append(dst, rec.Source[strings.LastIndexByte(rec.Source, '/')+1:]...)
+		case 'M':
+			dst = append(dst, strings.TrimRightFunc(rec.Message, unicode.IsSpace)...)
+		case 'N':
+			dst = append(dst, rec.Name...)
+		case 'G':
+			dst = append(dst, rec.Tag...)
+		case 'q':
+			dst = strconv.AppendUint(dst, rec.Seq, 10)
+		case 'H':
+			if host, ok := rec.Fields[HOST_FIELD]; ok {
+				dst = appendValue(dst, host)
+			} else {
+				host, _ := HostMetadata()[HOST_FIELD].(string)
+				dst = append(dst, host...)
 			}
-			if len(piece) > 1 {
-				out.Write(piece[1:])
+		case 'F':
+			dst = appendFields(dst, rec.Fields)
+		case 'J':
+			dst = append(dst, rec.Data...)
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				dst = append(dst, format[i-1:]...)
+				i = len(format)
+				break
 			}
-		} else if len(piece) > 0 {
-			out.Write(piece)
+			if v, ok := rec.Fields[format[i+1:i+end]]; ok {
+				dst = appendValue(dst, v)
+			} else {
+				dst = append(dst, '-')
+			}
+			i += end
+		case '%':
+			dst = append(dst, '%')
 		}
 	}
 
-	out.WriteByte('\n')
+	return append(dst, '\n')
+}
+
+// Formats overriding a writer's format for some levels, e.g. a terse one
+// for DEBUG
+type levelFormats map[Level]string
+
+// The format for records at lvl, or def if none is set for it
+func (f levelFormats) get(def string, lvl Level) string {
+	if format, ok := f[lvl]; ok {
+		return format
+	}
+	return def
+}
+
+// Indent the lines of a formatted record after the first, so they read as
+// part of it
+func indentLines(s, indent string) string {
+	body := strings.TrimSuffix(s, "\n")
+	if len(indent) == 0 || !strings.Contains(body, "\n") {
+		return s
+	}
+	return strings.Replace(body, "\n", "\n"+indent, -1) + s[len(body):]
+}
 
-	return out.String()
+// Parse an indent given as a number of spaces or the text itself, e.g. "tab"
+// for a tab
+func parseIndent(str string) string {
+	if n, err := strconv.Atoi(str); err == nil && n >= 0 {
+		return strings.Repeat(" ", n)
+	}
+	if str == "tab" {
+		return "\t"
+	}
+	return str
+}
+
+// The cached strings for the second of t, rendering them if needed
+func cachedTimes(t time.Time) *formatCacheType {
+	secs := t.Unix()
+	if cache, ok := formatCache.Load().(*formatCacheType); ok &&
+		cache.LastUpdateSeconds == secs && cache.location == t.Location() {
+		return cache
+	}
+
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+
+	var b []byte
+	b = appendInt(b, hour, 2)
+	b = append(b, ':')
+	b = appendInt(b, minute, 2)
+	shortTime := string(b)
+	b = append(b, ':')
+	b = appendInt(b, second, 2)
+	longTime := string(b)
+
+	b = appendInt(b[:0], day, 2)
+	b = append(b, '/')
+	b = appendInt(b, int(month), 2)
+	b = append(b, '/')
+	b = appendInt(b, year%100, 2)
+	shortDate := string(b)
+
+	b = appendInt(b[:0], year, 4)
+	b = append(b, '/')
+	b = appendInt(b, int(month), 2)
+	b = append(b, '/')
+	b = appendInt(b, day, 2)
+	longDate := string(b)
+
+	cache := &formatCacheType{
+		LastUpdateSeconds: secs,
+		location:          t.Location(),
+		shortTime:         shortTime,
+		longTime:          longTime,
+		shortZone:         t.Format("MST"),
+		longZone:          t.Format("-0700"),
+		shortDate:         shortDate,
+		longDate:          longDate,
+		clfTime:           t.Format(clfTime),
+	}
+	formatCache.Store(cache)
+	return cache
+}
+
+// Append n in decimal, zero padded to width digits
+func appendInt(dst []byte, n int, width int) []byte {
+	var digits [20]byte
+	i := len(digits)
+	for n >= 10 || width > 1 {
+		i--
+		width--
+		digits[i] = byte('0' + n%10)
+		n /= 10
+	}
+	i--
+	digits[i] = byte('0' + n)
+	return append(dst, digits[i:]...)
+}
+
+// Append fields as space separated key=value pairs sorted by key
+func appendFields(dst []byte, fields Fields) []byte {
+	for i, k := range sortedFieldKeys(fields) {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = append(dst, k...)
+		dst = append(dst, '=')
+		dst = appendValue(dst, fields[k])
+	}
+	return dst
+}
+
+// Append a field value, avoiding fmt for the common types
+func appendValue(dst []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(dst, v...)
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(dst, v, 10)
+	case uint64:
+		return strconv.AppendUint(dst, v, 10)
+	case float64:
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(dst, v)
+	case error:
+		return append(dst, v.Error()...)
+	}
+	return append(dst, fmt.Sprint(v)...)
 }
@@ -1,10 +1,11 @@
 package log4go
 
 import (
+	"context"
 	"fmt"
 )
 
-var log = make(Logger)
+var log = NewLogger()
 
 func StartLogServer(cfgfile ...string) {
 	if len(cfgfile) == 0 {
@@ -14,60 +15,94 @@ func StartLogServer(cfgfile ...string) {
 	}
 }
 
+// Close the default logger and those GetLogger created.
 func StopLogServer() {
 	log.Close()
+	closeNamedLoggers()
+}
+
+// Keep the default logger configured from src; see Logger.WatchConfig.
+func WatchLogConfig(ctx context.Context, src ConfigSource, filename string) error {
+	return log.WatchConfig(ctx, src, filename)
 }
 
 func LogDebugf(format string, params ...interface{}) {
-	log.Debug(format, params...)
+	log.intLogf(2, DEBUG, format, params...)
 }
 
 func LogTracef(format string, params ...interface{}) {
-	log.Trace(format, params...)
+	log.intLogf(2, TRACE, format, params...)
 }
 
 func LogInfof(format string, params ...interface{}) {
-	log.Info(format, params...)
+	log.intLogf(2, INFO, format, params...)
 }
 
 func LogWarnf(format string, params ...interface{}) error {
-	return log.Warn(format, params...)
+	return log.intLogErr(2, WARNING, format, params)
 }
 
 func LogErrorf(format string, params ...interface{}) error {
-	return log.Error(format, params...)
+	return log.intLogErr(2, ERROR, format, params)
 }
 
 func LogCriticalf(format string, params ...interface{}) error {
-	return log.Critical(format, params...)
+	return log.intLogErr(2, CRITICAL, format, params)
 }
 
 ///////////////////////////////////////////////////
 func LogDebug(v ...interface{}) {
-	log.Debug("%s", fmt.Sprint(v...))
+	log.intLogf(2, DEBUG, "%s", fmt.Sprint(v...))
 }
 
 func LogTrace(v ...interface{}) {
-	log.Trace("%s", fmt.Sprint(v...))
+	log.intLogf(2, TRACE, "%s", fmt.Sprint(v...))
 }
 
 func LogInfo(v ...interface{}) {
-	log.Info("%s", fmt.Sprint(v...))
+	log.intLogf(2, INFO, "%s", fmt.Sprint(v...))
 }
 
 func LogWarn(v ...interface{}) error {
-	return log.Warn("%s", fmt.Sprint(v...))
+	return log.intLogErr(2, WARNING, "%s", []interface{}{fmt.Sprint(v...)})
 }
 
 func LogError(v ...interface{}) error {
-	return log.Error("%s", fmt.Sprint(v...))
+	return log.intLogErr(2, ERROR, "%s", []interface{}{fmt.Sprint(v...)})
+}
+
+// Log err at ERROR with its details as fields; see Logger.ErrorErr.
+func LogErrorErr(err error, msg string, fields ...Fields) error {
+	return log.logErr(3, err, msg, fields)
 }
 
 func LogCritical(v ...interface{}) error {
-	return log.Critical("%s", fmt.Sprint(v...))
+	return log.intLogErr(2, CRITICAL, "%s", []interface{}{fmt.Sprint(v...)})
+}
+
+// Reports whether the default logger would write records at lvl; see
+// Logger.IsEnabledFor.
+func IsEnabledFor(lvl Level) bool {
+	return log.IsEnabledFor(lvl)
+}
+
+// Make every record of the default logger carry fields; see
+// Logger.SetGlobalFields.
+func SetGlobalFields(fields map[string]interface{}) {
+	log.SetGlobalFields(fields)
+}
+
+// Make the default logger write records in the logging call; see
+// Logger.SetSync.
+func SetSync(sync bool) {
+	log.SetSync(sync)
 }
 
 func LogFlush() {
 	log.Flush()
 }
 
+// V is Logger.V for the default logger.
+func V(level int) Verbose {
+	return log.verbose(level)
+}
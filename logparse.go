@@ -0,0 +1,217 @@
+package log4go
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned by LineParser.Parse for lines not written with its format
+var ErrLineFormat = errors.New("line does not match the format")
+
+// A LineParser reads records back from the lines FormatLogRecord wrote with
+// a format string.  The record has what the format wrote: Created is only
+// as precise as its date and time codes, field values are strings, and
+// nothing is known of what the format leaves out.
+type LineParser struct {
+	re    *regexp.Regexp
+	codes []string // the format code of each group, e.g. "D" or "{user}"
+}
+
+// This creates a LineParser for lines written with format.
+func NewLineParser(format string) (*LineParser, error) {
+	p := new(LineParser)
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			expr.WriteString(regexp.QuoteMeta(format[i : i+1]))
+			continue
+		}
+		i++
+		code := format[i : i+1]
+		var group string
+		switch format[i] {
+		case 'T':
+			group = `\d\d:\d\d:\d\d`
+		case 't':
+			group = `\d\d:\d\d`
+		case 'm':
+			group = `\d\d:\d\d:\d\d\.\d{7}`
+		case 'Z':
+			group = `[+-]\d{4}`
+		case 'z':
+			group = `[A-Za-z0-9+-]+`
+		case 'A':
+			group = `\d\d/[A-Za-z]{3}/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}`
+		case 'D':
+			group = `\d{4}/\d\d/\d\d`
+		case 'd':
+			group = `\d\d/\d\d/\d\d`
+		case 'L':
+			group = strings.Join(levelStrings[:], "|")
+		case 'N', 'G', 'H':
+			group = `\S*`
+		case 'q':
+			group = `\d+`
+		case 'S', 's', 'M', 'F', 'J':
+			group = `.*?`
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(format[i-1:]))
+				i = len(format)
+				continue
+			}
+			code = format[i : i+end+1]
+			group = `.*?`
+			i += end
+		case '%':
+			expr.WriteString("%")
+			continue
+		default:
+			// FormatLogRecord writes nothing for unknown codes
+			continue
+		}
+		expr.WriteString("(" + group + ")")
+		p.codes = append(p.codes, code)
+	}
+	expr.WriteString(`\n?$`)
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// Parse reads the record written as line, returning ErrLineFormat if the
+// format did not write it.
+func (p *LineParser) Parse(line string) (*LogRecord, error) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, ErrLineFormat
+	}
+
+	rec := new(LogRecord)
+	var date, clock, clf, offset, zone string
+	setField := func(k string, v interface{}) {
+		if rec.Fields == nil {
+			rec.Fields = make(Fields)
+		}
+		rec.Fields[k] = v
+	}
+	for i, code := range p.codes {
+		v := m[i+1]
+		switch code {
+		case "T", "t", "m":
+			clock = v
+		case "D":
+			date = v
+		case "d":
+			date = "20" + v[6:8] + "/" + v[3:5] + "/" + v[0:2]
+		case "A":
+			clf = v
+		case "Z":
+			offset = v
+		case "z":
+			zone = v
+		case "L":
+			for lvl, s := range levelStrings {
+				if s == v {
+					rec.Level = Level(lvl)
+				}
+			}
+		case "S":
+			rec.Source = v
+		case "s":
+			if len(rec.Source) == 0 {
+				rec.Source = v
+			}
+		case "M":
+			rec.Message = v
+		case "N":
+			rec.Name = v
+		case "G":
+			rec.Tag = v
+		case "q":
+			rec.Seq, _ = strconv.ParseUint(v, 10, 64)
+		case "H":
+			if len(v) > 0 {
+				setField(HOST_FIELD, v)
+			}
+		case "F":
+			for k, v := range parseFieldList(v) {
+				setField(k, v)
+			}
+		case "J":
+			if len(v) > 0 {
+				rec.Data = json.RawMessage(v)
+			}
+		default:
+			if v != "-" {
+				setField(code[1:len(code)-1], v)
+			}
+		}
+	}
+	rec.Created = parseCreated(date, clock, clf, offset, zone)
+	return rec, nil
+}
+
+// Parse the key=value pairs written by %F; values may hold spaces, but not
+// " key="
+func parseFieldList(s string) map[string]string {
+	fields := make(map[string]string)
+	starts := fieldStartRE.FindAllStringSubmatchIndex(s, -1)
+	for i, loc := range starts {
+		end := len(s)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		fields[s[loc[2]:loc[3]]] = s[loc[1]:end]
+	}
+	return fields
+}
+
+var fieldStartRE = regexp.MustCompile(`(?:^| )([^ =]+)=`)
+
+// Put together the time of a record from what the format wrote of it
+func parseCreated(date, clock, clf, offset, zone string) time.Time {
+	if len(clf) > 0 && len(clock) == 0 {
+		t, _ := time.Parse(clfTime, clf)
+		return t
+	}
+	if len(date) == 0 && len(clf) > 0 {
+		if t, err := time.Parse(clfTime, clf); err == nil {
+			date, offset = t.Format("2006/01/02"), t.Format("-0700")
+		}
+	}
+	if len(date) == 0 && len(clock) == 0 {
+		return time.Time{}
+	}
+	if len(date) == 0 {
+		date = "0000/01/01"
+	}
+	if len(clock) == 0 {
+		clock = "00:00:00"
+	} else if len(clock) == 5 {
+		clock += ":00"
+	}
+
+	layout, value := "2006/01/02 15:04:05.9999999", date+" "+clock
+	if len(offset) > 0 {
+		layout, value = layout+" -0700", value+" "+offset
+		t, _ := time.Parse(layout, value)
+		return t
+	}
+	t, _ := time.ParseInLocation(layout, value, time.Local)
+	if len(zone) > 0 && t.Format("MST") != zone {
+		// Not the local zone; the abbreviation alone cannot tell which
+		t, _ = time.ParseInLocation(layout, value, time.UTC)
+	}
+	return t
+}
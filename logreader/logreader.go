@@ -0,0 +1,191 @@
+// Package logreader reads the files a FileLogWriter writes back into
+// records, for post-processing, replay or checking in tests what a program
+// logged:
+//
+//	r, err := logreader.Open("app.log", log4go.FORMAT_DEFAULT)
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Close()
+//	for r.Next() {
+//		rec := r.Record()
+//		...
+//	}
+//	return r.Err()
+//
+// Files compressed with gzip, as rotated files often are, are read as well.
+package logreader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goldenspider/log4go"
+)
+
+// The format of files holding JSON records, one per line, as the json
+// encoding writes them
+const JSON = "json"
+
+// Longest line read
+const MAX_LINE = 16 * 1024 * 1024
+
+// A Reader iterates over the records of a file.  With a format string, the
+// lines the format did not write continue the message of the record before
+// them, as multi-line messages are written.
+type Reader struct {
+	sc      *bufio.Scanner
+	parse   func(string) (*log4go.LogRecord, error)
+	json    bool
+	indent  string
+	closers []io.Closer
+
+	line    int
+	rec     *log4go.LogRecord
+	pending *log4go.LogRecord
+	err     error
+}
+
+// This creates a Reader of the records in r written with format, a format
+// string or JSON.
+func New(r io.Reader, format string) (*Reader, error) {
+	rd := new(Reader)
+	if format == JSON {
+		rd.json = true
+		rd.parse = parseJSON
+	} else {
+		p, err := log4go.NewLineParser(format)
+		if err != nil {
+			return nil, err
+		}
+		rd.parse = p.Parse
+	}
+
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		rd.closers = append(rd.closers, zr)
+		r = zr
+	} else {
+		r = br
+	}
+	rd.sc = bufio.NewScanner(r)
+	rd.sc.Buffer(nil, MAX_LINE)
+	return rd, nil
+}
+
+// Open opens the file called name for reading its records written with
+// format.
+func Open(name, format string) (*Reader, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(fd, format)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	r.closers = append(r.closers, fd)
+	return r, nil
+}
+
+// ReadAll returns all the records in r written with format.
+func ReadAll(r io.Reader, format string) ([]*log4go.LogRecord, error) {
+	rd, err := New(r, format)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	var recs []*log4go.LogRecord
+	for rd.Next() {
+		recs = append(recs, rd.Record())
+	}
+	return recs, rd.Err()
+}
+
+// Strip indent from the lines continuing a message, as the writer's
+// SetIndent added it (chainable).  Must be called before the first record
+// is read.
+func (r *Reader) SetIndent(indent string) *Reader {
+	r.indent = indent
+	return r
+}
+
+// Next reads the next record, returning false at the end of the input or
+// on an error, which Err then returns.
+func (r *Reader) Next() bool {
+	r.rec = nil
+	if r.err != nil {
+		return false
+	}
+	for r.sc.Scan() {
+		r.line++
+		line := strings.TrimSuffix(r.sc.Text(), "\r")
+		rec, err := r.parse(line)
+		switch {
+		case err == nil && r.json:
+			// Nothing continues a JSON record
+			r.rec = rec
+			return true
+		case err == nil:
+			r.rec, r.pending = r.pending, rec
+			if r.rec != nil {
+				return true
+			}
+		case r.json && len(strings.TrimSpace(line)) == 0:
+		case r.json || r.pending == nil:
+			r.err = fmt.Errorf("line %d: %w", r.line, err)
+			r.pending = nil
+			return false
+		default:
+			r.pending.Message += "\n" + strings.TrimPrefix(line, r.indent)
+		}
+	}
+	if err := r.sc.Err(); err != nil {
+		r.err = fmt.Errorf("line %d: %w", r.line+1, err)
+		r.pending = nil
+		return false
+	}
+	r.rec, r.pending = r.pending, nil
+	return r.rec != nil
+}
+
+// Record returns the record Next read.
+func (r *Reader) Record() *log4go.LogRecord {
+	return r.rec
+}
+
+// Err returns the error that stopped Next, if any.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Close closes the file Open opened.
+func (r *Reader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+func parseJSON(line string) (*log4go.LogRecord, error) {
+	rec := new(log4go.LogRecord)
+	if err := json.Unmarshal([]byte(line), rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
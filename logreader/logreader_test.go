@@ -0,0 +1,206 @@
+package logreader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goldenspider/log4go"
+)
+
+const testFormat = "[%D %T] [%L] (%S) %M"
+
+var created = time.Date(2024, 3, 14, 16, 2, 55, 0, time.Local)
+
+func testRecords() []*log4go.LogRecord {
+	return []*log4go.LogRecord{
+		{Level: log4go.INFO, Created: created, Source: "main.go:12", Message: "started"},
+		{Level: log4go.ERROR, Created: created.Add(time.Second), Source: "db.go:40", Message: "query failed\ntimeout after 5s\nretrying"},
+		{Level: log4go.WARNING, Created: created.Add(2 * time.Second), Source: "db.go:52", Message: "slow"},
+	}
+}
+
+// The records as a writer with format and indent writes them
+func formatted(format, indent string) string {
+	var b strings.Builder
+	for _, rec := range testRecords() {
+		line := log4go.FormatLogRecord(format, rec)
+		b.WriteString(strings.Replace(strings.TrimSuffix(line, "\n"), "\n", "\n"+indent, -1) + "\n")
+	}
+	return b.String()
+}
+
+func checkRecords(t *testing.T, what string, recs []*log4go.LogRecord) {
+	t.Helper()
+	want := testRecords()
+	if len(recs) != len(want) {
+		t.Fatalf("%s: expected %d records, got %d", what, len(want), len(recs))
+	}
+	for i, rec := range recs {
+		if rec.Level != want[i].Level || rec.Source != want[i].Source || rec.Message != want[i].Message || !rec.Created.Equal(want[i].Created) {
+			t.Errorf("%s: record %d is %+v, expected %+v", what, i, rec, want[i])
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	recs, err := ReadAll(strings.NewReader(formatted(testFormat, "")), testFormat)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	checkRecords(t, "ReadAll", recs)
+
+	// Continuation lines indented by the writer, and \r\n line ends
+	r, err := New(strings.NewReader(strings.Replace(formatted(testFormat, "\t"), "\n", "\r\n", -1)), testFormat)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	r.SetIndent("\t")
+	recs = nil
+	for r.Next() {
+		recs = append(recs, r.Record())
+	}
+	if r.Err() != nil {
+		t.Fatalf("Next: %s", r.Err())
+	}
+	checkRecords(t, "SetIndent", recs)
+}
+
+func TestJSON(t *testing.T) {
+	var buf []byte
+	for _, rec := range testRecords() {
+		buf = log4go.JSONEncoder{}.Encode(buf, rec)
+		buf = append(buf, '\n') // blank lines are skipped
+	}
+	recs, err := ReadAll(bytes.NewReader(buf), JSON)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	checkRecords(t, "JSON", recs)
+
+	// A line that is not JSON is an error, even after a record
+	recs, err = ReadAll(strings.NewReader(`{"Level": 2, "Message": "ok"}`+"\nnot json\n"), JSON)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") || len(recs) != 1 {
+		t.Errorf("ReadAll: got %d records and %v for a bad line", len(recs), err)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(formatted(testFormat, "")))
+	zw.Close()
+
+	dir, err := ioutil.TempDir("", "logreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log.gz")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(name, testFormat)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	var recs []*log4go.LogRecord
+	for r.Next() {
+		recs = append(recs, r.Record())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+	checkRecords(t, "gzip", recs)
+	if err := r.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+
+	if _, err := New(bytes.NewReader([]byte{0x1f, 0x8b, 0}), testFormat); err == nil {
+		t.Errorf("New: no error for a broken gzip header")
+	}
+	if _, err := Open(filepath.Join(dir, "missing.log"), testFormat); err == nil {
+		t.Errorf("Open: no error for a missing file")
+	}
+}
+
+func TestEndAndErrors(t *testing.T) {
+	r, err := New(strings.NewReader(formatted(testFormat, "")), testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for r.Next() {
+		n++
+	}
+	for i := 0; i < 2; i++ {
+		if r.Next() || r.Record() != nil || r.Err() != nil {
+			t.Errorf("Next: after the end got %v, %+v, %v", true, r.Record(), r.Err())
+		}
+	}
+	if n != 3 {
+		t.Errorf("Next: %d records before the end", n)
+	}
+
+	// A first line the format did not write has no record to continue
+	r, _ = New(strings.NewReader("garbage\n"+formatted(testFormat, "")), testFormat)
+	if r.Next() || !errors.Is(r.Err(), log4go.ErrLineFormat) || !strings.HasPrefix(r.Err().Error(), "line 1: ") {
+		t.Errorf("Next: got %v for a stray first line", r.Err())
+	}
+	if r.Next() || r.Record() != nil {
+		t.Errorf("Next: went on after an error")
+	}
+
+	// Lines longer than MAX_LINE
+	long := "[2024/03/14 16:02:55] [INFO] (main.go:1) " + strings.Repeat("x", MAX_LINE) + "\n"
+	r, _ = New(strings.NewReader(long), testFormat)
+	if r.Next() || r.Err() == nil {
+		t.Errorf("Next: no error for a line longer than MAX_LINE")
+	}
+
+	if recs, err := ReadAll(strings.NewReader(""), testFormat); err != nil || len(recs) != 0 {
+		t.Errorf("ReadAll: got %v, %v for no input", recs, err)
+	}
+}
+
+// What a FileLogWriter writes reads back the same
+func TestFileLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := log4go.NewFileLogWriter("app").SetFormat(testFormat).SetIndent("  ")
+	w.SetPath(dir)
+	for _, rec := range testRecords() {
+		w.LogWrite(rec)
+	}
+	w.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("FileLogWriter: expected 1 file, found %v", files)
+	}
+	r, err := Open(files[0], testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetIndent("  ")
+	var recs []*log4go.LogRecord
+	for r.Next() {
+		recs = append(recs, r.Record())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+	checkRecords(t, "FileLogWriter", recs)
+}
@@ -0,0 +1,106 @@
+package log4go
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The fields HostMetadata sets
+const (
+	HOST_FIELD      = "host"
+	POD_FIELD       = "pod"
+	NAMESPACE_FIELD = "namespace"
+	NODE_FIELD      = "node"
+	CONTAINER_FIELD = "container"
+)
+
+var (
+	hostMetadataOnce sync.Once
+	hostMetadataVal  Fields
+)
+
+// HostMetadata returns where the program runs: its host name and, those
+// known, its Kubernetes pod, namespace and node and its container ID.  The
+// pod, namespace and node are taken from the variables POD_NAME,
+// POD_NAMESPACE and NODE_NAME, set from the downward API:
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: POD_NAMESPACE
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	- name: NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//
+// It is read once; the returned Fields must not be changed.
+func HostMetadata() Fields {
+	hostMetadataOnce.Do(func() {
+		host, _ := os.Hostname()
+		hostMetadataVal = hostMetadata(host, os.Getenv, ioutil.ReadFile)
+	})
+	return hostMetadataVal
+}
+
+func hostMetadata(host string, getenv func(string) string, readFile func(string) ([]byte, error)) Fields {
+	fields := make(Fields)
+	set := func(k, v string) {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			fields[k] = v
+		}
+	}
+	set(HOST_FIELD, host)
+
+	pod := getenv("POD_NAME")
+	inCluster := len(getenv("KUBERNETES_SERVICE_HOST")) > 0
+	if len(pod) == 0 && inCluster {
+		// Pods are named after their host
+		pod = host
+	}
+	set(POD_FIELD, pod)
+
+	namespace := getenv("POD_NAMESPACE")
+	if len(namespace) == 0 && inCluster {
+		if b, err := readFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+			namespace = string(b)
+		}
+	}
+	set(NAMESPACE_FIELD, namespace)
+	set(NODE_FIELD, getenv("NODE_NAME"))
+	set(CONTAINER_FIELD, containerID(readFile))
+	return fields
+}
+
+var (
+	cgroupContainerRE = regexp.MustCompile(`[0-9a-f]{64}`)
+	mountContainerRE  = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+)
+
+// The ID of the container the program runs in, from its cgroup (cgroup v1)
+// or the files the runtime mounts into it (cgroup v2), or ""
+func containerID(readFile func(string) ([]byte, error)) string {
+	if b, err := readFile("/proc/self/cgroup"); err == nil {
+		if ids := cgroupContainerRE.FindAllString(string(b), -1); len(ids) > 0 {
+			return ids[len(ids)-1]
+		}
+	}
+	if b, err := readFile("/proc/self/mountinfo"); err == nil {
+		if m := mountContainerRE.FindStringSubmatch(string(b)); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// EnrichMiddleware returns middleware adding fields to every record that
+// does not have them yet, e.g. to stamp records with where they come from:
+//
+//	log.Use(log4go.EnrichMiddleware(log4go.HostMetadata()))
+func EnrichMiddleware(fields Fields) Middleware {
+	return func(rec *LogRecord, next func(*LogRecord)) {
+		rec.Fields = mergeFields(fields, rec.Fields)
+		next(rec)
+	}
+}
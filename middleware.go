@@ -0,0 +1,36 @@
+package log4go
+
+// A Middleware sees each record before it goes on and decides what happens
+// to it: it may change or enrich rec, call next with it (or with another
+// record, or several times), or drop it by not calling next at all.
+type Middleware func(rec *LogRecord, next func(*LogRecord))
+
+// Install middleware that sees every record dispatched by the logger, before
+// hooks and filters (chainable).  The first middleware added runs first.
+func (log *Logger) Use(mw ...Middleware) *Logger {
+	log.update(false, func(st *loggerState) {
+		st.middleware = append(st.middleware[:len(st.middleware):len(st.middleware)], mw...)
+	})
+	return log
+}
+
+// Install middleware that sees the records this filter accepts by level
+// (chainable).  It gets its own copy of each record, but Fields is shared
+// and must be copied before it is changed.  Must be called before the first
+// log message is written.
+func (f *Filter) Use(mw ...Middleware) *Filter {
+	f.middleware = append(f.middleware, mw...)
+	return f
+}
+
+// Build the function passing a record through mws and then on to final
+func chainMiddleware(mws []Middleware, final func(*LogRecord)) func(*LogRecord) {
+	next := final
+	for i := len(mws) - 1; i >= 0; i-- {
+		mw, n := mws[i], next
+		next = func(rec *LogRecord) {
+			mw(rec, n)
+		}
+	}
+	return next
+}
@@ -0,0 +1,174 @@
+package log4go
+
+import (
+	"math"
+)
+
+// MsgpackEncoder writes each record as a MessagePack map with the same keys
+// as the JSON encoding (Level, Created, Source, Message and, if set, Fields,
+// Name, Tag, Seq and Data, the latter as a string holding the JSON).  Created
+// uses the timestamp extension type.  The
+// messages delimit themselves, so no framing is needed on stream sockets.
+type MsgpackEncoder struct{}
+
+func (MsgpackEncoder) Encode(dst []byte, rec *LogRecord) []byte {
+	n := 4
+	if len(rec.Fields) > 0 {
+		n++
+	}
+	if len(rec.Name) > 0 {
+		n++
+	}
+	if len(rec.Tag) > 0 {
+		n++
+	}
+	if rec.Seq != 0 {
+		n++
+	}
+	if len(rec.Data) > 0 {
+		n++
+	}
+	dst = append(dst, 0x80|byte(n)) // fixmap
+
+	dst = appendMsgpackString(dst, "Level")
+	dst = appendMsgpackInt(dst, int64(rec.Level))
+	dst = appendMsgpackString(dst, "Created")
+	dst = appendMsgpackTime(dst, rec.Created.Unix(), uint32(rec.Created.Nanosecond()))
+	dst = appendMsgpackString(dst, "Source")
+	dst = appendMsgpackString(dst, rec.Source)
+	dst = appendMsgpackString(dst, "Message")
+	dst = appendMsgpackString(dst, rec.Message)
+	if len(rec.Fields) > 0 {
+		dst = appendMsgpackString(dst, "Fields")
+		dst = appendMsgpackMapHeader(dst, len(rec.Fields))
+		for _, k := range sortedFieldKeys(rec.Fields) {
+			dst = appendMsgpackString(dst, k)
+			dst = appendMsgpackValue(dst, rec.Fields[k])
+		}
+	}
+	if len(rec.Name) > 0 {
+		dst = appendMsgpackString(dst, "Name")
+		dst = appendMsgpackString(dst, rec.Name)
+	}
+	if len(rec.Tag) > 0 {
+		dst = appendMsgpackString(dst, "Tag")
+		dst = appendMsgpackString(dst, rec.Tag)
+	}
+	if rec.Seq != 0 {
+		dst = appendMsgpackString(dst, "Seq")
+		dst = appendMsgpackValue(dst, rec.Seq)
+	}
+	if len(rec.Data) > 0 {
+		dst = appendMsgpackString(dst, "Data")
+		dst = appendMsgpackString(dst, string(rec.Data))
+	}
+	return dst
+}
+
+func appendMsgpackValue(dst []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, 0xc0)
+	case bool:
+		if v {
+			return append(dst, 0xc3)
+		}
+		return append(dst, 0xc2)
+	case string:
+		return appendMsgpackString(dst, v)
+	case int:
+		return appendMsgpackInt(dst, int64(v))
+	case int32:
+		return appendMsgpackInt(dst, int64(v))
+	case int64:
+		return appendMsgpackInt(dst, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendMsgpackInt(dst, int64(v))
+		}
+		dst = append(dst, 0xcf)
+		return appendBigEndian64(dst, v)
+	case float64:
+		dst = append(dst, 0xcb)
+		return appendBigEndian64(dst, math.Float64bits(v))
+	case float32:
+		dst = append(dst, 0xca)
+		return appendBigEndian32(dst, math.Float32bits(v))
+	case []byte:
+		dst = appendMsgpackLength(dst, len(v), 0xc4, 0xc5, 0xc6)
+		return append(dst, v...)
+	}
+	return appendMsgpackString(dst, string(appendValue(nil, v)))
+}
+
+func appendMsgpackInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		return append(dst, byte(v)) // positive fixint
+	case v < 0 && v >= -32:
+		return append(dst, byte(v)) // negative fixint
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		dst = append(dst, 0xd1)
+		return appendBigEndian16(dst, uint16(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		dst = append(dst, 0xd2)
+		return appendBigEndian32(dst, uint32(v))
+	}
+	dst = append(dst, 0xd3)
+	return appendBigEndian64(dst, uint64(v))
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	if len(s) < 32 {
+		dst = append(dst, 0xa0|byte(len(s))) // fixstr
+	} else {
+		dst = appendMsgpackLength(dst, len(s), 0xd9, 0xda, 0xdb)
+	}
+	return append(dst, s...)
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	if n < 16 {
+		return append(dst, 0x80|byte(n)) // fixmap
+	}
+	if n <= math.MaxUint16 {
+		dst = append(dst, 0xde)
+		return appendBigEndian16(dst, uint16(n))
+	}
+	dst = append(dst, 0xdf)
+	return appendBigEndian32(dst, uint32(n))
+}
+
+// Append a length with the 8, 16 or 32 bit marker as needed
+func appendMsgpackLength(dst []byte, n int, m8, m16, m32 byte) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(dst, m8, byte(n))
+	case n <= math.MaxUint16:
+		dst = append(dst, m16)
+		return appendBigEndian16(dst, uint16(n))
+	}
+	dst = append(dst, m32)
+	return appendBigEndian32(dst, uint32(n))
+}
+
+// The timestamp extension (type -1) in its 96 bit form
+func appendMsgpackTime(dst []byte, sec int64, nsec uint32) []byte {
+	dst = append(dst, 0xc7, 12, 0xff)
+	dst = appendBigEndian32(dst, nsec)
+	return appendBigEndian64(dst, uint64(sec))
+}
+
+func appendBigEndian16(dst []byte, v uint16) []byte {
+	return append(dst, byte(v>>8), byte(v))
+}
+
+func appendBigEndian32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendBigEndian64(dst []byte, v uint64) []byte {
+	return appendBigEndian32(appendBigEndian32(dst, uint32(v>>32)), uint32(v))
+}
@@ -0,0 +1,87 @@
+package log4go
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logt logs a message template at lvl: each {name} in tmpl is replaced by
+// the value of the field name, and the fields are attached to the record as
+// well, so they are given once for both, e.g.
+//
+//	log.Infot("user {user} logged in from {ip}", log4go.Fields{"user": u, "ip": ip})
+//
+// Placeholders without a field are left as they are; {{ and }} stand for
+// literal braces.
+func (log *Logger) Logt(lvl Level, tmpl string, fields Fields) {
+	log.logt(3, lvl, tmpl, fields)
+}
+
+func (log *Logger) Tracet(tmpl string, fields Fields) {
+	log.logt(3, TRACE, tmpl, fields)
+}
+
+func (log *Logger) Debugt(tmpl string, fields Fields) {
+	log.logt(3, DEBUG, tmpl, fields)
+}
+
+func (log *Logger) Infot(tmpl string, fields Fields) {
+	log.logt(3, INFO, tmpl, fields)
+}
+
+func (log *Logger) Warnt(tmpl string, fields Fields) {
+	log.logt(3, WARNING, tmpl, fields)
+}
+
+func (log *Logger) Errort(tmpl string, fields Fields) {
+	log.logt(3, ERROR, tmpl, fields)
+}
+
+func (log *Logger) Criticalt(tmpl string, fields Fields) {
+	log.logt(3, CRITICAL, tmpl, fields)
+}
+
+// Log a message template; depth is passed to runtime.Caller by intLog
+func (log *Logger) logt(depth int, lvl Level, tmpl string, fields Fields) {
+	if log.skip(lvl) {
+		return
+	}
+	log.intLog(depth, lvl, fields, renderTemplate(tmpl, fields))
+}
+
+// Replace the {name} placeholders of tmpl with the values of fields
+func renderTemplate(tmpl string, fields Fields) string {
+	if !strings.ContainsAny(tmpl, "{}") {
+		return tmpl
+	}
+	var b strings.Builder
+	b.Grow(len(tmpl) + 32)
+	for i := 0; i < len(tmpl); i++ {
+		c := tmpl[i]
+		if (c == '{' || c == '}') && i+1 < len(tmpl) && tmpl[i+1] == c {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if c != '{' {
+			b.WriteByte(c)
+			continue
+		}
+		end := strings.IndexAny(tmpl[i+1:], "{}")
+		if end < 0 || tmpl[i+1+end] != '}' {
+			b.WriteByte(c)
+			continue
+		}
+		name := tmpl[i+1 : i+1+end]
+		v, ok := fields[name]
+		if !ok {
+			b.WriteString(tmpl[i : i+2+end])
+		} else if s, ok := v.(string); ok {
+			b.WriteString(s)
+		} else {
+			fmt.Fprint(&b, v)
+		}
+		i += 1 + end
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package log4go
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// When each LogOncef/LogEveryf call site last logged
+var (
+	callSitesMu sync.Mutex
+	callSites   = make(map[uintptr]time.Time)
+)
+
+// Reports whether the call site pc may log now, given it may log once per
+// interval (or only once if interval is zero), and records that it did.
+func callSiteDue(pc uintptr, interval time.Duration) bool {
+	now := clockNow()
+
+	callSitesMu.Lock()
+	defer callSitesMu.Unlock()
+	last, seen := callSites[pc]
+	if seen && (interval <= 0 || now.Sub(last) < interval) {
+		return false
+	}
+	callSites[pc] = now
+	return true
+}
+
+// Log a formatted message only the first time this line is reached with lvl
+// enabled, e.g. for deprecation warnings.
+func LogOncef(lvl Level, format string, params ...interface{}) {
+	if log.skip(lvl) {
+		return
+	}
+	pc, _, _, _ := runtime.Caller(1)
+	if !callSiteDue(pc, 0) {
+		return
+	}
+	log.intLog(2, lvl, nil, format, params...)
+}
+
+// Log a formatted message from this line at most once per interval, e.g. for
+// diagnostics on a hot path.
+func LogEveryf(interval time.Duration, lvl Level, format string, params ...interface{}) {
+	if log.skip(lvl) {
+		return
+	}
+	pc, _, _, _ := runtime.Caller(1)
+	if !callSiteDue(pc, interval) {
+		return
+	}
+	log.intLog(2, lvl, nil, format, params...)
+}
@@ -0,0 +1,30 @@
+package log4go
+
+import (
+	"sync/atomic"
+)
+
+// Set what happens when the filter's queue is full (chainable).  The default,
+// OverflowBlock, makes the logging call wait; the drop policies never block
+// and count what they discard.  Must be called before the first log message
+// is written.
+func (f *Filter) SetOverflow(policy OverflowPolicy) *Filter {
+	f.overflow = policy
+	return f
+}
+
+// Dropped returns how many records the overflow policy discarded.
+func (f *Filter) Dropped() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
+
+// Queue rec according to the overflow policy
+func (f *Filter) send(rec *LogRecord) {
+	if atomic.LoadInt32(&f.sync) != 0 {
+		f.writeSync(rec)
+		return
+	}
+	if enqueueWithPolicy(f.rec, f.done, rec, f.overflow, &f.dropped) {
+		atomic.AddUint64(&f.enqueued, 1)
+	}
+}
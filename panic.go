@@ -0,0 +1,67 @@
+package log4go
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// RecoverAndLog recovers a panic and logs the value and the stack trace at
+// CRITICAL.  It must be deferred directly:
+//
+//	defer log4go.RecoverAndLog(logger)
+func RecoverAndLog(log *Logger) {
+	if v := recover(); v != nil {
+		log.logPanic(v)
+	}
+}
+
+// RecoverLogAndPanic is like RecoverAndLog, but panics again with the same
+// value once it is logged, so the program still crashes.  The logger is
+// flushed first.
+func RecoverLogAndPanic(log *Logger) {
+	if v := recover(); v != nil {
+		log.logPanic(v)
+		log.Flush()
+		panic(v)
+	}
+}
+
+// CapturePanics calls f, logging any panic to the default logger instead of
+// crashing, e.g. to start a goroutine with go log4go.CapturePanics(worker).
+func CapturePanics(f func()) {
+	defer RecoverAndLog(log)
+	f()
+}
+
+func (log *Logger) logPanic(v interface{}) {
+	if log.skip(CRITICAL) {
+		return
+	}
+	log.dispatch(&LogRecord{
+		Level:   CRITICAL,
+		Created: clockNow(),
+		Source:  panicSource(),
+		Message: fmt.Sprintf("panic: %v\n%s", v, debug.Stack()),
+	})
+}
+
+// The source of the function that panicked: the first caller outside the
+// runtime and this file
+func panicSource() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") &&
+			!strings.HasSuffix(frame.Function, ".RecoverAndLog") &&
+			!strings.HasSuffix(frame.Function, ".RecoverLogAndPanic") {
+			return fmt.Sprintf("%s %s:%d", frame.File, filepath.Base(frame.Function), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package log4go
+
+import (
+	"sync/atomic"
+)
+
+// Disable stops the filter taking records until Enable is called, keeping
+// its writer open.  Records already queued are still written.
+func (f *Filter) Disable() {
+	atomic.StoreInt32(&f.paused, 1)
+}
+
+// Enable lets a disabled filter take records again.
+func (f *Filter) Enable() {
+	atomic.StoreInt32(&f.paused, 0)
+}
+
+// Disabled reports whether the filter is disabled.
+func (f *Filter) Disabled() bool {
+	return atomic.LoadInt32(&f.paused) != 0
+}
+
+// DisableFilter mutes the filter added under name, e.g. a noisy sink, until
+// EnableFilter is called, without closing its writer.  Records routed to it
+// go to the fallback filters meanwhile.  Returns whether there is such a
+// filter.
+func (log *Logger) DisableFilter(name string) bool {
+	filt := log.Filter(name)
+	if filt == nil {
+		return false
+	}
+	filt.Disable()
+	return true
+}
+
+// EnableFilter resumes the filter added under name.  Returns whether there
+// is such a filter.
+func (log *Logger) EnableFilter(name string) bool {
+	filt := log.Filter(name)
+	if filt == nil {
+		return false
+	}
+	filt.Enable()
+	return true
+}
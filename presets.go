@@ -0,0 +1,42 @@
+package log4go
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Format of NewDevelopmentLogger: date and time, level, short source,
+	// message and fields
+	FORMAT_DEVELOPMENT = "[%D %T] [%L] (%s) %M %F"
+
+	// Size and age at which NewProductionLogger starts a new file
+	PRODUCTION_FILE_SIZE = 100 * 1024 * 1024
+	PRODUCTION_FILE_AGE  = 24 * time.Hour
+)
+
+// Create a new logger for working on a program: everything from DEBUG up
+// goes to standard output in color, unless NO_COLOR is set, in
+// FORMAT_DEVELOPMENT, with the file and line that logged it.
+func NewDevelopmentLogger() *Logger {
+	w := NewConsoleLogWriter().SetColor(true).SetFormat(FORMAT_DEVELOPMENT)
+	return NewLogger().SetFilter("stdout", NewFilter(DEBUG, w))
+}
+
+// Create a new logger for running a program in production: records from
+// INFO up are written as JSON lines to files named after path, e.g.
+// /var/log/app/app-20240314160255-814856400.log for /var/log/app/app.log,
+// starting a new file every PRODUCTION_FILE_SIZE bytes or PRODUCTION_FILE_AGE.
+// Of each second's records with the same level and message, the first 100
+// are written and then every 100th, so a hot loop cannot flood the disk.
+func NewProductionLogger(path string) *Logger {
+	dir, name := filepath.Split(path)
+	name = strings.TrimSuffix(name, ".log")
+	w := NewFileLogWriter(name).SetEncoder(JSONEncoder{}).SetRotateInterval(PRODUCTION_FILE_AGE)
+	w.SetBufSize(PRODUCTION_FILE_SIZE)
+	if len(dir) > 0 {
+		w.SetPath(dir)
+	}
+	return NewLogger().SetFilter("file", NewFilter(INFO, w).SetSampling(100, 100))
+}
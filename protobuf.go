@@ -0,0 +1,217 @@
+package log4go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Field numbers of logrecord.proto
+const (
+	pbLevel   = 1
+	pbCreated = 2
+	pbSource  = 3
+	pbMessage = 4
+	pbFields  = 5
+	pbName    = 6
+	pbTag     = 7
+	pbSeq     = 8
+	pbData    = 9
+)
+
+// Protobuf wire types
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// Longest message ReadProtobufRecord accepts
+const PROTOBUF_MAX_SIZE = 16 * 1024 * 1024
+
+// ProtobufEncoder writes records as length-prefixed LogRecord messages of
+// logrecord.proto, for collectors written in other languages.  Field values
+// are sent as text.
+type ProtobufEncoder struct{}
+
+func (ProtobufEncoder) Encode(dst []byte, rec *LogRecord) []byte {
+	msg := appendProtobufRecord(nil, rec)
+	dst = appendUvarint(dst, uint64(len(msg)))
+	return append(dst, msg...)
+}
+
+func appendProtobufRecord(dst []byte, rec *LogRecord) []byte {
+	if rec.Level != 0 {
+		dst = appendUvarint(dst, pbLevel<<3|pbVarint)
+		dst = appendUvarint(dst, uint64(rec.Level))
+	}
+	if !rec.Created.IsZero() {
+		dst = appendUvarint(dst, pbCreated<<3|pbVarint)
+		dst = appendUvarint(dst, uint64(rec.Created.UnixNano()))
+	}
+	dst = appendProtobufString(dst, pbSource, rec.Source)
+	dst = appendProtobufString(dst, pbMessage, rec.Message)
+	for _, k := range sortedFieldKeys(rec.Fields) {
+		var entry []byte
+		entry = appendProtobufString(entry, 1, k)
+		entry = appendProtobufString(entry, 2, string(appendValue(nil, rec.Fields[k])))
+		dst = appendUvarint(dst, pbFields<<3|pbBytes)
+		dst = appendUvarint(dst, uint64(len(entry)))
+		dst = append(dst, entry...)
+	}
+	dst = appendProtobufString(dst, pbName, rec.Name)
+	dst = appendProtobufString(dst, pbTag, rec.Tag)
+	if rec.Seq != 0 {
+		dst = appendUvarint(dst, pbSeq<<3|pbVarint)
+		dst = appendUvarint(dst, rec.Seq)
+	}
+	dst = appendProtobufString(dst, pbData, string(rec.Data))
+	return dst
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
+
+func appendProtobufString(dst []byte, field uint64, s string) []byte {
+	if len(s) == 0 {
+		return dst
+	}
+	dst = appendUvarint(dst, field<<3|pbBytes)
+	dst = appendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// ReadProtobufRecord reads one length-prefixed record written by a
+// ProtobufEncoder.  It returns io.EOF at the end of the stream.
+func ReadProtobufRecord(r *bufio.Reader) (*LogRecord, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > PROTOBUF_MAX_SIZE {
+		return nil, fmt.Errorf("protobuf record of %d bytes is too large", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return UnmarshalProtobufRecord(msg)
+}
+
+var errProtobufTruncated = errors.New("truncated protobuf record")
+
+// UnmarshalProtobufRecord decodes a LogRecord message without its length
+// prefix.  Unknown fields are skipped.
+func UnmarshalProtobufRecord(msg []byte) (*LogRecord, error) {
+	rec := new(LogRecord)
+	for len(msg) > 0 {
+		field, wire, value, rest, err := nextProtobufField(msg)
+		if err != nil {
+			return nil, err
+		}
+		msg = rest
+
+		switch {
+		case field == pbLevel && wire == pbVarint:
+			rec.Level = Level(value.num)
+		case field == pbCreated && wire == pbVarint:
+			rec.Created = time.Unix(0, int64(value.num))
+		case field == pbSource && wire == pbBytes:
+			rec.Source = string(value.data)
+		case field == pbMessage && wire == pbBytes:
+			rec.Message = string(value.data)
+		case field == pbName && wire == pbBytes:
+			rec.Name = string(value.data)
+		case field == pbTag && wire == pbBytes:
+			rec.Tag = string(value.data)
+		case field == pbSeq && wire == pbVarint:
+			rec.Seq = value.num
+		case field == pbData && wire == pbBytes:
+			rec.Data = append(json.RawMessage(nil), value.data...)
+		case field == pbFields && wire == pbBytes:
+			k, v, err := unmarshalProtobufEntry(value.data)
+			if err != nil {
+				return nil, err
+			}
+			if rec.Fields == nil {
+				rec.Fields = make(Fields)
+			}
+			rec.Fields[k] = v
+		}
+	}
+	return rec, nil
+}
+
+func unmarshalProtobufEntry(msg []byte) (key, value string, err error) {
+	for len(msg) > 0 {
+		field, wire, v, rest, err := nextProtobufField(msg)
+		if err != nil {
+			return "", "", err
+		}
+		msg = rest
+		if wire != pbBytes {
+			continue
+		}
+		switch field {
+		case 1:
+			key = string(v.data)
+		case 2:
+			value = string(v.data)
+		}
+	}
+	return key, value, nil
+}
+
+type protobufValue struct {
+	num  uint64
+	data []byte
+}
+
+// Split the first field off msg
+func nextProtobufField(msg []byte) (field uint64, wire int, value protobufValue, rest []byte, err error) {
+	tag, n := binary.Uvarint(msg)
+	if n <= 0 {
+		return 0, 0, value, nil, errProtobufTruncated
+	}
+	msg = msg[n:]
+	field, wire = tag>>3, int(tag&7)
+
+	switch wire {
+	case pbVarint:
+		value.num, n = binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, 0, value, nil, errProtobufTruncated
+		}
+		return field, wire, value, msg[n:], nil
+	case pbFixed64, pbFixed32:
+		size := 8
+		if wire == pbFixed32 {
+			size = 4
+		}
+		if len(msg) < size {
+			return 0, 0, value, nil, errProtobufTruncated
+		}
+		return field, wire, value, msg[size:], nil
+	case pbBytes:
+		size, n := binary.Uvarint(msg)
+		if n <= 0 || size > uint64(len(msg)-n) {
+			return 0, 0, value, nil, errProtobufTruncated
+		}
+		value.data = msg[n : n+int(size)]
+		return field, wire, value, msg[n+int(size):], nil
+	}
+	return 0, 0, value, nil, fmt.Errorf("unsupported protobuf wire type %d", wire)
+}
@@ -0,0 +1,139 @@
+package log4go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A token bucket refilled at rate tokens per second up to burst tokens.
+// Records arriving with the bucket empty are suppressed and counted; the
+// count is reported in a summary record once records flow again.
+type rateLimiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clockNow(),
+	}
+}
+
+// Add the tokens earned since the last refill; r.mu must be held
+func (r *rateLimiter) refill(now time.Time) {
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+}
+
+// Take a token from each of limiters, or from none if one is empty, so a
+// record dropped by one limit does not use up the others.  Returns whether
+// the record may pass and, if it may, how many records were suppressed
+// since the last one that did.
+func allowAll(now time.Time, limiters ...*rateLimiter) (bool, int) {
+	for _, r := range limiters {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.refill(now)
+	}
+
+	for _, r := range limiters {
+		if r.tokens < 1 {
+			r.suppressed++
+			return false, 0
+		}
+	}
+	suppressed := 0
+	for _, r := range limiters {
+		r.tokens--
+		suppressed += r.suppressed
+		r.suppressed = 0
+	}
+	return true, suppressed
+}
+
+// Limit the filter to rate records per second with bursts of up to burst
+// records (chainable).  Excess records are dropped and summarized.  A rate of
+// zero or less removes the limit.  Must be called before the first log message
+// is written.
+func (f *Filter) SetRateLimit(rate float64, burst int) *Filter {
+	if rate <= 0 {
+		f.limit = nil
+	} else {
+		f.limit = newRateLimiter(rate, burst)
+	}
+	return f
+}
+
+// Like SetRateLimit, but only for records of level lvl (chainable).  A record
+// must pass both its level limit and the filter limit.
+func (f *Filter) SetLevelRateLimit(lvl Level, rate float64, burst int) *Filter {
+	if rate <= 0 {
+		delete(f.levelLimits, lvl)
+		return f
+	}
+	if f.levelLimits == nil {
+		f.levelLimits = make(map[Level]*rateLimiter)
+	}
+	f.levelLimits[lvl] = newRateLimiter(rate, burst)
+	return f
+}
+
+// Apply the rate limits to rec.  Returns false if rec must be dropped;
+// otherwise also returns a summary of earlier drops, if any, to write first.
+func (f *Filter) rateLimit(rec *LogRecord) (bool, *LogRecord) {
+	now := clockNow()
+	// Always locked level limit first, then the filter limit
+	limiters := make([]*rateLimiter, 0, 2)
+	if l := f.levelLimits[rec.Level]; l != nil {
+		limiters = append(limiters, l)
+	}
+	if f.limit != nil {
+		limiters = append(limiters, f.limit)
+	}
+	ok, suppressed := allowAll(now, limiters...)
+	if !ok {
+		return false, nil
+	}
+	if suppressed == 0 {
+		return true, nil
+	}
+	return true, &LogRecord{
+		Level:   rec.Level,
+		Created: now,
+		Source:  "log4go",
+		Message: fmt.Sprintf("rate limit: %d records suppressed", suppressed),
+	}
+}
+
+// Parse a "rate[,burst]" rate limit property; burst defaults to rate.
+func parseRateLimit(str string) (float64, int, error) {
+	parts := strings.SplitN(str, ",", 2)
+	rate, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	burst := int(rate)
+	if len(parts) > 1 {
+		burst, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return rate, burst, nil
+}
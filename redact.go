@@ -0,0 +1,127 @@
+package log4go
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// What redacted text is replaced with
+	REDACTED = "[REDACTED]"
+)
+
+// A Redactor scrubs sensitive data from records before any writer sees them.
+// Messages are searched for its expressions and fields named in its field
+// list have their values replaced.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	fields   map[string]bool
+	mask     string
+}
+
+var redactor atomic.Value // *Redactor
+
+// This creates an empty Redactor
+func NewRedactor() *Redactor {
+	return &Redactor{
+		fields: make(map[string]bool),
+		mask:   REDACTED,
+	}
+}
+
+// This creates a Redactor for common secrets: password, token and key
+// fields, key=value pairs of those in messages, and card numbers.
+func NewDefaultRedactor() *Redactor {
+	r := NewRedactor()
+	for _, name := range []string{"password", "passwd", "pwd", "secret", "token", "apikey", "api_key", "authorization"} {
+		r.AddField(name)
+	}
+	r.AddPattern(regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|token|api[_-]?key)\s*[=:]\s*("[^"]*"|\S+)`))
+	r.AddPattern(regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`))
+	return r
+}
+
+// Mask text matching re in messages (chainable).  If re has capturing
+// groups only the text they match is masked, otherwise the whole match.
+func (r *Redactor) AddPattern(re *regexp.Regexp) *Redactor {
+	r.patterns = append(r.patterns, re)
+	return r
+}
+
+// Mask the value of fields called name, ignoring case (chainable)
+func (r *Redactor) AddField(name string) *Redactor {
+	r.fields[strings.ToLower(name)] = true
+	return r
+}
+
+// Set the replacement for redacted text (chainable)
+func (r *Redactor) SetMask(mask string) *Redactor {
+	r.mask = mask
+	return r
+}
+
+// Redact scrubs rec in place.  Fields are copied before they are changed, as
+// the map may belong to the caller.
+func (r *Redactor) Redact(rec *LogRecord) {
+	for _, re := range r.patterns {
+		rec.Message = r.redactString(re, rec.Message)
+	}
+
+	var fields Fields
+	for k, v := range rec.Fields {
+		if !r.fields[strings.ToLower(k)] {
+			continue
+		}
+		if fields == nil {
+			fields = make(Fields, len(rec.Fields))
+			for k, v := range rec.Fields {
+				fields[k] = v
+			}
+		}
+		if v != nil {
+			fields[k] = r.mask
+		}
+	}
+	if fields != nil {
+		rec.Fields = fields
+	}
+}
+
+func (r *Redactor) redactString(re *regexp.Regexp, s string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, r.mask)
+	}
+
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	last := 0
+	for _, m := range matches {
+		for i := 2; i+1 < len(m); i += 2 {
+			if m[i] < last {
+				continue
+			}
+			out = append(out, s[last:m[i]]...)
+			out = append(out, r.mask...)
+			last = m[i+1]
+		}
+	}
+	out = append(out, s[last:]...)
+	return string(out)
+}
+
+// Install r to scrub every record of every Logger before it is dispatched;
+// nil turns redaction off.  Safe to call while logging.
+func SetRedactor(r *Redactor) {
+	redactor.Store(&r)
+}
+
+func currentRedactor() *Redactor {
+	if r, ok := redactor.Load().(**Redactor); ok {
+		return *r
+	}
+	return nil
+}
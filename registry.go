@@ -0,0 +1,52 @@
+package log4go
+
+import (
+	"sort"
+	"sync"
+)
+
+// The loggers returned by GetLogger, by name
+var registry = struct {
+	sync.Mutex
+	loggers map[string]*Logger
+}{loggers: make(map[string]*Logger)}
+
+// GetLogger returns the logger named name, creating it without filters the
+// first time, so libraries in one program can log apart from each other and
+// from the default logger, e.g. GetLogger("payments").  Its records carry
+// the name, shown by the %N format.  The filters of a named logger may be
+// set in its own section of a configuration file; see Config.Loggers.  The
+// empty name is the default logger the package level functions use.
+func GetLogger(name string) *Logger {
+	if len(name) == 0 {
+		return log
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	l, ok := registry.loggers[name]
+	if !ok {
+		l = NewLogger()
+		l.name = name
+		registry.loggers[name] = l
+	}
+	return l
+}
+
+// LoggerNames returns the names of the loggers GetLogger created, sorted.
+func LoggerNames() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.loggers))
+	for name := range registry.loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close the loggers GetLogger created; they stay registered
+func closeNamedLoggers() {
+	for _, name := range LoggerNames() {
+		GetLogger(name).Close()
+	}
+}
@@ -0,0 +1,191 @@
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay before WatchConfig asks a source again after it failed
+const CONFIG_RETRY = 5 * time.Second
+
+// Default delay between two reads of an EtcdSource
+const ETCD_INTERVAL = 10 * time.Second
+
+// A ConfigSource holds a configuration that may change while the program
+// runs, such as an etcd or Consul key.
+type ConfigSource interface {
+	// Watch returns the configuration and its version once the version
+	// differs from the one given, which is 0 the first time.  It blocks
+	// until then or until ctx is done.
+	Watch(ctx context.Context, version uint64) ([]byte, uint64, error)
+}
+
+// WatchConfig applies the configuration in src to log and reapplies it each
+// time it changes, until ctx is done.  filename only gives the type of
+// configuration by its extension, e.g. "logging.xml".  A configuration that
+// cannot be read or used is reported to the ErrorHandler and the current
+// filters are kept.  It blocks, so it is usually run in its own goroutine:
+//
+//	src := &log4go.ConsulSource{Addr: "http://localhost:8500", Key: "myapp/logging"}
+//	go log4go.WatchLogConfig(ctx, src, "logging.xml")
+func (log *Logger) WatchConfig(ctx context.Context, src ConfigSource, filename string) error {
+	var version uint64
+	for {
+		buf, next, err := src.Watch(ctx, version)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			reportError("WatchConfig", err)
+			select {
+			case <-time.After(CONFIG_RETRY):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+
+		version = next
+		if err := log.ReloadConfigBuf(filename, buf); err != nil {
+			reportError("WatchConfig", err)
+		}
+	}
+}
+
+// A ConsulSource reads the configuration from a key of the Consul KV store
+// and waits for changes with blocking queries.
+type ConsulSource struct {
+	Addr   string       // agent URL, e.g. http://localhost:8500
+	Key    string       // e.g. myapp/logging
+	Token  string       // ACL token, if needed
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (c *ConsulSource) Watch(ctx context.Context, version uint64) ([]byte, uint64, error) {
+	for {
+		u := fmt.Sprintf("%s/v1/kv/%s?raw&wait=5m&index=%d",
+			strings.TrimRight(c.Addr, "/"), strings.TrimLeft(c.Key, "/"), version)
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(c.Token) > 0 {
+			req.Header.Set("X-Consul-Token", c.Token)
+		}
+
+		resp, err := httpClient(c.Client).Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, 0, err
+		}
+		buf, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, 0, fmt.Errorf("consul key %q not found", c.Key)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, 0, fmt.Errorf("consul key %q: %s", c.Key, resp.Status)
+		}
+
+		index, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("consul key %q: bad X-Consul-Index", c.Key)
+		}
+		// The query timed out without a change
+		if index == version {
+			continue
+		}
+		return buf, index, nil
+	}
+}
+
+// An EtcdSource reads the configuration from an etcd v3 key through the
+// JSON gateway, checking for changes every Interval.
+type EtcdSource struct {
+	Endpoint string        // e.g. http://localhost:2379
+	Key      string        // e.g. /myapp/logging
+	Interval time.Duration // ETCD_INTERVAL if 0
+	Client   *http.Client  // http.DefaultClient if nil
+}
+
+func (e *EtcdSource) Watch(ctx context.Context, version uint64) ([]byte, uint64, error) {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = ETCD_INTERVAL
+	}
+	for {
+		buf, rev, err := e.get(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		if rev != version {
+			return buf, rev, nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+// Read the key and its revision
+func (e *EtcdSource) get(ctx context.Context) ([]byte, uint64, error) {
+	body, _ := json.Marshal(map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(e.Key)),
+	})
+	req, err := http.NewRequest("POST", strings.TrimRight(e.Endpoint, "/")+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient(e.Client).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("etcd key %q: %s", e.Key, resp.Status)
+	}
+
+	// The gateway writes 64 bit integers as strings
+	var rng struct {
+		Kvs []struct {
+			Value       string `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rng); err != nil {
+		return nil, 0, fmt.Errorf("etcd key %q: %s", e.Key, err)
+	}
+	if len(rng.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("etcd key %q not found", e.Key)
+	}
+	buf, err := base64.StdEncoding.DecodeString(rng.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("etcd key %q: %s", e.Key, err)
+	}
+	rev, err := strconv.ParseUint(rng.Kvs[0].ModRevision, 10, 64)
+	if err != nil || rev == 0 {
+		return nil, 0, fmt.Errorf("etcd key %q: bad mod_revision", e.Key)
+	}
+	return buf, rev, nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
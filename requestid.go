@@ -0,0 +1,118 @@
+package log4go
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// The header carrying a request's correlation ID
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// The field holding the correlation ID in records
+const REQUEST_ID_FIELD = "request_id"
+
+// Longest correlation ID taken from a request; longer ones are replaced
+const REQUEST_ID_MAX = 128
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+)
+
+// RequestIDMiddleware returns a function wrapping an http.Handler so that
+// every request has a correlation ID: the one in its X-Request-ID header,
+// or a new random one.  The ID is echoed in the response header, and the
+// request context holds it (see RequestID) and a child of log adding it to
+// every record as the field request_id (see FromContext).  Put it outside
+// HTTPMiddleware so access logs carry the ID as well:
+//
+//	h = log4go.RequestIDMiddleware(log)(log4go.HTTPMiddleware(log, opts)(h))
+func RequestIDMiddleware(log *Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(REQUEST_ID_HEADER)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(REQUEST_ID_HEADER, id)
+
+			ctx := ContextWithRequestID(r.Context(), id)
+			ctx = ContextWithLogger(ctx, log.With(Fields{REQUEST_ID_FIELD: id}))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ContextWithRequestID returns a copy of ctx holding the correlation ID id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the correlation ID held by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ContextWithLogger returns a copy of ctx holding log.
+func ContextWithLogger(ctx context.Context, log *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, log)
+}
+
+// FromContext returns the logger held by ctx or, if there is none, the
+// default logger, with the correlation ID of ctx if it has one.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey).(*Logger); ok {
+		return l
+	}
+	if id := RequestID(ctx); len(id) > 0 {
+		return log.With(Fields{REQUEST_ID_FIELD: id})
+	}
+	return log
+}
+
+// RequestIDTransport is an http.RoundTripper passing the correlation ID of
+// each request's context on in its X-Request-ID header, so the services
+// called log it too.
+type RequestIDTransport struct {
+	Base http.RoundTripper // http.DefaultTransport if nil
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	id := RequestID(req.Context())
+	if len(id) == 0 || len(req.Header.Get(REQUEST_ID_HEADER)) > 0 {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not change the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set(REQUEST_ID_HEADER, id)
+	return base.RoundTrip(req)
+}
+
+// Accept IDs of printable ASCII only, so they cannot forge log lines
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > REQUEST_ID_MAX {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,84 @@
+package log4go
+
+import (
+	"sync"
+)
+
+const (
+	// Default number of records kept
+	RING_SIZE = 1000
+)
+
+// This log writer keeps the most recent records in memory, e.g. to be shown
+// by AdminHandler or attached to a crash report.
+type RingLogWriter struct {
+	mu     sync.Mutex
+	recs   []*LogRecord
+	next   int  // where the next record goes
+	full   bool // recs has wrapped around
+	format string
+}
+
+// This creates a new RingLogWriter holding the last size records (RING_SIZE
+// if size is not positive).
+func NewRingLogWriter(size int) *RingLogWriter {
+	if size <= 0 {
+		size = RING_SIZE
+	}
+	return &RingLogWriter{
+		recs:   make([]*LogRecord, size),
+		format: FORMAT_DEFAULT,
+	}
+}
+
+// Set the format used by Tail (chainable).
+func (r *RingLogWriter) SetFormat(format string) *RingLogWriter {
+	r.format = format
+	return r
+}
+
+func (r *RingLogWriter) LogWrite(rec *LogRecord) {
+	r.mu.Lock()
+	r.recs[r.next] = rec
+	r.next++
+	if r.next == len(r.recs) {
+		r.next, r.full = 0, true
+	}
+	r.mu.Unlock()
+}
+
+// Records returns up to the last n records held, oldest first; all of them
+// if n is not positive.
+func (r *RingLogWriter) Records(n int) []*LogRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.recs)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	out := make([]*LogRecord, n)
+	for i := range out {
+		out[i] = r.recs[(r.next-n+i+len(r.recs))%len(r.recs)]
+	}
+	return out
+}
+
+// Tail returns up to the last n records formatted, oldest first.
+func (r *RingLogWriter) Tail(n int) []string {
+	recs := r.Records(n)
+	lines := make([]string, len(recs))
+	for i, rec := range recs {
+		lines[i] = FormatLogRecord(r.format, rec)
+	}
+	return lines
+}
+
+func (r *RingLogWriter) Close() {
+}
+
+func (r *RingLogWriter) Flush() {
+}
@@ -0,0 +1,161 @@
+package log4go
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// A field a record must carry, with its value matching pattern (in
+// path.Match syntax, so "*" accepts any value)
+type fieldRoute struct {
+	key     string
+	pattern string
+}
+
+func (r fieldRoute) match(rec *LogRecord) bool {
+	v, ok := rec.Fields[r.key]
+	if !ok {
+		return false
+	}
+	matched, _ := path.Match(r.pattern, fmt.Sprint(v))
+	return matched
+}
+
+// Only write records whose field key matches pattern (chainable).  Several
+// routes must all match.  Records taken by a routed filter are not given to
+// fallback filters.  Must be called before the first log message is written.
+func (f *Filter) AddRoute(key, pattern string) *Filter {
+	f.routes = append(f.routes, fieldRoute{key, pattern})
+	return f
+}
+
+// Make the filter only write records that no routed filter accepted
+// (chainable), e.g. the application log next to a routed billing log.  Must
+// be called before the first log message is written.
+func (f *Filter) SetFallback(fallback bool) *Filter {
+	var v int32
+	if fallback {
+		v = 1
+	}
+	atomic.StoreInt32(&f.fallback, v)
+	return f
+}
+
+func (f *Filter) isFallback() bool {
+	return atomic.LoadInt32(&f.fallback) != 0
+}
+
+// Reports whether f wants rec, by level and routes, and is enabled
+func (f *Filter) accepts(rec *LogRecord) bool {
+	if rec.Level < f.levelFor(rec.Source) || f.Disabled() {
+		return false
+	}
+	for _, r := range f.routes {
+		if !r.match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Only write records tagged with Logger.Tag matching pattern (chainable), in
+// path.Match syntax.  Several patterns each accept.  The filter no longer
+// gets untagged records.  Must be called before the first log message is
+// written.
+func (f *Filter) AddTag(pattern string) *Filter {
+	f.tags = append(f.tags, pattern)
+	return f
+}
+
+// Only write records tagged with Logger.Tag matching re (chainable), like
+// AddTag.  Must be called before the first log message is written.
+func (f *Filter) AddTagRegexp(re *regexp.Regexp) *Filter {
+	f.tagRes = append(f.tagRes, re)
+	return f
+}
+
+// Reports whether f only takes tagged records
+func (f *Filter) tagged() bool {
+	return f.tags != nil || f.tagRes != nil
+}
+
+// Reports whether f takes records tagged tag
+func (f *Filter) takesTag(tag string) bool {
+	for _, pattern := range f.tags {
+		if matched, _ := path.Match(pattern, tag); matched {
+			return true
+		}
+	}
+	for _, re := range f.tagRes {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Give a tagged record to the filters taking its tag, or else to the filter
+// named like it or, failing that, those whose name is a path.Match pattern
+// matching it, e.g. "db.*".  Reports whether there was one.
+func (st *loggerState) deliverTagged(rec *LogRecord) bool {
+	taken := false
+	for _, filt := range st.filters {
+		if !filt.takesTag(rec.Tag) {
+			continue
+		}
+		taken = true
+		if filt.accepts(rec) {
+			filt.WriteToChan(rec)
+		}
+	}
+	if taken {
+		return true
+	}
+
+	if filt, ok := st.filters[rec.Tag]; ok {
+		if filt.tagged() {
+			return false
+		}
+		if filt.accepts(rec) {
+			filt.WriteToChan(rec)
+		}
+		return true
+	}
+	for name, filt := range st.filters {
+		if filt.tagged() || !strings.ContainsAny(name, "*?[\\") {
+			continue
+		}
+		if matched, _ := path.Match(name, rec.Tag); !matched {
+			continue
+		}
+		taken = true
+		if filt.accepts(rec) {
+			filt.WriteToChan(rec)
+		}
+	}
+	return taken
+}
+
+// Parse a route spec like "component=billing,region=eu-*"
+func parseRoutes(spec string) ([]fieldRoute, error) {
+	var routes []fieldRoute
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("route %q is not key=pattern", item)
+		}
+		pattern := strings.TrimSpace(item[eq+1:])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("route %q: %s", item, err)
+		}
+		routes = append(routes, fieldRoute{strings.TrimSpace(item[:eq]), pattern})
+	}
+	return routes, nil
+}
@@ -0,0 +1,75 @@
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// ReportRuntimeStats logs the state of the Go runtime every interval at
+// level lvl, to the filter with the given name or, if it is empty, to all
+// filters: the number of goroutines, the heap and memory obtained from the
+// system, and the number of GCs since the last report with their longest
+// pause.  The figures are attached as fields, giving basic observability
+// without a metrics stack.  Call the returned function to stop reporting.
+func (log *Logger) ReportRuntimeStats(interval time.Duration, lvl Level, filter string) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		var prev runtime.MemStats
+		runtime.ReadMemStats(&prev)
+		for {
+			select {
+			case <-ticker.C:
+				var ms runtime.MemStats
+				runtime.ReadMemStats(&ms)
+				log.reportRuntimeStats(lvl, filter, &ms, &prev)
+				prev = ms
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (log *Logger) reportRuntimeStats(lvl Level, filter string, ms, prev *runtime.MemStats) {
+	if log.skip(lvl) {
+		return
+	}
+
+	// The ring of recent pauses holds the latest at NumGC-1
+	gcs := ms.NumGC - prev.NumGC
+	var maxPause time.Duration
+	for i := uint32(0); i < gcs && i < uint32(len(ms.PauseNs)); i++ {
+		if p := time.Duration(ms.PauseNs[(ms.NumGC+255-i)%256]); p > maxPause {
+			maxPause = p
+		}
+	}
+
+	goroutines := runtime.NumGoroutine()
+	rec := &LogRecord{
+		Level:   lvl,
+		Created: clockNow(),
+		Source:  "runtime",
+		Message: fmt.Sprintf("runtime: %d goroutines, heap %.1fMB, sys %.1fMB, %d GCs, max pause %s",
+			goroutines, float64(ms.HeapAlloc)/(1<<20), float64(ms.Sys)/(1<<20), gcs, maxPause),
+		Fields: Fields{
+			"goroutines":     goroutines,
+			"heap_alloc":     ms.HeapAlloc,
+			"heap_objects":   ms.HeapObjects,
+			"sys":            ms.Sys,
+			"num_gc":         gcs,
+			"gc_pause_max":   maxPause,
+			"gc_pause_total": time.Duration(ms.PauseTotalNs),
+		},
+	}
+	if len(filter) > 0 {
+		log.dispatchTo(filter, rec)
+	} else {
+		log.dispatch(rec)
+	}
+}
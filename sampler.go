@@ -0,0 +1,87 @@
+package log4go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Samples records by level and format string (the message for records made
+// without one), so Infof("req %d", id) calls share a count: within each
+// second the first such records pass, after that only every thereafter-th
+// one does.
+type sampler struct {
+	mu         sync.Mutex
+	first      int
+	thereafter int
+	tick       int64
+	counts     map[string]int
+}
+
+func newSampler(first, thereafter int) *sampler {
+	return &sampler{
+		first:      first,
+		thereafter: thereafter,
+		counts:     make(map[string]int),
+	}
+}
+
+// Reports whether rec is sampled, that is, should be written
+func (s *sampler) sample(now time.Time, rec *LogRecord) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Counts only live for a second, which also bounds the map size
+	if tick := now.Unix(); tick != s.tick {
+		s.tick = tick
+		s.counts = make(map[string]int)
+	}
+
+	key := rec.format
+	if len(key) == 0 {
+		key = rec.Message
+	}
+	key = rec.Level.String() + key
+	n := s.counts[key] + 1
+	s.counts[key] = n
+
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
+
+// Sample records with the same level and format string (chainable): of each second's
+// records, the first are written, then only every thereafter-th.  A thereafter
+// of zero drops the rest; a first of zero or less turns sampling off.  Must be
+// called before the first log message is written.
+func (f *Filter) SetSampling(first, thereafter int) *Filter {
+	if first <= 0 {
+		f.sampler = nil
+	} else {
+		f.sampler = newSampler(first, thereafter)
+	}
+	return f
+}
+
+// Parse a "first[,thereafter]" sampling property
+func parseSampling(str string) (int, int, error) {
+	parts := strings.SplitN(str, ",", 2)
+	first, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	thereafter := 0
+	if len(parts) > 1 {
+		thereafter, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if first < 0 || thereafter < 0 {
+		return 0, 0, fmt.Errorf("negative sampling value")
+	}
+	return first, thereafter, nil
+}
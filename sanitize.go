@@ -0,0 +1,104 @@
+package log4go
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// How SanitizeMiddleware treats control characters
+type SanitizeMode int
+
+const (
+	// Replace control characters by escapes such as \n and \x1b
+	SanitizeEscape SanitizeMode = iota
+	// Drop control characters, turning line breaks into spaces
+	SanitizeStrip
+)
+
+// SanitizeMiddleware returns middleware defusing the control characters in
+// messages and string field values, so text taken from users cannot forge
+// records with line breaks or take over terminals with escape sequences.
+// Tabs are kept.  Install it where messages never span lines on purpose:
+//
+//	log.Use(log4go.SanitizeMiddleware(log4go.SanitizeEscape))
+func SanitizeMiddleware(mode SanitizeMode) Middleware {
+	return func(rec *LogRecord, next func(*LogRecord)) {
+		rec.Message = sanitize(mode, rec.Message)
+
+		// The fields may belong to the caller, so change a copy
+		var fields Fields
+		for k, v := range rec.Fields {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			clean := sanitize(mode, s)
+			if clean == s {
+				continue
+			}
+			if fields == nil {
+				fields = make(Fields, len(rec.Fields))
+				for k, v := range rec.Fields {
+					fields[k] = v
+				}
+			}
+			fields[k] = clean
+		}
+		if fields != nil {
+			rec.Fields = fields
+		}
+		next(rec)
+	}
+}
+
+// Parse a sanitize mode given as escape or strip
+func parseSanitizeMode(str string) (SanitizeMode, bool) {
+	switch strings.ToLower(str) {
+	case "escape":
+		return SanitizeEscape, true
+	case "strip":
+		return SanitizeStrip, true
+	}
+	return SanitizeEscape, false
+}
+
+func isControl(r rune) bool {
+	// Including the Unicode line and paragraph separators
+	return (r < ' ' && r != '\t') || r == 0x7f || (r >= 0x80 && r < 0xa0) ||
+		r == '\u2028' || r == '\u2029'
+}
+
+func sanitize(mode SanitizeMode, s string) string {
+	i := strings.IndexFunc(s, isControl)
+	if i < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+	for _, r := range s[i:] {
+		if !isControl(r) {
+			b.WriteRune(r)
+			continue
+		}
+		if mode == SanitizeStrip {
+			if r == '\n' || r == '\u2028' || r == '\u2029' {
+				b.WriteByte(' ')
+			}
+			continue
+		}
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < utf8.RuneSelf:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package log4go
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A ShutdownError lists the filters that had not finished writing out their
+// queues when the context given to Shutdown ended.
+type ShutdownError struct {
+	Filters []string // names of the filters still draining
+	Err     error    // the context's error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("log4go: shutdown: %v before filters drained: %s", e.Err, strings.Join(e.Filters, ", "))
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown flushes and closes all filters in parallel, like Close, but gives
+// up when ctx is done.  It then returns a *ShutdownError naming the filters
+// that were still draining; those go on closing in the background.  Shutdown
+// removes all filters from the logger either way.
+func (log *Logger) Shutdown(ctx context.Context) error {
+	var filters map[string]*Filter
+	log.update(false, func(st *loggerState) {
+		filters, st.filters = st.filters, nil
+	})
+
+	done := make(chan string, len(filters))
+	pending := make(map[string]bool, len(filters))
+	for name, filt := range filters {
+		pending[name] = true
+		go func(name string, filt *Filter) {
+			filt.Flush()
+			filt.Close()
+			done <- name
+		}(name, filt)
+	}
+
+	for len(pending) > 0 {
+		select {
+		case name := <-done:
+			delete(pending, name)
+		case <-ctx.Done():
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return &ShutdownError{Filters: names, Err: ctx.Err()}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package log4go
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Severities of the levels on the 0-10 scale of CEF and LEEF
+var siemSeverity = [...]int{DEBUG: 1, TRACE: 2, INFO: 3, WARNING: 6, ERROR: 8, CRITICAL: 10}
+
+func siemLevelSeverity(lvl Level) int {
+	if lvl < 0 || int(lvl) >= len(siemSeverity) {
+		return 5
+	}
+	return siemSeverity[lvl]
+}
+
+// CEFEncoder writes records in ArcSight Common Event Format.  The level
+// becomes the signature ID and severity, the message the name, and the
+// time, source and fields the extension.
+type CEFEncoder struct {
+	Vendor, Product, Version string
+}
+
+// This creates a new CEFEncoder describing the device as log4go.
+func NewCEFEncoder() *CEFEncoder {
+	return &CEFEncoder{Vendor: "log4go", Product: "log4go", Version: L4G_VERSION}
+}
+
+func (e *CEFEncoder) Encode(dst []byte, rec *LogRecord) []byte {
+	dst = append(dst, "CEF:0|"...)
+	for _, s := range [...]string{e.Vendor, e.Product, e.Version, rec.Level.String(), rec.Message} {
+		dst = appendSIEMHeader(dst, s)
+		dst = append(dst, '|')
+	}
+	dst = strconv.AppendInt(dst, int64(siemLevelSeverity(rec.Level)), 10)
+	dst = append(dst, "|rt="...)
+	dst = strconv.AppendInt(dst, rec.Created.UnixNano()/1e6, 10)
+	if len(rec.Source) > 0 {
+		dst = append(dst, " cs1Label=source cs1="...)
+		dst = appendCEFValue(dst, rec.Source)
+	}
+	for _, k := range sortedFieldKeys(rec.Fields) {
+		dst = append(dst, ' ')
+		dst = appendSIEMKey(dst, k)
+		dst = append(dst, '=')
+		dst = appendCEFValue(dst, string(appendValue(nil, rec.Fields[k])))
+	}
+	return append(dst, '\n')
+}
+
+// LEEFEncoder writes records in IBM QRadar Log Event Extended Format 1.0.
+// The level becomes the event ID and sev, and the time, message, source and
+// fields tab separated attributes.
+type LEEFEncoder struct {
+	Vendor, Product, Version string
+}
+
+// This creates a new LEEFEncoder describing the device as log4go.
+func NewLEEFEncoder() *LEEFEncoder {
+	return &LEEFEncoder{Vendor: "log4go", Product: "log4go", Version: L4G_VERSION}
+}
+
+func (e *LEEFEncoder) Encode(dst []byte, rec *LogRecord) []byte {
+	dst = append(dst, "LEEF:1.0|"...)
+	for _, s := range [...]string{e.Vendor, e.Product, e.Version, rec.Level.String()} {
+		dst = appendSIEMHeader(dst, s)
+		dst = append(dst, '|')
+	}
+	dst = append(dst, "devTime="...)
+	dst = strconv.AppendInt(dst, rec.Created.UnixNano()/1e6, 10)
+	dst = append(dst, "\tdevTimeFormat=epoch\tsev="...)
+	dst = strconv.AppendInt(dst, int64(siemLevelSeverity(rec.Level)), 10)
+	dst = append(dst, "\tmsg="...)
+	dst = appendLEEFValue(dst, rec.Message)
+	if len(rec.Source) > 0 {
+		dst = append(dst, "\tsource="...)
+		dst = appendLEEFValue(dst, rec.Source)
+	}
+	for _, k := range sortedFieldKeys(rec.Fields) {
+		dst = append(dst, '\t')
+		dst = appendSIEMKey(dst, k)
+		dst = append(dst, '=')
+		dst = appendLEEFValue(dst, string(appendValue(nil, rec.Fields[k])))
+	}
+	return append(dst, '\n')
+}
+
+func sortedFieldKeys(fields Fields) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Header fields escape backslashes and pipes and may not span lines
+func appendSIEMHeader(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '|':
+			dst = append(dst, '\\', c)
+		case '\r', '\n':
+			dst = append(dst, ' ')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// Keys are limited to letters, digits and underscores
+func appendSIEMKey(dst []byte, k string) []byte {
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' {
+			dst = append(dst, c)
+		} else {
+			dst = append(dst, '_')
+		}
+	}
+	return dst
+}
+
+// CEF extension values escape backslashes, equal signs and line breaks
+func appendCEFValue(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '=':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// LEEF attribute values may not contain the tab delimiter or line breaks
+func appendLEEFValue(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\t', '\r', '\n':
+			dst = append(dst, ' ')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,49 @@
+package log4go
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// FlushOnSignal closes log, writing out everything buffered, when the process
+// gets one of sigs (SIGINT and SIGTERM if none are given), and then lets the
+// signal take its default course.  Without this, a FileLogWriter loses up to
+// its buffer size on such an exit.  Programs handling these signals
+// themselves should call Close or Shutdown from their own handler instead.
+// Call the returned function to stop watching.
+func FlushOnSignal(log *Logger, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			log.Close()
+			signal.Reset(sig)
+			if p, err := os.FindProcess(os.Getpid()); err != nil || p.Signal(sig) != nil {
+				os.Exit(1)
+			}
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Exit closes the default logger and those GetLogger created, writing out
+// everything buffered, and then exits the program with code.  Use it instead of os.Exit, which runs no
+// deferred calls or finalizers.  Go does not run finalizers when a program
+// ends either, so the writers do not rely on one to write out their buffers.
+func Exit(code int) {
+	log.Close()
+	closeNamedLoggers()
+	os.Exit(code)
+}
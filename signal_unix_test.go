@@ -0,0 +1,56 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package log4go
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// SIGWINCH is ignored by default, so FlushOnSignal passing it on does not
+// end the test
+func TestFlushOnSignal(t *testing.T) {
+	closed := func(mem *memLogWriter) int {
+		mem.mu.Lock()
+		defer mem.mu.Unlock()
+		return mem.closed
+	}
+	seen := make(chan os.Signal, 1)
+	signal.Notify(seen, syscall.SIGWINCH)
+	defer signal.Stop(seen)
+
+	// Stopped before any signal: the logger is left alone
+	mem := new(memLogWriter)
+	l := NewLogger().SetFilter("mem", NewFilter(INFO, mem))
+	defer l.Close()
+	stop := FlushOnSignal(l, syscall.SIGWINCH)
+	stop()
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	select {
+	case <-seen:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("FlushOnSignal: signal not delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if closed(mem) != 0 || l.Filter("mem") == nil {
+		t.Fatalf("FlushOnSignal: logger closed after stop")
+	}
+
+	// The signal closes the logger, writing out its records
+	stop = FlushOnSignal(l, syscall.SIGWINCH)
+	defer stop()
+	l.Info("buffered")
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	for deadline := time.Now().Add(5 * time.Second); closed(mem) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("FlushOnSignal: logger not closed on the signal")
+		}
+	}
+	if mem.Len() != 1 || l.Filter("mem") != nil {
+		t.Errorf("FlushOnSignal: %d records written, filters %v", mem.Len(), l.Filters())
+	}
+}
@@ -1,17 +1,53 @@
 package log4go
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
-	"os"
+	"strconv"
+	"strings"
 )
 
+// How records are delimited on stream sockets
+type Framing int
+
+const (
+	FramingNone    Framing = iota // records back to back, as encoded
+	FramingNewline                // each record ends with a newline
+	FramingLength                 // each record follows its length as 4 byte big endian
+	FramingOctet                  // RFC 6587 octet counting: "LEN " then the record
+)
+
+var framingStrings = [...]string{"none", "newline", "length", "octet"}
+
+func (f Framing) String() string {
+	if f < 0 || int(f) >= len(framingStrings) {
+		return "unknown"
+	}
+	return framingStrings[f]
+}
+
+// Parse a framing name as used in configuration files
+func parseFraming(str string) (Framing, bool) {
+	for i, s := range framingStrings {
+		if s == str {
+			return Framing(i), true
+		}
+	}
+	return FramingNone, false
+}
+
 // This log writer sends output to a socket
 type SocketLogWriter struct {
 	sock     net.Conn
 	proto    string
 	hostport string
+	encoder  Encoder     // used instead of plain JSON if set
+	tls      *tls.Config // connect with TLS if set
+	framing  Framing
 }
 
 func (w *SocketLogWriter) Close() {
@@ -32,33 +68,163 @@ func NewSocketLogWriter(proto, hostport string) *SocketLogWriter {
 	return s
 }
 
+// Set an encoder to use instead of plain JSON (chainable), e.g. a
+// ProtobufEncoder.  Must be called before the first log message is written.
+func (s *SocketLogWriter) SetEncoder(enc Encoder) *SocketLogWriter {
+	s.encoder = enc
+	return s
+}
+
+// Connect with TLS using cfg (chainable); only for the tcp protocols.  Must be
+// called before the first log message is written.
+func (s *SocketLogWriter) SetTLS(cfg *tls.Config) *SocketLogWriter {
+	s.tls = cfg
+	return s
+}
+
+// Build a TLS configuration trusting the CA certificates in the PEM file ca
+// (the system roots if empty) and presenting the client certificate in the
+// PEM files cert and key for mutual TLS, if given.
+func LoadTLSConfig(ca, cert, key string) (*tls.Config, error) {
+	cfg := new(tls.Config)
+	if len(ca) > 0 {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", ca)
+		}
+	}
+	if len(cert) > 0 || len(key) > 0 {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+// Set how records are delimited on stream sockets (chainable); datagrams
+// always carry one record each and are not framed.  Must be called before
+// the first log message is written.
+func (s *SocketLogWriter) SetFraming(framing Framing) *SocketLogWriter {
+	s.framing = framing
+	return s
+}
+
+func (s *SocketLogWriter) datagram() bool {
+	return strings.HasPrefix(s.proto, "udp") || s.proto == "unixgram"
+}
+
+// Encode and frame a record for the wire
+func (s *SocketLogWriter) encode(dst []byte, rec *LogRecord) ([]byte, error) {
+	start := len(dst)
+	if s.encoder != nil {
+		dst = s.encoder.Encode(dst, rec)
+	} else {
+		js, err := json.Marshal(rec)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, js...)
+	}
+	if s.framing == FramingNone || s.datagram() {
+		return dst, nil
+	}
+	return frameRecord(dst, start, s.framing), nil
+}
+
+// Frame the record in dst[start:]
+func frameRecord(dst []byte, start int, framing Framing) []byte {
+	size := len(dst) - start
+	var prefix []byte
+	switch framing {
+	case FramingNewline:
+		if size == 0 || dst[len(dst)-1] != '\n' {
+			dst = append(dst, '\n')
+		}
+		return dst
+	case FramingLength:
+		prefix = appendBigEndian32(nil, uint32(size))
+	case FramingOctet:
+		prefix = append(strconv.AppendInt(nil, int64(size), 10), ' ')
+	default:
+		return dst
+	}
+
+	dst = append(dst, prefix...)
+	copy(dst[start+len(prefix):], dst[start:start+size])
+	copy(dst[start:], prefix)
+	return dst
+}
+
 func (s *SocketLogWriter) LogWrite(rec *LogRecord) {
+	if err := s.LogWriteErr(rec); err != nil {
+		reportError("SocketLogWriter("+s.hostport+")", err)
+	}
+}
 
-	// Marshall into JSON
-	js, err := json.Marshal(rec)
+func (s *SocketLogWriter) LogWriteErr(rec *LogRecord) error {
+	data, err := s.encode(nil, rec)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "SocketLogWriter(%s): %v\n", s.hostport, err)
+		return err
+	}
+
+	return s.send(data)
+}
+
+// Stream sockets get all the records in a single write; datagram sockets
+// still need one packet per record.
+func (s *SocketLogWriter) BulkLogWrite(recs []*LogRecord) {
+	if s.datagram() {
+		for _, rec := range recs {
+			s.LogWrite(rec)
+		}
 		return
 	}
 
+	var buf []byte
+	for _, rec := range recs {
+		var err error
+		if buf, err = s.encode(buf, rec); err != nil {
+			reportError("SocketLogWriter("+s.hostport+")", err)
+		}
+	}
+	if err := s.send(buf); err != nil {
+		reportError("SocketLogWriter("+s.hostport+")", err)
+	}
+}
+
+// Write data to the socket, connecting first if needed
+func (s *SocketLogWriter) send(data []byte) error {
+	var err error
 	if s.sock == nil {
-		s.sock, err = net.Dial(s.proto, s.hostport)
+		if s.tls != nil {
+			var conn *tls.Conn
+			if conn, err = tls.Dial(s.proto, s.hostport, s.tls); err == nil {
+				s.sock = conn
+			}
+		} else {
+			s.sock, err = net.Dial(s.proto, s.hostport)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "SocketLogWriter(%s): %v\n", s.hostport, err)
 			if s.sock != nil {
 				s.sock.Close()
 				s.sock = nil
 			}
-			return
+			return err
 		}
 	}
 
-	_, err = s.sock.Write(js)
+	_, err = s.sock.Write(data)
 	if err == nil {
-		return
+		return nil
 	}
 
-	fmt.Fprintf(os.Stderr, "SocketLogWriter(%s): %v\n", s.hostport, err)
 	s.sock.Close()
 	s.sock = nil
+	return err
 }
@@ -0,0 +1,158 @@
+package log4go
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A level override for records whose source matches pattern
+type sourceLevel struct {
+	pattern string
+	lvl     Level
+}
+
+// The override rules of a Filter, replaced as a whole on every change so
+// dispatch can read them without locking
+type sourceLevels struct {
+	rules []sourceLevel // longest pattern first, "*" last
+	min   Level         // lowest level of any rule
+}
+
+var sourceLevelsMu sync.Mutex // serializes rule updates
+
+// Set the level for records whose source is in pattern, e.g.
+// "github.com/acme/db" or "*" for everything not matched otherwise.  The
+// longest matching pattern wins over the filter level.  Safe to call while
+// logging.
+func (f *Filter) SetSourceLevel(pattern string, lvl Level) *Filter {
+	pattern = strings.TrimSuffix(pattern, "/*")
+
+	sourceLevelsMu.Lock()
+	defer sourceLevelsMu.Unlock()
+
+	var rules []sourceLevel
+	if cur := f.loadSourceLevels(); cur != nil {
+		for _, r := range cur.rules {
+			if r.pattern != pattern {
+				rules = append(rules, r)
+			}
+		}
+	}
+	rules = append(rules, sourceLevel{pattern, lvl})
+	f.storeSourceLevels(rules)
+	return f
+}
+
+// Remove all source level rules (chainable)
+func (f *Filter) ClearSourceLevels() *Filter {
+	sourceLevelsMu.Lock()
+	defer sourceLevelsMu.Unlock()
+	f.storeSourceLevels(nil)
+	return f
+}
+
+// Set rules from a spec like "github.com/acme/db=DEBUG,*=INFO"
+func (f *Filter) SetSourceLevels(spec string) error {
+	rules, err := parseSourceLevels(spec)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		f.SetSourceLevel(r.pattern, r.lvl)
+	}
+	return nil
+}
+
+func parseSourceLevels(spec string) ([]sourceLevel, error) {
+	var rules []sourceLevel
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		eq := strings.LastIndex(item, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("source level %q is not pattern=LEVEL", item)
+		}
+		lvl, ok := ParseLevel(strings.TrimSpace(item[eq+1:]))
+		if !ok {
+			return nil, fmt.Errorf("source level %q has unknown level", item)
+		}
+		rules = append(rules, sourceLevel{strings.TrimSpace(item[:eq]), lvl})
+	}
+	return rules, nil
+}
+
+func (f *Filter) loadSourceLevels() *sourceLevels {
+	sl, _ := f.srcLevels.Load().(*sourceLevels)
+	return sl
+}
+
+// Must hold sourceLevelsMu
+func (f *Filter) storeSourceLevels(rules []sourceLevel) {
+	sl := &sourceLevels{min: CRITICAL}
+	for i, r := range rules {
+		// insertion sort: longest first, "*" always last
+		for j := i; j > 0 && sourceLevelLess(r, rules[j-1]); j-- {
+			rules[j], rules[j-1] = rules[j-1], rules[j]
+		}
+		if r.lvl < sl.min {
+			sl.min = r.lvl
+		}
+	}
+	sl.rules = rules
+	f.srcLevels.Store(sl)
+}
+
+func sourceLevelLess(a, b sourceLevel) bool {
+	if b.pattern == "*" {
+		return a.pattern != "*"
+	}
+	return a.pattern != "*" && len(a.pattern) > len(b.pattern)
+}
+
+// The level a record from source must have to be written by f
+func (f *Filter) levelFor(source string) Level {
+	sl := f.loadSourceLevels()
+	if sl == nil {
+		return f.Level
+	}
+	for _, r := range sl.rules {
+		if r.pattern == "*" || sourceMatches(r.pattern, source) {
+			return r.lvl
+		}
+	}
+	return f.Level
+}
+
+// The lowest level that f may write
+func (f *Filter) minLevel() Level {
+	if sl := f.loadSourceLevels(); sl != nil && len(sl.rules) > 0 && sl.min < f.Level {
+		return sl.min
+	}
+	return f.Level
+}
+
+// Reports whether pattern occurs in source as whole path elements
+func sourceMatches(pattern, source string) bool {
+	for off := 0; ; {
+		i := strings.Index(source[off:], pattern)
+		if i < 0 {
+			return false
+		}
+		start, end := off+i, off+i+len(pattern)
+		if (start == 0 || source[start-1] == '/') &&
+			(end == len(source) || strings.IndexByte("/@ :", source[end]) >= 0) {
+			return true
+		}
+		off = start + 1
+	}
+}
+
+// Set a source level rule on every filter of the logger
+func (log *Logger) SetSourceLevel(pattern string, lvl Level) {
+	for _, filt := range log.load().filters {
+		filt.SetSourceLevel(pattern, lvl)
+	}
+}
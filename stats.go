@@ -0,0 +1,88 @@
+package log4go
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// FilterStats counts what happened to the records given to a filter.
+type FilterStats struct {
+	Enqueued   uint64 // records put on the queue
+	Written    uint64 // records handed to the writer
+	Dropped    uint64 // records discarded by the overflow policy
+	Suppressed uint64 // records held back by sampling or rate limits
+	QueueDepth int    // records waiting in the queue now
+	QueueSize  int    // capacity of the queue
+}
+
+func (s *FilterStats) add(o FilterStats) {
+	s.Enqueued += o.Enqueued
+	s.Written += o.Written
+	s.Dropped += o.Dropped
+	s.Suppressed += o.Suppressed
+	s.QueueDepth += o.QueueDepth
+	s.QueueSize += o.QueueSize
+}
+
+// Stats returns the filter's counters.
+func (f *Filter) Stats() FilterStats {
+	return FilterStats{
+		Enqueued:   atomic.LoadUint64(&f.enqueued),
+		Written:    atomic.LoadUint64(&f.written),
+		Dropped:    atomic.LoadUint64(&f.dropped),
+		Suppressed: atomic.LoadUint64(&f.suppressed),
+		QueueDepth: len(f.rec),
+		QueueSize:  cap(f.rec),
+	}
+}
+
+// Stats returns the counters of all filters added up.
+func (log *Logger) Stats() FilterStats {
+	var total FilterStats
+	for _, filt := range log.load().filters {
+		total.add(filt.Stats())
+	}
+	return total
+}
+
+// FilterStats returns the counters of each filter by name.
+func (log *Logger) FilterStats() map[string]FilterStats {
+	filters := log.load().filters
+	stats := make(map[string]FilterStats, len(filters))
+	for name, filt := range filters {
+		stats[name] = filt.Stats()
+	}
+	return stats
+}
+
+// FilterInfo describes a filter of a Logger, as Filters lists them.
+type FilterInfo struct {
+	Name     string
+	Level    Level  // for records without a source level rule
+	Writer   string // Go type of the writer, e.g. *log4go.FileLogWriter
+	Disabled bool   // see DisableFilter
+	Sync     bool   // see Filter.SetSync
+	Fallback bool   // see Filter.SetFallback
+	Stats    FilterStats
+}
+
+// Filters describes each filter, ordered by name, for diagnostics.  Filter
+// returns a filter itself.
+func (log *Logger) Filters() []FilterInfo {
+	filters := log.load().filters
+	infos := make([]FilterInfo, 0, len(filters))
+	for name, filt := range filters {
+		infos = append(infos, FilterInfo{
+			Name:     name,
+			Level:    filt.levelFor(""),
+			Writer:   fmt.Sprintf("%T", filt.LogWriter),
+			Disabled: filt.Disabled(),
+			Sync:     atomic.LoadInt32(&filt.sync) != 0,
+			Fallback: filt.isFallback(),
+			Stats:    filt.Stats(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
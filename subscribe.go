@@ -0,0 +1,60 @@
+package log4go
+
+import (
+	"sync"
+)
+
+// Records buffered per subscriber of Logger.Subscribe
+const SUBSCRIBE_BUFFER = 256
+
+// A subscriber of Logger.Subscribe, which the logger's BroadcastLogWriter
+// hands the records
+type subscription struct {
+	lvl Level
+}
+
+// Subscribe returns a channel getting the records at lvl or above the logger
+// dispatches from now on, after redaction, and a function ending the
+// subscription, so other parts of a program, such as a UI or a test, can
+// watch the records without a writer of their own.  A subscriber that falls
+// more than SUBSCRIBE_BUFFER records behind misses records rather than
+// holding up logging; SubscribersDropped counts them.  The records are
+// shared and must not be changed.  The channel is closed when the
+// subscription ends.
+func (log *Logger) Subscribe(lvl Level) (<-chan *LogRecord, func()) {
+	sub := &subscription{lvl: lvl}
+	var ch <-chan *LogRecord
+	var cancel func()
+	log.update(false, func(st *loggerState) {
+		if st.broadcast == nil {
+			st.broadcast = NewBroadcastLogWriter()
+		}
+		ch, cancel = st.broadcast.subscribe(SUBSCRIBE_BUFFER, lvl)
+		st.subs = append(st.subs[:len(st.subs):len(st.subs)], sub)
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			log.update(false, func(st *loggerState) {
+				subs := make([]*subscription, 0, len(st.subs))
+				for _, s := range st.subs {
+					if s != sub {
+						subs = append(subs, s)
+					}
+				}
+				st.subs = subs
+			})
+			cancel()
+		})
+	}
+}
+
+// SubscribersDropped returns how many records the subscribers of Subscribe
+// missed by falling behind.
+func (log *Logger) SubscribersDropped() uint64 {
+	if st := log.load(); st.broadcast != nil {
+		return st.broadcast.Dropped()
+	}
+	return 0
+}
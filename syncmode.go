@@ -0,0 +1,51 @@
+package log4go
+
+import (
+	"sync/atomic"
+)
+
+// Write records to the writer in the logging call instead of queueing them
+// for the filter's goroutine (chainable), so that short-lived command line
+// tools and tests have their output complete without Flush or Close.  Calls
+// from several goroutines take turns; the overflow policy does not apply.
+func (f *Filter) SetSync(sync bool) *Filter {
+	if !sync {
+		atomic.StoreInt32(&f.sync, 0)
+		return f
+	}
+	// Queued records go first
+	f.Flush()
+	atomic.StoreInt32(&f.sync, 1)
+	return f
+}
+
+// Sync reports whether the filter writes records in the logging call.
+func (f *Filter) Sync() bool {
+	return atomic.LoadInt32(&f.sync) != 0
+}
+
+// Write rec right away
+func (f *Filter) writeSync(rec *LogRecord) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	if atomic.LoadInt32(&f.closing) != 0 {
+		return
+	}
+	atomic.AddUint64(&f.enqueued, 1)
+	f.write(rec)
+}
+
+// SetSync makes every filter of the logger, including those added later,
+// write records in the logging call, or, if sync is false, go back to
+// queueing them (chainable).  See Filter.SetSync.
+func (log *Logger) SetSync(sync bool) *Logger {
+	var filters map[string]*Filter
+	log.update(false, func(st *loggerState) {
+		st.sync = sync
+		filters = st.filters
+	})
+	for _, filt := range filters {
+		filt.SetSync(sync)
+	}
+	return log
+}
@@ -0,0 +1,75 @@
+package log4go
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Records buffered per TailHandler client
+const TAIL_BUFFER = 256
+
+// TailHandler returns an http.Handler streaming the records written to hub
+// while the client stays connected, as Server-Sent Events if the client
+// accepts text/event-stream or asks for format=sse, and as newline
+// delimited JSON otherwise.  The query parameter level (e.g. warn) drops
+// records below that level:
+//
+//	curl 'http://localhost:8080/debug/logs?level=warn'
+func TailHandler(hub *BroadcastLogWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lvl := DEBUG
+		if s := r.FormValue("level"); len(s) > 0 {
+			var ok bool
+			if lvl, ok = ParseLevel(s); !ok {
+				http.Error(w, "unknown level "+s, http.StatusBadRequest)
+				return
+			}
+		}
+		flusher, _ := w.(http.Flusher)
+		sse := r.FormValue("format") == "sse" ||
+			strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+		recs, cancel := hub.Subscribe(TAIL_BUFFER)
+		defer cancel()
+
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.WriteHeader(http.StatusOK)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		for {
+			select {
+			case rec, ok := <-recs:
+				if !ok {
+					return
+				}
+				if rec.Level < lvl {
+					continue
+				}
+				js, err := json.Marshal(rec)
+				if err != nil {
+					continue
+				}
+				if sse {
+					w.Write([]byte("data: "))
+					w.Write(js)
+					w.Write([]byte("\n\n"))
+				} else {
+					w.Write(append(js, '\n'))
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
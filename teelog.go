@@ -0,0 +1,63 @@
+package log4go
+
+import (
+	"fmt"
+)
+
+// This log writer fans every record out to several child writers, so a single
+// filter (and a single runtime.Caller lookup) can feed file and socket at once.
+type TeeLogWriter struct {
+	writers []LogWriter
+}
+
+// This creates a new TeeLogWriter writing to each of the given writers
+func NewTeeLogWriter(writers ...LogWriter) *TeeLogWriter {
+	t := &TeeLogWriter{}
+	for _, w := range writers {
+		t.Add(w)
+	}
+	return t
+}
+
+// Add another child writer (chainable).  Must be called before the first log
+// message is written.
+func (t *TeeLogWriter) Add(w LogWriter) *TeeLogWriter {
+	if w != nil {
+		t.writers = append(t.writers, w)
+	}
+	return t
+}
+
+// Writers returns the child writers in the order they were added.
+func (t *TeeLogWriter) Writers() []LogWriter {
+	return t.writers
+}
+
+func (t *TeeLogWriter) LogWrite(rec *LogRecord) {
+	for _, w := range t.writers {
+		w.LogWrite(rec)
+	}
+}
+
+// Close closes every child, even if an earlier one panics.
+func (t *TeeLogWriter) Close() {
+	for _, w := range t.writers {
+		teeCall(w.Close)
+	}
+}
+
+// Flush flushes every child, even if an earlier one panics.
+func (t *TeeLogWriter) Flush() {
+	for _, w := range t.writers {
+		teeCall(w.Flush)
+	}
+}
+
+func teeCall(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportError("TeeLogWriter", fmt.Errorf("panic: %v", r))
+		}
+	}()
+	f()
+}
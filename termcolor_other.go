@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package log4go
+
+// Terminals interpret ANSI escape sequences by themselves
+func enableTerminalColors() {
+}
@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package log4go
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleMode = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+
+	terminalColorsOnce sync.Once
+)
+
+// Have the Windows console interpret the ANSI escape sequences of colored
+// records (Windows 10 and later)
+func enableTerminalColors() {
+	terminalColorsOnce.Do(func() {
+		for _, std := range []int{syscall.STD_OUTPUT_HANDLE, syscall.STD_ERROR_HANDLE} {
+			h, err := syscall.GetStdHandle(std)
+			if err != nil {
+				continue
+			}
+			var mode uint32
+			if r, _, _ := procGetConsoleMode.Call(uintptr(h), uintptr(unsafe.Pointer(&mode))); r == 0 {
+				continue
+			}
+			procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+		}
+	})
+}
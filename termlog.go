@@ -6,63 +6,64 @@ import (
 	"os"
 	"sync"
 
-	"github.com/daviddengcn/go-colortext"
+	"golang.org/x/text/encoding"
 )
 
 var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
 
 type RecInfo struct {
 	isQuit bool
 	level  Level
+	ack    chan struct{} // closed once everything before it is written
 
 	data string
 }
 
 // This is the standard writer that prints to standard output.
 type ConsoleLogWriter struct {
-	iow    io.Writer
-	color  bool
-	format string
-	wg     sync.WaitGroup
-	rec    chan *RecInfo // write queue
+	iow      io.Writer
+	errw     io.Writer // gets the records from errLevel up, if set
+	errLevel Level
+	color    bool
+	theme    Theme
+	format   string
+	formats  levelFormats      // overrides format by level
+	encoder  Encoder           // used instead of format if set
+	charset  encoding.Encoding // converts records from UTF-8 if set
+	indent   string            // starts the continuation lines of records
+	wg       sync.WaitGroup
+	rec      chan *RecInfo // write queue
 }
 
 // This creates a new ConsoleLogWriter
 func NewConsoleLogWriter() *ConsoleLogWriter {
 	c := &ConsoleLogWriter{
 		iow:    stdout,
-		color:  false,
+		color:  colorFromEnv(false),
+		theme:  DefaultTheme(),
 		format: "[%T %D] [%L] (%S) %M",
 		rec:    make(chan *RecInfo, 256),
 	}
+	if c.color {
+		enableTerminalColors()
+	}
+	c.wg.Add(1)
 	go func() {
-		c.wg.Add(1)
 	LOOP:
 		for {
 			select {
 			case rec := <-c.rec:
+				if rec.ack != nil {
+					close(rec.ack)
+					continue
+				}
 				if rec.isQuit == true {
 					c.wg.Done()
 					break LOOP
 				}
-				if c.color {
-					switch rec.level {
-					case CRITICAL:
-						ct.ChangeColor(ct.Red, true, ct.White, false)
-					case ERROR:
-						ct.ChangeColor(ct.Red, false, 0, false)
-					case WARNING:
-						ct.ChangeColor(ct.Yellow, false, 0, false)
-					case INFO:
-						ct.ChangeColor(ct.Green, false, 0, false)
-					case DEBUG:
-						ct.ChangeColor(ct.Magenta, false, 0, false)
-					case TRACE:
-						ct.ChangeColor(ct.Cyan, false, 0, false)
-					default:
-					}
-					fmt.Fprint(c.iow, rec.data)
-					ct.ResetColor()
+				if c.errw != nil && rec.level >= c.errLevel {
+					fmt.Fprint(c.errw, rec.data)
 				} else {
 					fmt.Fprint(c.iow, rec.data)
 				}
@@ -72,9 +73,47 @@ func NewConsoleLogWriter() *ConsoleLogWriter {
 	return c
 }
 
-// Must be called before the first log message is written.
+// Start the continuation lines of multi-line records with indent
+// (chainable), as FileLogWriter.SetIndent does.  Must be called before the
+// first log message is written.
+func (c *ConsoleLogWriter) SetIndent(indent string) *ConsoleLogWriter {
+	c.indent = indent
+	return c
+}
+
+// Set an encoder to use instead of the format (chainable), e.g. JSONEncoder
+// for one JSON object per line where a container runtime collects standard
+// output.  Encoded records are never colored.  Must be called before the
+// first log message is written.
+func (c *ConsoleLogWriter) SetEncoder(enc Encoder) *ConsoleLogWriter {
+	c.encoder = enc
+	return c
+}
+
+// Color records by level (chainable), unless the environment variable
+// NO_COLOR is set.  CLICOLOR_FORCE turns colors on even without this.  Must
+// be called before the first log message is written.
 func (c *ConsoleLogWriter) SetColor(color bool) *ConsoleLogWriter {
-	c.color = color
+	c.color = colorFromEnv(color)
+	if c.color {
+		enableTerminalColors()
+	}
+	return c
+}
+
+// Write the records at lvl and above to standard error instead of standard
+// output (chainable), e.g. from WARNING up.  Must be called before the first
+// log message is written.
+func (c *ConsoleLogWriter) SetStderrLevel(lvl Level) *ConsoleLogWriter {
+	c.errw = stderr
+	c.errLevel = lvl
+	return c
+}
+
+// Use theme's styles instead of DefaultTheme() for colored records
+// (chainable).  Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetTheme(theme Theme) *ConsoleLogWriter {
+	c.theme = theme
 	return c
 }
 
@@ -85,15 +124,38 @@ func (c *ConsoleLogWriter) SetFormat(format string) *ConsoleLogWriter {
 	return c
 }
 
+// Use format instead of the writer's format for records at lvl (chainable).
+// Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetLevelFormat(lvl Level, format string) *ConsoleLogWriter {
+	if c.formats == nil {
+		c.formats = make(levelFormats)
+	}
+	c.formats[lvl] = format
+	return c
+}
+
 func (c *ConsoleLogWriter) Close() {
 	c.rec <- &RecInfo{isQuit: true}
 	c.wg.Wait()
 }
 
+// Flush returns once everything written before has been printed.
 func (c *ConsoleLogWriter) Flush() {
+	ack := make(chan struct{})
+	c.rec <- &RecInfo{ack: ack}
+	<-ack
 }
 
 func (c *ConsoleLogWriter) LogWrite(rec *LogRecord) {
-	c.rec <- &RecInfo{data: FormatLogRecord(c.format, rec), level: rec.Level}
+	data := encodeRecord(c.encoder, c.formats.get(c.format, rec.Level), rec)
+	if c.encoder == nil {
+		data = indentLines(data, c.indent)
+	}
+	data = transcode(c.charset, data)
+	if style, ok := c.theme[rec.Level]; ok && c.color && c.encoder == nil {
+		// Each line colored on its own, in one string, so the colors cannot
+		// bleed into other output
+		data = style.color(data)
+	}
+	c.rec <- &RecInfo{data: data, level: rec.Level}
 }
-
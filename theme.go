@@ -0,0 +1,186 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A terminal color, written as an ANSI escape sequence: one of the eight
+// basic ones, one of the 256 of the xterm palette (Color256) or any RGB
+// value (ColorRGB), the latter two for terminals supporting them.  The zero
+// value leaves the color unchanged.
+type Color uint32
+
+const (
+	ColorNone Color = iota
+	ColorBlack
+	ColorRed
+	ColorGreen
+	ColorYellow
+	ColorBlue
+	ColorMagenta
+	ColorCyan
+	ColorWhite
+)
+
+const (
+	color256Flag = 1 << 24
+	colorRGBFlag = 2 << 24
+)
+
+// Color256 returns color n of the xterm 256 color palette.
+func Color256(n uint8) Color {
+	return Color(color256Flag | uint32(n))
+}
+
+// ColorRGB returns a 24 bit color.
+func ColorRGB(r, g, b uint8) Color {
+	return Color(colorRGBFlag | uint32(r)<<16 | uint32(g)<<8 | uint32(b))
+}
+
+// Append the SGR parameters selecting c; base is 30 for the foreground and
+// 40 for the background
+func (c Color) appendSGR(dst []byte, base int) []byte {
+	switch {
+	case c == ColorNone:
+		return dst
+	case c <= ColorWhite:
+		dst = append(dst, ';')
+		return strconv.AppendInt(dst, int64(base)+int64(c-ColorBlack), 10)
+	case c&colorRGBFlag != 0:
+		dst = append(dst, ';')
+		dst = strconv.AppendInt(dst, int64(base)+8, 10)
+		dst = append(dst, ";2;"...)
+		dst = strconv.AppendUint(dst, uint64(c>>16&0xff), 10)
+		dst = append(dst, ';')
+		dst = strconv.AppendUint(dst, uint64(c>>8&0xff), 10)
+		dst = append(dst, ';')
+		return strconv.AppendUint(dst, uint64(c&0xff), 10)
+	}
+	dst = append(dst, ';')
+	dst = strconv.AppendInt(dst, int64(base)+8, 10)
+	dst = append(dst, ";5;"...)
+	return strconv.AppendUint(dst, uint64(c&0xff), 10)
+}
+
+// How the records of one level are shown
+type Style struct {
+	Fg, Bg Color
+	Bold   bool
+}
+
+// The ANSI escape sequence selecting s
+func (s Style) escape() string {
+	b := []byte("\x1b[0")
+	b = s.Fg.appendSGR(b, 30)
+	b = s.Bg.appendSGR(b, 40)
+	if s.Bold {
+		b = append(b, ";1"...)
+	}
+	return string(append(b, 'm'))
+}
+
+// The ANSI escape sequence turning colors off
+const colorReset = "\x1b[0m"
+
+// Color each line of data with s, turning the color off again before its
+// newline, so a line never leaves the terminal colored for whatever is
+// written after it
+func (s Style) color(data string) string {
+	esc := s.escape()
+	var b strings.Builder
+	for len(data) > 0 {
+		line, rest := data, ""
+		if i := strings.IndexByte(data, '\n'); i >= 0 {
+			line, rest = data[:i], data[i:]
+		}
+		if len(line) > 0 {
+			b.WriteString(esc + line + colorReset)
+		}
+		if len(rest) == 0 {
+			break
+		}
+		b.WriteByte('\n')
+		data = rest[1:]
+	}
+	return b.String()
+}
+
+// The styles of a ConsoleLogWriter by level.  Levels without one are not
+// colored.
+type Theme map[Level]Style
+
+// DefaultTheme returns the colors ConsoleLogWriter uses unless given a
+// Theme.
+func DefaultTheme() Theme {
+	return Theme{
+		CRITICAL: {Fg: ColorRed, Bg: ColorWhite, Bold: true},
+		ERROR:    {Fg: ColorRed},
+		WARNING:  {Fg: ColorYellow},
+		INFO:     {Fg: ColorGreen},
+		DEBUG:    {Fg: ColorMagenta},
+		TRACE:    {Fg: ColorCyan},
+	}
+}
+
+// Parse a style given as "fg[/bg][,bold]", where each color is a name such
+// as red, a palette number from 0 to 255 or #rrggbb, e.g. "#ff8800/236,bold"
+func parseStyle(spec string) (Style, error) {
+	var s Style
+	parts := strings.Split(spec, ",")
+	for _, flag := range parts[1:] {
+		switch strings.TrimSpace(flag) {
+		case "bold":
+			s.Bold = true
+		default:
+			return s, fmt.Errorf("unknown style flag %q", flag)
+		}
+	}
+
+	colors := strings.SplitN(parts[0], "/", 2)
+	var err error
+	if s.Fg, err = parseColor(colors[0]); err != nil {
+		return s, err
+	}
+	if len(colors) == 2 {
+		if s.Bg, err = parseColor(colors[1]); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+var colorNames = []string{"", "black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+func parseColor(str string) (Color, error) {
+	str = strings.ToLower(strings.TrimSpace(str))
+	for i, name := range colorNames {
+		if name == str {
+			return Color(i), nil
+		}
+	}
+	if strings.HasPrefix(str, "#") && len(str) == 7 {
+		if rgb, err := strconv.ParseUint(str[1:], 16, 32); err == nil {
+			return ColorRGB(uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)), nil
+		}
+	}
+	if n, err := strconv.ParseUint(str, 10, 8); err == nil {
+		return Color256(uint8(n)), nil
+	}
+	return ColorNone, fmt.Errorf("unknown color %q", str)
+}
+
+// Whether to color, given the setting of the writer: NO_COLOR turns colors
+// off and CLICOLOR_FORCE turns them on (see no-color.org and
+// bixense.com/clicolors)
+func colorFromEnv(color bool) bool {
+	if len(os.Getenv("NO_COLOR")) > 0 {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); len(force) > 0 && force != "0" {
+		return true
+	}
+	return color
+}
@@ -0,0 +1,27 @@
+package log4go
+
+import (
+	"time"
+)
+
+// The field holding the time measured by LogDuration and TimeTrack
+const DURATION_FIELD = "duration"
+
+// LogDuration logs that name took d, e.g. "load users took 1.2ms", with d
+// as the field duration.
+func (log *Logger) LogDuration(lvl Level, name string, d time.Duration) {
+	log.intLog(2, lvl, Fields{DURATION_FIELD: d}, name+" took "+d.String())
+}
+
+// TimeTrack starts timing name and returns a function logging how long it
+// took with LogDuration when called, to be deferred at the start of what
+// is timed:
+//
+//	defer log4go.TimeTrack(log, INFO, "load users")()
+func TimeTrack(log *Logger, lvl Level, name string) func() {
+	start := clockNow()
+	return func() {
+		d := clockNow().Sub(start)
+		log.intLog(2, lvl, Fields{DURATION_FIELD: d}, name+" took "+d.String())
+	}
+}
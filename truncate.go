@@ -0,0 +1,53 @@
+package log4go
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// TruncateMiddleware returns middleware cutting messages longer than
+// maxMessage bytes and string field values longer than maxField bytes,
+// marking what was cut with "…(truncated N bytes)", so an accidental dump of
+// a huge payload cannot flood buffers and the parsers downstream.  A limit
+// of 0 or less leaves that part alone.
+func TruncateMiddleware(maxMessage, maxField int) Middleware {
+	return func(rec *LogRecord, next func(*LogRecord)) {
+		if maxMessage > 0 {
+			rec.Message = truncate(rec.Message, maxMessage)
+		}
+		if maxField <= 0 {
+			next(rec)
+			return
+		}
+
+		// The fields may belong to the caller, so change a copy
+		var fields Fields
+		for k, v := range rec.Fields {
+			if s, ok := v.(string); ok && len(s) > maxField {
+				if fields == nil {
+					fields = make(Fields, len(rec.Fields))
+					for k, v := range rec.Fields {
+						fields[k] = v
+					}
+				}
+				fields[k] = truncate(s, maxField)
+			}
+		}
+		if fields != nil {
+			rec.Fields = fields
+		}
+		next(rec)
+	}
+}
+
+// Cut s to at most max bytes, not splitting a character, and mark the cut
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…(truncated " + strconv.Itoa(len(s)-cut) + " bytes)"
+}
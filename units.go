@@ -0,0 +1,76 @@
+package log4go
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Multipliers of the size units ParseSize knows, by lower case name.  The
+// single letters are binary, as configuration files have always read them.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"m":   1 << 20,
+	"g":   1 << 30,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// ParseSize reads a number of bytes such as "512", "64KB", "1.5 MiB" or "4M".
+// KB, MB and GB are powers of 1000 and KiB, MiB and GiB powers of 1024, as
+// are K, M and G alone.  Units ignore case.
+func ParseSize(str string) (int64, error) {
+	s := strings.TrimSpace(str)
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') && s[i-1] != '.' {
+		i--
+	}
+	num, unit := strings.TrimSpace(s[:i]), strings.ToLower(strings.TrimSpace(s[i:]))
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("bad size %q: unknown unit %q, expected B, KB, MB, GB, KiB, MiB or GiB", str, s[i:])
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || len(num) == 0 {
+		return 0, fmt.Errorf("bad size %q: expected a number of bytes, e.g. 10MB", str)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("bad size %q: must not be negative", str)
+	}
+	if n*mult > math.MaxInt64/2 {
+		return 0, fmt.Errorf("bad size %q: too large", str)
+	}
+	return int64(n * mult), nil
+}
+
+// ParseDuration reads a duration as time.ParseDuration does, e.g. "30s",
+// "15m" or "1h30m", or a number of days such as "7d".  It must not be
+// negative.
+func ParseDuration(str string) (time.Duration, error) {
+	s := strings.TrimSpace(str)
+	var d time.Duration
+	var err error
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n float64
+		if n, err = strconv.ParseFloat(days, 64); err == nil {
+			d = time.Duration(n * float64(24*time.Hour))
+		}
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad duration %q: expected e.g. 30s, 15m, 24h or 7d", str)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("bad duration %q: must not be negative", str)
+	}
+	return d, nil
+}
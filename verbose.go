@@ -0,0 +1,195 @@
+package log4go
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The field holding the verbosity of records logged through V
+const VERBOSITY_FIELD = "v"
+
+// Verbose logs a message if its verbosity is enabled; see Logger.V.
+type Verbose struct {
+	log   *Logger
+	level int
+	on    bool
+}
+
+// V returns a Verbose logging at verbosity level, for programs moving from
+// glog or klog:
+//
+//	log.V(2).Infof("cache miss for %s", key)
+//
+// The messages are written if level is at most the logger's verbosity (0 by
+// default), or the verbosity SetVModule gives the calling file.  Level 0 is
+// logged at INFO, 1 at TRACE and higher levels at DEBUG, so filters must let
+// those through as well.  The level is attached as the "v" field.
+func (log *Logger) V(level int) Verbose {
+	return log.verbose(level)
+}
+
+// Decide whether level is enabled for the caller of V, which must call this
+// directly
+func (log *Logger) verbose(level int) Verbose {
+	st := log.load()
+	on := level <= st.verbosity
+	if !on && st.vmodule != nil {
+		var pcs [1]uintptr
+		if runtime.Callers(3, pcs[:]) == 1 {
+			if vlevel, ok := st.vmodule.levelAt(pcs[0]); ok {
+				on = level <= vlevel
+			}
+		}
+	}
+	return Verbose{log: log, level: level, on: on}
+}
+
+// The level at which V records are logged
+func verboseLevel(level int) Level {
+	switch {
+	case level <= 0:
+		return INFO
+	case level == 1:
+		return TRACE
+	}
+	return DEBUG
+}
+
+// Enabled reports whether the messages would be written, so expensive
+// arguments can be skipped.
+func (v Verbose) Enabled() bool {
+	return v.on && !v.log.skip(verboseLevel(v.level))
+}
+
+// Info logs its arguments formatted like fmt.Print.
+func (v Verbose) Info(args ...interface{}) {
+	if v.on {
+		v.log.intLog(2, verboseLevel(v.level), Fields{VERBOSITY_FIELD: v.level}, fmt.Sprint(resolveLazy(args)...))
+	}
+}
+
+// Infof logs like Logger.Info.
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.on {
+		v.log.intLog(2, verboseLevel(v.level), Fields{VERBOSITY_FIELD: v.level}, format, args...)
+	}
+}
+
+// Infoln logs its arguments formatted like fmt.Println.
+func (v Verbose) Infoln(args ...interface{}) {
+	if v.on {
+		msg := fmt.Sprintln(resolveLazy(args)...)
+		v.log.intLog(2, verboseLevel(v.level), Fields{VERBOSITY_FIELD: v.level}, msg[:len(msg)-1])
+	}
+}
+
+// Set the verbosity V messages are written up to (chainable).  It may be
+// changed while other goroutines log.
+func (log *Logger) SetVerbosity(level int) *Logger {
+	log.update(false, func(st *loggerState) {
+		st.verbosity = level
+	})
+	return log
+}
+
+// Verbosity returns the level set with SetVerbosity.
+func (log *Logger) Verbosity() int {
+	return log.load().verbosity
+}
+
+// The verbosity of source files, parsed from a -vmodule style spec
+type vmodule struct {
+	spec  string
+	rules []vmoduleRule
+	cache sync.Map // program counter of a V call -> vmoduleMatch
+}
+
+type vmoduleMatch struct {
+	level int
+	ok    bool
+}
+
+type vmoduleRule struct {
+	pattern string // path.Match pattern of the file name without .go
+	elems   int    // path elements the pattern matches
+	level   int
+}
+
+// SetVModule sets the verbosity of source files, overriding SetVerbosity
+// where it is higher, from a comma separated list of pattern=N in the style
+// of glog's -vmodule flag, e.g. "cache=2,db/*=1".  Patterns are matched
+// against the name of the file without .go or, if they contain slashes,
+// against as many of its last path elements; the first match applies.  An
+// empty spec removes the overrides.  It may be changed while other
+// goroutines log.
+func (log *Logger) SetVModule(spec string) error {
+	vm, err := parseVModule(spec)
+	if err != nil {
+		return err
+	}
+	log.update(false, func(st *loggerState) {
+		st.vmodule = vm
+	})
+	return nil
+}
+
+// VModule returns the spec set with SetVModule.
+func (log *Logger) VModule() string {
+	if vm := log.load().vmodule; vm != nil {
+		return vm.spec
+	}
+	return ""
+}
+
+func parseVModule(spec string) (*vmodule, error) {
+	spec = strings.TrimSpace(spec)
+	if len(spec) == 0 {
+		return nil, nil
+	}
+	vm := &vmodule{spec: spec}
+	for _, item := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, fmt.Errorf("bad vmodule %q: expected pattern=N", item)
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("bad vmodule %q: %s", item, err)
+		}
+		pattern := strings.TrimSuffix(strings.TrimSpace(kv[0]), ".go")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad vmodule %q: %s", item, err)
+		}
+		vm.rules = append(vm.rules, vmoduleRule{pattern, strings.Count(pattern, "/") + 1, level})
+	}
+	return vm, nil
+}
+
+// The verbosity of the file holding pc, if a rule matches it
+func (vm *vmodule) levelAt(pc uintptr) (int, bool) {
+	if m, ok := vm.cache.Load(pc); ok {
+		return m.(vmoduleMatch).level, m.(vmoduleMatch).ok
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	level, ok := vm.levelOf(frame.File)
+	vm.cache.Store(pc, vmoduleMatch{level, ok})
+	return level, ok
+}
+
+func (vm *vmodule) levelOf(file string) (int, bool) {
+	file = strings.TrimSuffix(file, ".go")
+	elems := strings.Split(file, "/")
+	for _, r := range vm.rules {
+		if r.elems > len(elems) {
+			continue
+		}
+		if ok, _ := path.Match(r.pattern, strings.Join(elems[len(elems)-r.elems:], "/")); ok {
+			return r.level, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,463 @@
+package log4go
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Size past which the write-ahead log starts a new segment
+	WAL_SEGMENT_SIZE = 64 * 1024 * 1024
+
+	// Time between attempts to deliver a record the writer refused
+	WAL_RETRY = time.Second
+
+	// Records delivered between checkpoints while catching up
+	WAL_CHECKPOINT_EVERY = 100
+)
+
+// Returned by WALLogWriter.LogWriteErr once the writer is closed
+var ErrWALClosed = errors.New("write-ahead log closed")
+
+var errWALCorrupt = errors.New("corrupt write-ahead log record")
+
+var walCRC = crc32.MakeTable(crc32.Castagnoli)
+
+const walCheckpoint = "checkpoint"
+
+// This log writer makes delivery to another writer survive crashes, for
+// audit logs that must not lose a record.  Each record is appended to a
+// segment file in dir and synced to disk before LogWrite returns; a
+// goroutine then passes the records on in order, retrying those the writer
+// refuses, and checkpoints how far it got.  Delivered segments are removed.
+// A WALLogWriter opened on the same dir after a crash or a Close with
+// records still pending delivers them first, so records may be delivered
+// twice but never lost.  Records come back from disk with field values as
+// text.  Refusals are only noticed if the writer implements ErrorLogWriter.
+//
+// The guarantee starts when LogWrite is called.  A Filter queues records on
+// a channel before its writer gets them, and a crash loses what is queued,
+// so use the WALLogWriter in a Filter in sync mode (Filter.SetSync) for a
+// record to be on disk when the logging call returns.
+type WALLogWriter struct {
+	dir    string
+	writer LogWriter
+	wmu    sync.Mutex // serializes the calls on writer
+
+	mu      sync.Mutex
+	cond    *sync.Cond // broadcast when delivery moves on or fails
+	seg     *os.File
+	wseq    uint64 // segment being appended to
+	wsize   int64  // bytes of it synced
+	rseq    uint64 // segment being delivered
+	roff    int64  // bytes of it delivered
+	failing bool   // the writer refused the last attempt
+	closed  bool
+
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+// This creates a new WALLogWriter keeping its log in dir, which is created
+// if needed, and delivering to writer.  Records left in dir by an earlier
+// WALLogWriter are delivered before new ones.
+func NewWALLogWriter(dir string, writer LogWriter) (*WALLogWriter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	seqs, err := walSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	cseq, coff := readWALCheckpoint(dir)
+
+	w := &WALLogWriter{
+		dir:    dir,
+		writer: writer,
+		rseq:   cseq,
+		roff:   coff,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	// Segments before the checkpoint were delivered
+	var pending []uint64
+	for _, seq := range seqs {
+		if seq < cseq {
+			os.Remove(w.segmentName(seq))
+		} else {
+			pending = append(pending, seq)
+		}
+	}
+	w.wseq = cseq + 1
+	if len(pending) > 0 {
+		if pending[0] > cseq {
+			w.rseq, w.roff = pending[0], 0
+		}
+		if last := pending[len(pending)-1]; last >= w.wseq {
+			w.wseq = last + 1
+		}
+	} else {
+		w.rseq, w.roff = w.wseq, 0
+	}
+	if w.seg, err = w.createSegment(w.wseq); err != nil {
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+func (w *WALLogWriter) segmentName(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d.wal", seq))
+}
+
+func (w *WALLogWriter) createSegment(seq uint64) (*os.File, error) {
+	fd, err := os.OpenFile(w.segmentName(seq), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	syncDir(w.dir)
+	return fd, nil
+}
+
+// The sequence numbers of the segments in dir, in order
+func walSegments(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		if seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".wal"), 10, 64); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// The segment and offset delivery got to, or zeros if there is no checkpoint
+func readWALCheckpoint(dir string) (seq uint64, off int64) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, walCheckpoint))
+	if err != nil {
+		return 0, 0
+	}
+	if _, err := fmt.Sscanf(string(buf), "%d %d", &seq, &off); err != nil {
+		return 0, 0
+	}
+	return seq, off
+}
+
+// Replace the checkpoint so a crash leaves either the old or the new one
+func writeWALCheckpoint(dir string, seq uint64, off int64) error {
+	name := filepath.Join(dir, walCheckpoint)
+	fd, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fd, "%d %d\n", seq, off)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// Make the entries of dir durable; not possible everywhere, so best effort
+func syncDir(dir string) {
+	if fd, err := os.Open(dir); err == nil {
+		fd.Sync()
+		fd.Close()
+	}
+}
+
+// Records are framed as their length and CRC-32C, then the logrecord.proto
+// message
+func appendWALFrame(dst []byte, rec *LogRecord) []byte {
+	msg := appendProtobufRecord(nil, rec)
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(msg)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(msg, walCRC))
+	return append(append(dst, hdr[:]...), msg...)
+}
+
+// Read the frame at off, not reading at or past end unless it is negative;
+// returns io.EOF at the end and the size of the frame otherwise
+func readWALFrame(fd *os.File, off, end int64) (*LogRecord, int64, error) {
+	if end >= 0 && off >= end {
+		return nil, 0, io.EOF
+	}
+	var hdr [8]byte
+	if n, err := fd.ReadAt(hdr[:], off); n == 0 && err == io.EOF {
+		return nil, 0, io.EOF
+	} else if n < len(hdr) {
+		return nil, 0, errWALCorrupt
+	}
+	size := int64(binary.BigEndian.Uint32(hdr[:4]))
+	if size > PROTOBUF_MAX_SIZE || (end >= 0 && off+8+size > end) {
+		return nil, 0, errWALCorrupt
+	}
+	msg := make([]byte, size)
+	if n, _ := fd.ReadAt(msg, off+8); int64(n) < size {
+		return nil, 0, errWALCorrupt
+	}
+	if crc32.Checksum(msg, walCRC) != binary.BigEndian.Uint32(hdr[4:]) {
+		return nil, 0, errWALCorrupt
+	}
+	rec, err := UnmarshalProtobufRecord(msg)
+	if err != nil {
+		return nil, 0, errWALCorrupt
+	}
+	return rec, 8 + size, nil
+}
+
+// LogWrite hands a record the log cannot take straight to the writer, so it
+// is not lost while the disk fails.
+func (w *WALLogWriter) LogWrite(rec *LogRecord) {
+	if err := w.LogWriteErr(rec); err != nil && err != ErrWALClosed {
+		reportError("WALLogWriter", err)
+		w.wmu.Lock()
+		logWriteErr(w.writer, rec)
+		w.wmu.Unlock()
+	}
+}
+
+// LogWriteErr returns once rec is synced to disk.
+func (w *WALLogWriter) LogWriteErr(rec *LogRecord) error {
+	frame := appendWALFrame(nil, rec)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrWALClosed
+	}
+	if w.wsize > 0 && w.wsize+int64(len(frame)) > WAL_SEGMENT_SIZE {
+		seg, err := w.createSegment(w.wseq + 1)
+		if err != nil {
+			return err
+		}
+		w.seg.Close()
+		w.seg, w.wseq, w.wsize = seg, w.wseq+1, 0
+	}
+	if _, err := w.seg.Write(frame); err != nil {
+		w.seg.Truncate(w.wsize)
+		return err
+	}
+	if err := w.seg.Sync(); err != nil {
+		w.seg.Truncate(w.wsize)
+		return err
+	}
+	w.wsize += int64(len(frame))
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Deliver the log to the writer until closed
+func (w *WALLogWriter) run() {
+	defer close(w.done)
+
+	var fd *os.File
+	var fdSeq uint64
+	unsaved := 0
+	checkpoint := func() {
+		w.mu.Lock()
+		seq, off := w.rseq, w.roff
+		w.mu.Unlock()
+		if err := writeWALCheckpoint(w.dir, seq, off); err != nil {
+			reportError("WALLogWriter", err)
+		}
+		unsaved = 0
+	}
+	// Move on to the next segment, removing the delivered one
+	next := func(seq uint64) {
+		if fd != nil {
+			fd.Close()
+			fd = nil
+		}
+		w.mu.Lock()
+		w.rseq, w.roff = seq+1, 0
+		w.mu.Unlock()
+		checkpoint()
+		os.Remove(w.segmentName(seq))
+	}
+	defer func() {
+		if fd != nil {
+			fd.Close()
+		}
+		checkpoint()
+	}()
+
+	for {
+		w.mu.Lock()
+		rseq, roff, wseq, wsize, closed := w.rseq, w.roff, w.wseq, w.wsize, w.closed
+		if rseq == wseq && roff >= wsize {
+			w.cond.Broadcast()
+		}
+		w.mu.Unlock()
+
+		if rseq == wseq && roff >= wsize {
+			if unsaved > 0 {
+				checkpoint()
+			}
+			if closed {
+				return
+			}
+			select {
+			case <-w.wake:
+			case <-w.quit:
+			}
+			continue
+		}
+
+		if fd == nil || fdSeq != rseq {
+			if fd != nil {
+				fd.Close()
+			}
+			var err error
+			if fd, err = os.Open(w.segmentName(rseq)); err != nil {
+				fd = nil
+				reportError("WALLogWriter", err)
+				if rseq == wseq {
+					return
+				}
+				next(rseq)
+				continue
+			}
+			fdSeq = rseq
+		}
+
+		end := int64(-1)
+		if rseq == wseq {
+			end = wsize
+		}
+		rec, size, err := readWALFrame(fd, roff, end)
+		if err == io.EOF {
+			next(rseq)
+			continue
+		}
+		if err != nil {
+			// Nothing after a bad frame can be trusted
+			reportError("WALLogWriter", fmt.Errorf("%s at offset %d: %v, skipping the rest of the segment", w.segmentName(rseq), roff, err))
+			if rseq < wseq {
+				next(rseq)
+			} else {
+				w.mu.Lock()
+				w.roff = wsize
+				w.mu.Unlock()
+				checkpoint()
+			}
+			continue
+		}
+
+		if !w.deliver(rec) {
+			return
+		}
+		w.mu.Lock()
+		w.roff += size
+		w.mu.Unlock()
+		if unsaved++; unsaved >= WAL_CHECKPOINT_EVERY {
+			checkpoint()
+		}
+	}
+}
+
+// Write rec to the writer, retrying until it goes through; gives up and
+// returns false if it fails once the log is closed
+func (w *WALLogWriter) deliver(rec *LogRecord) bool {
+	for {
+		w.wmu.Lock()
+		err := logWriteErr(w.writer, rec)
+		w.wmu.Unlock()
+
+		w.mu.Lock()
+		wasFailing, closed := w.failing, w.closed
+		w.failing = err != nil
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		if err == nil {
+			if wasFailing {
+				reportError("WALLogWriter", errors.New("writer recovered, delivering again"))
+			}
+			return true
+		}
+		if !wasFailing {
+			reportError("WALLogWriter", fmt.Errorf("delivery failed, retrying: %v", err))
+		}
+		if closed {
+			return false
+		}
+		select {
+		case <-time.After(WAL_RETRY):
+		case <-w.quit:
+		}
+	}
+}
+
+// Pending reports whether records are waiting to be delivered.
+func (w *WALLogWriter) Pending() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rseq != w.wseq || w.roff < w.wsize
+}
+
+// Flush waits until the records written so far are delivered, or the writer
+// refuses one, then flushes the writer.
+func (w *WALLogWriter) Flush() {
+	w.mu.Lock()
+	for !w.closed && !w.failing && (w.rseq != w.wseq || w.roff < w.wsize) {
+		w.cond.Wait()
+	}
+	w.mu.Unlock()
+	w.wmu.Lock()
+	w.writer.Flush()
+	w.wmu.Unlock()
+}
+
+// Close delivers what it can; records the writer refuses stay in the log for
+// the next WALLogWriter on the same dir.
+func (w *WALLogWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	close(w.quit)
+	<-w.done
+	w.seg.Close()
+	w.wmu.Lock()
+	w.writer.Close()
+	w.wmu.Unlock()
+}
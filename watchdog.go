@@ -0,0 +1,83 @@
+package log4go
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// The source of the records Watchdog writes, which it does not count as
+// activity
+const WATCHDOG_SOURCE = "watchdog"
+
+// Watchdog raises an alert when log has dispatched no record at level lvl
+// or above for threshold, catching a service that has silently wedged: it
+// calls alert with how long it has been silent or, if alert is nil, logs a
+// WARNING saying so.  It alerts once per silence, then again only after
+// records have resumed and stopped again.  Call the returned function to
+// stop watching.
+func (log *Logger) Watchdog(lvl Level, threshold time.Duration, alert func(silence time.Duration)) (stop func()) {
+	w := &watchdog{log: log, lvl: lvl, threshold: threshold, alert: alert, last: clockNow().UnixNano()}
+	log.AddHook(w)
+
+	interval := threshold / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		atomic.StoreInt32(&w.stopped, 1)
+		close(done)
+	}
+}
+
+// A Hook noting when the last record at or above a level was dispatched
+type watchdog struct {
+	log       *Logger
+	lvl       Level
+	threshold time.Duration
+	alert     func(silence time.Duration)
+	last      int64 // UnixNano of the last record
+	alerted   int32
+	stopped   int32
+}
+
+func (w *watchdog) BeforeDispatch(rec *LogRecord) {
+	if rec.Level < w.lvl || rec.Source == WATCHDOG_SOURCE || atomic.LoadInt32(&w.stopped) != 0 {
+		return
+	}
+	atomic.StoreInt64(&w.last, clockNow().UnixNano())
+	atomic.StoreInt32(&w.alerted, 0)
+}
+
+func (w *watchdog) AfterWrite(filter string, rec *LogRecord, err error) {}
+
+// Raise the alert if the silence has lasted threshold and is not known yet
+func (w *watchdog) check() {
+	silence := clockNow().Sub(time.Unix(0, atomic.LoadInt64(&w.last)))
+	if silence < w.threshold || !atomic.CompareAndSwapInt32(&w.alerted, 0, 1) {
+		return
+	}
+	if w.alert != nil {
+		w.alert(silence)
+		return
+	}
+	w.log.Dispatch(&LogRecord{
+		Level:   WARNING,
+		Created: clockNow(),
+		Source:  WATCHDOG_SOURCE,
+		Message: fmt.Sprintf("no %s records for %s", w.lvl, silence),
+	})
+}